@@ -0,0 +1,282 @@
+// Command go-radclient sends RADIUS requests built from attribute lists and prints the replies, like radclient.
+//
+// Usage:
+//
+//	go-radclient [flags] server {auth|acct|status|coa|disconnect} secret
+//
+// Requests are read from standard input, or the file given with -f, as "Name = value" pairs separated by commas or
+// newlines. A blank line starts another request. The User-Password of Access-Requests is given in cleartext.
+// Attributes are those known to the radius package and those of the dictionary files given with -dictionary.
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoles/radius/radius"
+)
+
+// commands maps the request types of the command line to their code and default port.
+var commands = map[string]struct {
+	code radius.Code
+	port string
+}{
+	"auth":       {radius.AccessRequest, "1812"},
+	"acct":       {radius.AccountingRequest, "1813"},
+	"status":     {radius.StatusServer, "1812"},
+	"coa":        {radius.CoARequest, radius.DAPort},
+	"disconnect": {radius.DisconnectRequest, radius.DAPort},
+}
+
+func main() {
+	file := flag.String("f", "", "read requests from `file` instead of standard input")
+	count := flag.Int("c", 1, "send each request `count` times")
+	parallel := flag.Int("p", 1, "send up to `n` requests in parallel")
+	timeout := flag.Duration("t", 3*time.Second, "wait `duration` for a response before retransmitting")
+	retries := flag.Int("r", 3, "send each request at most `n` times")
+	quiet := flag.Bool("q", false, "do not print responses")
+	summary := flag.Bool("s", false, "print a summary of the responses received")
+	proto := flag.String("P", "udp", "send requests over `proto`, udp or tcp")
+	dictionaries := flag.String("dictionary", "", "comma-separated FreeRADIUS dictionary `files` to load")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] server {auth|acct|status|coa|disconnect} secret\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 3 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	command, ok := commands[flag.Arg(1)]
+	if !ok {
+		flag.Usage()
+		os.Exit(2)
+	}
+	server := flag.Arg(0)
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, command.port)
+	}
+	secret := flag.Arg(2)
+
+	input := io.Reader(os.Stdin)
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		input = f
+	}
+
+	dictionary := radius.DefaultDictionary
+	if *dictionaries != "" {
+		dictionary = dictionary.Clone()
+		for _, name := range strings.Split(*dictionaries, ",") {
+			if err := dictionary.LoadFile(name); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	requests, err := readRequests(input)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(requests) == 0 && command.code == radius.StatusServer {
+		requests = append(requests, nil)
+	}
+	for _, pairs := range requests {
+		if _, err := buildRequest(command.code, pairs, secret, dictionary); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	client := &radius.Client{Net: *proto, Retry: *timeout, MaxRetry: *timeout, MaxAttempts: *retries}
+	defer client.Close()
+
+	var (
+		mu        sync.Mutex
+		responses = make(map[radius.Code]int)
+		failures  int
+	)
+
+	jobs := make(chan radius.Pairs)
+	var wg sync.WaitGroup
+	for i := 0; i < *parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pairs := range jobs {
+				request, _ := buildRequest(command.code, pairs, secret, dictionary)
+				response, err := client.Exchange(context.Background(), server, secret, request)
+
+				mu.Lock()
+				if err != nil {
+					failures++
+					log.Printf("no response to request Id %d: %v", request.Identifier, err)
+				} else {
+					responses[response.Code]++
+					if !*quiet {
+						printResponse(os.Stdout, response, server, dictionary)
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	start := time.Now()
+	for i := 0; i < *count; i++ {
+		for _, pairs := range requests {
+			jobs <- pairs
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if *summary {
+		elapsed := time.Since(start)
+		sent := *count * len(requests)
+		fmt.Printf("Sent %d requests in %v (%.0f/s)\n", sent, elapsed.Round(time.Millisecond), float64(sent)/elapsed.Seconds())
+		for code, n := range responses {
+			fmt.Printf("\t%s: %d\n", code, n)
+		}
+		fmt.Printf("\tNo response: %d\n", failures)
+	}
+
+	for code := range responses {
+		if code == radius.AccessReject || code == radius.CoANAK || code == radius.DisconnectNAK {
+			failures++
+		}
+	}
+	if failures > 0 {
+		os.Exit(1)
+	}
+}
+
+// readRequests reads lists of "Name = value" pairs separated by commas or newlines, one list per request.
+func readRequests(r io.Reader) ([]radius.Pairs, error) {
+	var requests []radius.Pairs
+	var pairs radius.Pairs
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			if pairs != nil {
+				requests = append(requests, pairs)
+				pairs = nil
+			}
+			continue
+		}
+		if strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		for _, item := range splitPairs(text) {
+			i := strings.IndexByte(item, '=')
+			if i < 0 {
+				return nil, fmt.Errorf("line %d: expected Name = value, got %q", line, item)
+			}
+			name := strings.TrimSpace(item[:i])
+			value := strings.TrimSpace(item[i+1:])
+			if strings.HasPrefix(value, `"`) {
+				unquoted, err := strconv.Unquote(value)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid value %s", line, value)
+				}
+				value = unquoted
+			}
+			pairs = append(pairs, radius.Pair{Attribute: name, Op: radius.OpEqual, Value: value})
+		}
+	}
+	if pairs != nil {
+		requests = append(requests, pairs)
+	}
+
+	return requests, scanner.Err()
+}
+
+// splitPairs splits a line at the commas that are not within a quoted value, dropping blank items.
+func splitPairs(line string) []string {
+	var items []string
+	quoted := false
+	start := 0
+
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				if item := strings.TrimSpace(line[start:i]); item != "" {
+					items = append(items, item)
+				}
+				start = i + 1
+			}
+		}
+	}
+	if item := strings.TrimSpace(line[start:]); item != "" {
+		items = append(items, item)
+	}
+
+	return items
+}
+
+// buildRequest returns a request of the given code carrying pairs, encoded with dictionary, with its User-Password
+// hidden with secret.
+func buildRequest(code radius.Code, pairs radius.Pairs, secret string, dictionary *radius.Dictionary) (*radius.Packet, error) {
+	packet := &radius.Packet{Code: code}
+	if code == radius.StatusServer {
+		packet = radius.NewStatusServer()
+	}
+
+	var password string
+	hasPassword := false
+	for _, pair := range pairs {
+		switch {
+		case code == radius.AccessRequest && strings.EqualFold(pair.Attribute, "User-Password"):
+			password, hasPassword = pair.Value, true
+		case strings.EqualFold(pair.Attribute, "Message-Authenticator"):
+			// The client computes it.
+			if code != radius.StatusServer {
+				packet.AddAttribute(radius.MessageAuthenticator, make([]byte, 16))
+			}
+		default:
+			if err := dictionary.AddAttribute(packet, pair.Attribute, pair.Value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if hasPassword {
+		if _, err := rand.Read(packet.Authenticator[:]); err != nil {
+			return nil, err
+		}
+		packet.AddAttribute(radius.UserPassword, radius.HidePassword(password, packet.Authenticator, secret))
+	}
+
+	return packet, nil
+}
+
+// printResponse writes response and its attributes, named by dictionary, the way radclient does.
+func printResponse(w io.Writer, response *radius.Packet, server string, dictionary *radius.Dictionary) {
+	fmt.Fprintf(w, "Received %s Id %d from %s length %d\n", response.Code, response.Identifier, server, response.Length)
+	for _, pair := range dictionary.Pairs(response) {
+		fmt.Fprintf(w, "\t%s = %s\n", pair.Attribute, pair.Value)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jmoles/radius/radius"
+)
+
+// pair returns the pair read from "name = value".
+func pair(name string, value string) radius.Pair {
+	return radius.Pair{Attribute: name, Op: radius.OpEqual, Value: value}
+}
+
+func TestSplitPairs(t *testing.T) {
+	cases := []struct {
+		line  string
+		items []string
+	}{
+		{`User-Name = alice`, []string{`User-Name = alice`}},
+		{`User-Name = alice, NAS-Port = 1`, []string{`User-Name = alice`, `NAS-Port = 1`}},
+		{`Reply-Message = "a, b", NAS-Port = 1`, []string{`Reply-Message = "a, b"`, `NAS-Port = 1`}},
+		{`Reply-Message = "say \"a, b\"", NAS-Port = 1`, []string{`Reply-Message = "say \"a, b\""`, `NAS-Port = 1`}},
+		{`User-Name = alice,`, []string{`User-Name = alice`}},
+		{`User-Name = alice, , NAS-Port = 1`, []string{`User-Name = alice`, `NAS-Port = 1`}},
+		{``, nil},
+	}
+
+	for _, c := range cases {
+		if items := splitPairs(c.line); !reflect.DeepEqual(items, c.items) {
+			t.Errorf("splitPairs(%q) = %q, want %q", c.line, items, c.items)
+		}
+	}
+}
+
+func TestReadRequests(t *testing.T) {
+	cases := []struct {
+		input    string
+		requests []radius.Pairs
+		err      string
+	}{
+		{"User-Name = alice, User-Password = \"wonder, land\"\nNAS-Port = 1\n",
+			[]radius.Pairs{{pair("User-Name", "alice"), pair("User-Password", "wonder, land"), pair("NAS-Port", "1")}}, ""},
+		{"# comment\nUser-Name = alice\n\n\nUser-Name = bob\n",
+			[]radius.Pairs{{pair("User-Name", "alice")}, {pair("User-Name", "bob")}}, ""},
+		{"Reply-Message = \"tab\\there\"", []radius.Pairs{{pair("Reply-Message", "tab\there")}}, ""},
+		{"Reply-Message = a=b", []radius.Pairs{{pair("Reply-Message", "a=b")}}, ""},
+		{"\n\n", nil, ""},
+		{"User-Name = alice\nNAS-Port", nil, `line 2: expected Name = value, got "NAS-Port"`},
+		{"User-Name = \"alice", nil, `line 1: invalid value "alice`},
+	}
+
+	for _, c := range cases {
+		requests, err := readRequests(strings.NewReader(c.input))
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Errorf("readRequests(%q): err = %v, want %s", c.input, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("readRequests(%q): %v", c.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(requests, c.requests) {
+			t.Errorf("readRequests(%q) = %v, want %v", c.input, requests, c.requests)
+		}
+	}
+}
+
+func TestBuildRequestDictionary(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "dictionary")
+	if err := os.WriteFile(name, []byte("VENDOR Example 32473\nBEGIN-VENDOR Example\nATTRIBUTE Example-Role 1 string\nEND-VENDOR Example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	dictionary := radius.DefaultDictionary.Clone()
+	if err := dictionary.LoadFile(name); err != nil {
+		t.Fatal(err)
+	}
+
+	pairs := radius.Pairs{pair("User-Name", "alice"), pair("User-Password", "wonderland"), pair("Example-Role", "admin")}
+	if _, err := buildRequest(radius.AccessRequest, pairs, "secret", radius.DefaultDictionary); err == nil {
+		t.Error("DefaultDictionary encoded Example-Role")
+	}
+	packet, err := buildRequest(radius.AccessRequest, pairs, "secret", dictionary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values := packet.VendorValues(32473, 1); len(values) != 1 || string(values[0]) != "admin" {
+		t.Errorf("Example-Role values %q, want admin", values)
+	}
+	if password, ok := packet.Lookup(radius.UserPassword); !ok ||
+		radius.ReversePassword(password, packet.Authenticator, "secret") != "wonderland" {
+		t.Errorf("User-Password not hidden with the secret")
+	}
+
+	var b bytes.Buffer
+	printResponse(&b, packet, "127.0.0.1:1812", dictionary)
+	if !strings.Contains(b.String(), "\tExample-Role = admin\n") {
+		t.Errorf("printResponse wrote %q", b.String())
+	}
+}
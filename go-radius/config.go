@@ -0,0 +1,321 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// config is the configuration file of go-radius, written in YAML.
+type config struct {
+	// Listen lists the sockets requests are received on. If empty, requests are received over UDP on port 1812
+	// for authentication and 1813 for accounting.
+	Listen []listenConfig `yaml:"listen"`
+
+	// Secret is the shared secret of clients which have none, and of every client if Clients is empty, in which
+	// case requests from any address are answered.
+	Secret  string         `yaml:"secret"`
+	Clients []clientConfig `yaml:"clients"`
+
+	// Dictionaries are FreeRADIUS dictionary files loaded in addition to the attributes known to the server.
+	Dictionaries []string `yaml:"dictionaries"`
+
+	Users      usersConfig      `yaml:"users"`
+	Accounting accountingConfig `yaml:"accounting"`
+
+	// Policy is a file of rules evaluated for every request, as described by radius.Policy. Backends are the users
+	// backends its "use" statements select by name.
+	Policy   string                 `yaml:"policy"`
+	Backends map[string]usersConfig `yaml:"backends"`
+
+	// Workers, QueueSize, DropPolicy ("newest" or "oldest") and MaxInFlight bound the requests handled at once,
+	// as described by radius.Server.
+	Workers     int    `yaml:"workers"`
+	QueueSize   int    `yaml:"queue_size"`
+	DropPolicy  string `yaml:"drop_policy"`
+	MaxInFlight int    `yaml:"max_in_flight"`
+
+	Log     logConfig     `yaml:"log"`
+	Metrics metricsConfig `yaml:"metrics"`
+
+	// Watch is how often the configuration file, the users files, the policy and the dictionaries are checked for changes,
+	// which reload them as SIGHUP does. They are not checked if zero.
+	Watch time.Duration `yaml:"watch"`
+}
+
+// listenConfig describes the sockets of one transport.
+type listenConfig struct {
+	// Net is "udp", "tcp", "tls" or "dtls", "udp" if empty. UDP and TCP may be restricted to IPv4 or IPv6 with
+	// "udp4", "tcp6", etc.
+	Net string `yaml:"net"`
+	// Addrs are the addresses to listen on, ":1812" or ":2083" for TLS and DTLS if empty.
+	Addrs []string `yaml:"addrs"`
+	// Role is "auth" or "accounting", "auth" if empty. Status-Server is answered with an Access-Accept on
+	// authentication sockets and with an Accounting-Response on accounting ones.
+	Role string `yaml:"role"`
+
+	// Readers and ReusePort spread the requests received over UDP over several goroutines.
+	Readers   int  `yaml:"readers"`
+	ReusePort bool `yaml:"reuse_port"`
+
+	// IdleTimeout closes connections without requests for that long.
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+
+	// Cert and Key hold the certificate of the server over TLS and DTLS. ClientCA holds the certificates client
+	// certificates are verified against.
+	Cert     string `yaml:"cert"`
+	Key      string `yaml:"key"`
+	ClientCA string `yaml:"client_ca"`
+}
+
+// clientConfig describes a NAS allowed to send requests.
+type clientConfig struct {
+	Name string `yaml:"name"`
+	// Network is the address or CIDR network the client sends from over UDP and TCP.
+	Network string `yaml:"network"`
+	Secret  string `yaml:"secret"`
+	// Identity is the name in the certificate the client presents over TLS and DTLS.
+	Identity string `yaml:"identity"`
+}
+
+// usersConfig selects the backend Access-Requests are authenticated against. At most one may be set. If none is,
+// Access-Requests are not answered.
+type usersConfig struct {
+	// File is a YAML file mapping user names to their stored password, such as "{SSHA}..." or a crypt(3) hash.
+	File string      `yaml:"file"`
+	LDAP *ldapConfig `yaml:"ldap"`
+	SQL  *sqlConfig  `yaml:"sql"`
+}
+
+// ldapConfig configures a radius.LDAPBackend. Reply items are written as a map of attribute names to values.
+type ldapConfig struct {
+	URL            string        `yaml:"url"`
+	BindDN         string        `yaml:"bind_dn"`
+	BindPassword   string        `yaml:"bind_password"`
+	BaseDN         string        `yaml:"base_dn"`
+	Filter         string        `yaml:"filter"`
+	GroupAttribute string        `yaml:"group_attribute"`
+	GroupBaseDN    string        `yaml:"group_base_dn"`
+	GroupFilter    string        `yaml:"group_filter"`
+	Timeout        time.Duration `yaml:"timeout"`
+
+	Reply  map[string]string            `yaml:"reply"`
+	Groups map[string]map[string]string `yaml:"groups"`
+}
+
+// sqlConfig opens a database with one of the drivers linked into go-radius, such as "sqlite3".
+type sqlConfig struct {
+	Driver string `yaml:"driver"`
+	DSN    string `yaml:"dsn"`
+}
+
+// accountingConfig selects where Accounting-Requests are stored. If neither is set, they are not answered.
+type accountingConfig struct {
+	Detail *detailConfig `yaml:"detail"`
+	SQL    *sqlConfig    `yaml:"sql"`
+}
+
+// detailConfig configures a radius.DetailWriter.
+type detailConfig struct {
+	Directory string `yaml:"directory"`
+	// Rotation is "hourly", "daily" or empty to never rotate.
+	Rotation string `yaml:"rotation"`
+	// Auth also records Access-Requests.
+	Auth bool `yaml:"auth"`
+}
+
+// logConfig configures the request log and the authentication audit log.
+type logConfig struct {
+	// Level is "debug", "info", "warn" or "error", "info" if empty.
+	Level string `yaml:"level"`
+	// Format is "text" or "json", "text" if empty.
+	Format string `yaml:"format"`
+	// File receives the log, the standard error if empty.
+	File string `yaml:"file"`
+
+	Audit *auditConfig `yaml:"audit"`
+}
+
+// auditConfig configures a radius.AuditLog.
+type auditConfig struct {
+	Path     string `yaml:"path"`
+	Rotation string `yaml:"rotation"`
+}
+
+// metricsConfig configures the Prometheus metrics endpoint.
+type metricsConfig struct {
+	// Addr is the HTTP address metrics are served on at /metrics. Metrics are not collected if empty.
+	Addr string `yaml:"addr"`
+}
+
+// loadConfig reads the configuration file called name. Unknown settings are errors.
+func loadConfig(name string) (*config, error) {
+	c := new(config)
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return c, nil
+}
+
+// validate checks the settings which do not need files to be read, returning every problem found.
+func (c *config) validate() error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	for i, l := range c.Listen {
+		switch l.Net {
+		case "", "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6":
+		case "tls", "dtls":
+			if l.Cert == "" || l.Key == "" {
+				fail("listen[%d]: %s needs a cert and a key", i, l.Net)
+			}
+			if l.ClientCA == "" {
+				fail("listen[%d]: %s needs a client_ca", i, l.Net)
+			}
+		default:
+			fail("listen[%d]: unknown net %q", i, l.Net)
+		}
+		if l.ReusePort && l.Net != "" && !strings.HasPrefix(l.Net, "udp") {
+			fail("listen[%d]: reuse_port only applies to udp", i)
+		}
+		if l.Role != "" && l.Role != "auth" && l.Role != "accounting" {
+			fail("listen[%d]: unknown role %q", i, l.Role)
+		}
+	}
+
+	if c.Secret == "" && len(c.Clients) == 0 {
+		fail("secret or clients must be set")
+	}
+	names := make(map[string]bool)
+	for i, client := range c.Clients {
+		if client.Name == "" {
+			fail("clients[%d]: name must be set", i)
+		} else if names[client.Name] {
+			fail("clients[%d]: duplicate name %q", i, client.Name)
+		}
+		names[client.Name] = true
+
+		if client.Network == "" && client.Identity == "" {
+			fail("clients[%d]: network or identity must be set", i)
+		}
+		if client.Network != "" {
+			if _, err := parseNetwork(client.Network); err != nil {
+				fail("clients[%d]: %v", i, err)
+			}
+			if client.Secret == "" && c.Secret == "" {
+				fail("clients[%d]: secret must be set", i)
+			}
+		}
+	}
+
+	c.Users.validate("users", fail)
+	for name, backend := range c.Backends {
+		backend.validate("backends."+name, fail)
+		if backend.File == "" && backend.LDAP == nil && backend.SQL == nil {
+			fail("backends.%s: file, ldap or sql must be set", name)
+		}
+	}
+	if c.Accounting.SQL != nil && !contains(sql.Drivers(), c.Accounting.SQL.Driver) {
+		fail("accounting.sql: unknown driver %q, want one of %s", c.Accounting.SQL.Driver, strings.Join(sql.Drivers(), ", "))
+	}
+
+	if detail := c.Accounting.Detail; detail != nil {
+		if detail.Directory == "" {
+			fail("accounting.detail: directory must be set")
+		}
+		if _, err := parseRotation(detail.Rotation); err != nil {
+			fail("accounting.detail: %v", err)
+		}
+	}
+
+	switch c.DropPolicy {
+	case "", "newest", "oldest":
+	default:
+		fail("drop_policy: %q is not newest or oldest", c.DropPolicy)
+	}
+
+	if _, err := parseLevel(c.Log.Level); err != nil {
+		fail("log: %v", err)
+	}
+	switch c.Log.Format {
+	case "", "text", "json":
+	default:
+		fail("log: format %q is not text or json", c.Log.Format)
+	}
+	if audit := c.Log.Audit; audit != nil {
+		if audit.Path == "" {
+			fail("log.audit: path must be set")
+		}
+		if _, err := parseRotation(audit.Rotation); err != nil {
+			fail("log.audit: %v", err)
+		}
+	}
+
+	if c.Watch < 0 {
+		fail("watch: %v is negative", c.Watch)
+	}
+
+	return errors.Join(errs...)
+}
+
+// validate checks the users backend u, reporting problems with fail under the setting name.
+func (u *usersConfig) validate(name string, fail func(format string, args ...interface{})) {
+	backends := 0
+	for _, set := range []bool{u.File != "", u.LDAP != nil, u.SQL != nil} {
+		if set {
+			backends++
+		}
+	}
+	if backends > 1 {
+		fail("%s: only one of file, ldap and sql may be set", name)
+	}
+	if u.LDAP != nil && (u.LDAP.URL == "" || u.LDAP.BaseDN == "" || u.LDAP.Filter == "") {
+		fail("%s.ldap: url, base_dn and filter must be set", name)
+	}
+	if u.SQL != nil && !contains(sql.Drivers(), u.SQL.Driver) {
+		fail("%s.sql: unknown driver %q, want one of %s", name, u.SQL.Driver, strings.Join(sql.Drivers(), ", "))
+	}
+}
+
+// parseNetwork parses an IP address or a CIDR network.
+func parseNetwork(s string) (*net.IPNet, error) {
+	if ip := net.ParseIP(s); ip != nil {
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid network %q", s)
+	}
+	return network, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
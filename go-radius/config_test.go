@@ -0,0 +1,207 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile writes content to the file called name in dir and returns its path.
+func writeFile(t *testing.T, dir string, name string, content string) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		config config
+		errs   []string
+	}{
+		{config{Secret: "s"}, nil},
+		{config{}, []string{"secret or clients must be set"}},
+		{config{Secret: "s", Listen: []listenConfig{{Net: "sctp"}}}, []string{`listen[0]: unknown net "sctp"`}},
+		{config{Secret: "s", Listen: []listenConfig{{Net: "tls", ClientCA: "ca.pem"}}},
+			[]string{"listen[0]: tls needs a cert and a key"}},
+		{config{Secret: "s", Listen: []listenConfig{{Net: "dtls", Cert: "cert.pem", Key: "key.pem"}}},
+			[]string{"listen[0]: dtls needs a client_ca"}},
+		{config{Secret: "s", Listen: []listenConfig{{Net: "tcp", ReusePort: true}, {Role: "proxy"}}},
+			[]string{"listen[0]: reuse_port only applies to udp", `listen[1]: unknown role "proxy"`}},
+		{config{Clients: []clientConfig{{Network: "10.0.0.1"}, {Name: "a", Network: "10.0.0.0/33", Secret: "s"}}},
+			[]string{"clients[0]: name must be set", "clients[0]: secret must be set", `clients[1]: invalid network "10.0.0.0/33"`}},
+		{config{Secret: "s", Clients: []clientConfig{{Name: "a", Network: "10.0.0.1"}, {Name: "a"}}},
+			[]string{`clients[1]: duplicate name "a"`, "clients[1]: network or identity must be set"}},
+		{config{Secret: "s", Users: usersConfig{File: "users", LDAP: &ldapConfig{}}},
+			[]string{"users: only one of file, ldap and sql may be set", "users.ldap: url, base_dn and filter must be set"}},
+		{config{Secret: "s", Backends: map[string]usersConfig{"none": {}}},
+			[]string{"backends.none: file, ldap or sql must be set"}},
+		{config{Secret: "s", DropPolicy: "random", Log: logConfig{Level: "loud", Format: "xml"}, Watch: -time.Second},
+			[]string{`drop_policy: "random" is not newest or oldest`, "log: ", `log: format "xml" is not text or json`,
+				"watch: -1s is negative"}},
+	}
+
+	for i, c := range cases {
+		err := c.config.validate()
+		if len(c.errs) == 0 {
+			if err != nil {
+				t.Errorf("%d: validate() = %v, want nil", i, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%d: validate() = nil, want %q", i, c.errs)
+			continue
+		}
+		lines := strings.Split(err.Error(), "\n")
+		if len(lines) != len(c.errs) {
+			t.Errorf("%d: validate() = %q, want %d errors", i, lines, len(c.errs))
+			continue
+		}
+		for j, want := range c.errs {
+			if !strings.HasPrefix(lines[j], want) {
+				t.Errorf("%d: error %d = %q, want %q", i, j, lines[j], want)
+			}
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	c, err := loadConfig(writeFile(t, dir, "valid.yaml", `
+listen:
+  - net: udp
+    addrs: [":1812"]
+  - net: udp
+    addrs: [":1813"]
+    role: accounting
+secret: testing123
+watch: 10s
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Secret != "testing123" || c.Watch != 10*time.Second || len(c.Listen) != 2 || c.Listen[1].Role != "accounting" {
+		t.Errorf("loadConfig() = %+v", c)
+	}
+
+	if c, err := loadConfig(writeFile(t, dir, "empty.yaml", "")); err != nil || !reflect.DeepEqual(c, new(config)) {
+		t.Errorf("empty file: loadConfig() = %+v, %v, want an empty configuration", c, err)
+	}
+
+	for name, content := range map[string]string{
+		"unknown.yaml": "secret: s\nsecrets: [a]\n",
+		"type.yaml":    "workers: many\n",
+		"syntax.yaml":  "listen: [\n",
+	} {
+		path := writeFile(t, dir, name, content)
+		if _, err := loadConfig(path); err == nil || !strings.HasPrefix(err.Error(), path+": ") {
+			t.Errorf("%s: loadConfig() error = %v, want an error naming the file", name, err)
+		}
+	}
+
+	if _, err := loadConfig(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("missing file: loadConfig() succeeded")
+	}
+}
+
+func TestFlags(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "go-radius.yaml", `
+listen:
+  - net: tcp
+secret: from-file
+dictionaries: [file.dict]
+users:
+  ldap:
+    url: ldap://localhost
+log:
+  level: warn
+  format: json
+`)
+
+	cases := []struct {
+		args  []string
+		check func(c *config) bool
+	}{
+		{[]string{"-config", path}, func(c *config) bool {
+			return c.Secret == "from-file" && c.Listen[0].Net == "tcp" && c.Users.LDAP != nil && c.Log.Level == "warn"
+		}},
+		{[]string{"-config", path, "-secret", "from-flag", "-log-level", "debug"}, func(c *config) bool {
+			return c.Secret == "from-flag" && c.Log.Level == "debug" && c.Log.Format == "json"
+		}},
+		{[]string{"-config", path, "-addr", ":1812,:1645"}, func(c *config) bool {
+			return reflect.DeepEqual(c.Listen, []listenConfig{{Net: "udp", Addrs: []string{":1812", ":1645"}}})
+		}},
+		{[]string{"-config", path, "-users", "users", "-dictionary", "a.dict,b.dict"}, func(c *config) bool {
+			return c.Users.File == "users" && c.Users.LDAP == nil &&
+				reflect.DeepEqual(c.Dictionaries, []string{"file.dict", "a.dict", "b.dict"})
+		}},
+		{[]string{"-secret", "s", "-metrics", ":9812", "-log-format", "text"}, func(c *config) bool {
+			return c.Secret == "s" && c.Metrics.Addr == ":9812" && c.Log.Format == "text" && len(c.Listen) == 0
+		}},
+		// Flags set to their default value still override the file.
+		{[]string{"-config", path, "-secret", ""}, func(c *config) bool {
+			return c.Secret == ""
+		}},
+	}
+
+	for _, c := range cases {
+		set := flag.NewFlagSet("go-radius", flag.ContinueOnError)
+		f := newFlags(set)
+		if err := set.Parse(c.args); err != nil {
+			t.Fatal(err)
+		}
+		config, err := f.load()
+		if err != nil {
+			t.Errorf("%q: %v", c.args, err)
+			continue
+		}
+		if !c.check(config) {
+			t.Errorf("%q: load() = %+v", c.args, config)
+		}
+	}
+
+	f := newFlags(flag.NewFlagSet("go-radius", flag.ContinueOnError))
+	*f.configFile = filepath.Join(t.TempDir(), "missing.yaml")
+	if _, err := f.load(); err == nil {
+		t.Error("load() of a missing file succeeded")
+	}
+}
+
+func TestServers(t *testing.T) {
+	cases := []struct {
+		listen  []listenConfig
+		servers int
+		err     string
+	}{
+		{nil, 2, ""},
+		{[]listenConfig{{Net: "udp", Addrs: []string{":1812", ":1813"}}}, 1, ""},
+		{[]listenConfig{{Net: "tcp", Addrs: []string{":1812", ":1813"}}, {Net: "tcp6"}}, 3, ""},
+		{[]listenConfig{{Net: "udp"}, {Net: "tls", Cert: "missing.pem", Key: "missing.key", ClientCA: "ca.pem"}}, 0,
+			"listen[1]: "},
+	}
+
+	for i, c := range cases {
+		config := &config{Listen: c.listen, Secret: "s"}
+		serve, err := config.servers(&reloader{}, &outputs{})
+		if c.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), c.err) {
+				t.Errorf("%d: servers() error = %v, want %q", i, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		if len(serve) != c.servers {
+			t.Errorf("%d: %d servers, want %d", i, len(serve), c.servers)
+		}
+	}
+}
@@ -1,13 +1,137 @@
+// Command go-radius is a RADIUS server configured by a YAML file and command-line flags, which override the
+// settings of the file.
+//
+// On SIGHUP, go-radius reads its configuration again and replaces its clients, secrets, users, policy and
+// dictionaries without closing its sockets. Requests being handled are answered with the previous configuration. If the new
+// configuration is invalid, the error is logged and the previous configuration is kept.
+//
+// Requests may first be checked against a policy file, written in the language of radius.Policy, which can reject
+// Access-Requests, add reply attributes, or authenticate users against one of the named backends of the
+// configuration.
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
-	"github.com/jmoles/radius/radius"
+	_ "github.com/mattn/go-sqlite3"
 )
 
+// flags holds the command-line flags of go-radius.
+type flags struct {
+	set *flag.FlagSet
+
+	configFile   *string
+	check        *bool
+	secret       *string
+	addrs        *string
+	users        *string
+	dictionaries *string
+	logLevel     *string
+	logFormat    *string
+	metrics      *string
+}
+
+// newFlags defines the flags of go-radius in set.
+func newFlags(set *flag.FlagSet) *flags {
+	return &flags{
+		set:          set,
+		configFile:   set.String("config", "", "read the configuration from `file`"),
+		check:        set.Bool("check", false, "check the configuration and exit"),
+		secret:       set.String("secret", "", "shared secret of clients without their own"),
+		addrs:        set.String("addr", "", "comma-separated UDP authentication `addresses` to listen on, replacing the configured listeners"),
+		users:        set.String("users", "", "authenticate against the users in `file`"),
+		dictionaries: set.String("dictionary", "", "comma-separated dictionary `files` to load"),
+		logLevel:     set.String("log-level", "", "log requests from `level` debug, info, warn or error"),
+		logFormat:    set.String("log-format", "", "log requests as text or json"),
+		metrics:      set.String("metrics", "", "serve Prometheus metrics on `address`"),
+	}
+}
+
+// load reads the configuration file, if any, and applies the flags set on the command line, which override its
+// settings.
+func (f *flags) load() (*config, error) {
+	c := new(config)
+	if *f.configFile != "" {
+		var err error
+		if c, err = loadConfig(*f.configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	f.set.Visit(func(visited *flag.Flag) {
+		switch visited.Name {
+		case "secret":
+			c.Secret = *f.secret
+		case "addr":
+			c.Listen = []listenConfig{{Net: "udp", Addrs: strings.Split(*f.addrs, ",")}}
+		case "users":
+			c.Users = usersConfig{File: *f.users}
+		case "dictionary":
+			c.Dictionaries = append(c.Dictionaries, strings.Split(*f.dictionaries, ",")...)
+		case "log-level":
+			c.Log.Level = *f.logLevel
+		case "log-format":
+			c.Log.Format = *f.logFormat
+		case "metrics":
+			c.Metrics.Addr = *f.metrics
+		}
+	})
+	return c, nil
+}
+
 func main() {
-	s := new(radius.Server)
-	s.Secret = "testsecret"
-	log.Fatal(s.ListenAndServe())
+	f := newFlags(flag.CommandLine)
+	flag.Parse()
+
+	c, err := f.load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := c.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "go-radius: invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	s, err := newService(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+	o, err := newOutputs(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer o.close()
+
+	r := &reloader{config: c, configFile: *f.configFile, load: f.load}
+	r.swap(s, c)
+	serve, err := c.servers(r, o)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *f.check {
+		fmt.Println("go-radius: configuration OK")
+		return
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go r.run(hup)
+
+	errs := make(chan error, len(serve)+1)
+	if o.metrics != nil {
+		go func() {
+			errs <- o.metrics.ListenAndServe(c.Metrics.Addr)
+		}()
+	}
+	for _, f := range serve {
+		go func(f func() error) {
+			errs <- f()
+		}(f)
+	}
+	log.Fatal(<-errs)
 }
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/x509"
+	"log"
+	"net"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/jmoles/radius/radius"
+)
+
+// reloader serves requests with the current service, which reloads replace without stopping the servers. It is
+// the Handler and the ClientStore of every server.
+type reloader struct {
+	mu      sync.RWMutex
+	current *service
+
+	// config is the configuration of the current service, and load reads the configuration again from
+	// configFile, if set, and the command-line flags.
+	config     *config
+	configFile string
+	load       func() (*config, error)
+}
+
+// swap makes s the current service. The previous one is closed once the requests it is handling are answered.
+func (r *reloader) swap(s *service, c *config) {
+	r.mu.Lock()
+	previous := r.current
+	r.current, r.config = s, c
+	r.mu.Unlock()
+
+	if previous != nil {
+		go func() {
+			previous.requests.Wait()
+			previous.close()
+		}()
+	}
+}
+
+// service returns the current service.
+func (r *reloader) service() *service {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current
+}
+
+// ServeRADIUS answers req with the handler of the current service, which stays open until the response is built.
+func (r *reloader) ServeRADIUS(req *radius.Request) *radius.Packet {
+	r.mu.RLock()
+	s := r.current
+	s.requests.Add(1)
+	r.mu.RUnlock()
+	defer s.requests.Done()
+
+	return s.handler.ServeRADIUS(req)
+}
+
+// defaultClient is the name of the client of every request when the configuration has no clients.
+const defaultClient = "default"
+
+// ClientByAddr returns the client of the current service sending from ip. Without clients, requests from any
+// address are answered with the secret of the configuration.
+func (r *reloader) ClientByAddr(ip net.IP) *radius.NASClient {
+	s := r.service()
+	if s.clients == nil {
+		return &radius.NASClient{Name: defaultClient, Secret: s.secret}
+	}
+	return s.clients.ClientByAddr(ip)
+}
+
+// ClientByCertificate returns the client of the current service presenting cert. Without clients, any verified
+// certificate is accepted.
+func (r *reloader) ClientByCertificate(cert *x509.Certificate) *radius.NASClient {
+	s := r.service()
+	if s.clients == nil {
+		return &radius.NASClient{Name: cert.Subject.CommonName}
+	}
+	return s.clients.ClientByCertificate(cert)
+}
+
+// reload reads the configuration again and swaps in the service it describes. If the configuration is invalid,
+// the current service is kept.
+func (r *reloader) reload() error {
+	c, err := r.load()
+	if err != nil {
+		return err
+	}
+	if err := c.validate(); err != nil {
+		return err
+	}
+	s, err := newService(c)
+	if err != nil {
+		return err
+	}
+
+	r.mu.RLock()
+	running := r.config
+	r.mu.RUnlock()
+	if !reflect.DeepEqual(c.Listen, running.Listen) || !reflect.DeepEqual(c.Log, running.Log) ||
+		c.Metrics != running.Metrics || c.Workers != running.Workers || c.QueueSize != running.QueueSize ||
+		c.DropPolicy != running.DropPolicy || c.MaxInFlight != running.MaxInFlight {
+		log.Println("go-radius: changes to the listen, log, metrics and worker settings are applied on restart")
+	}
+
+	r.swap(s, c)
+	return nil
+}
+
+// run reloads the configuration whenever hup receives, and when the files it is read from change if the
+// configuration sets Watch. It is the only caller of reload.
+func (r *reloader) run(hup <-chan os.Signal) {
+	for {
+		var ticker *time.Ticker
+		var tick <-chan time.Time
+		if r.config.Watch > 0 {
+			ticker = time.NewTicker(r.config.Watch)
+			tick = ticker.C
+		}
+		files := r.files()
+		modified := modTimes(files)
+
+		for changed := false; !changed; {
+			select {
+			case <-hup:
+				changed = true
+			case <-tick:
+				changed = !reflect.DeepEqual(modified, modTimes(files))
+			}
+		}
+		if ticker != nil {
+			ticker.Stop()
+		}
+
+		if err := r.reload(); err != nil {
+			log.Printf("go-radius: keeping the running configuration, reload failed: %v", err)
+			continue
+		}
+		log.Println("go-radius: configuration reloaded")
+	}
+}
+
+// files returns the files the current configuration is read from.
+func (r *reloader) files() []string {
+	var files []string
+	if r.configFile != "" {
+		files = append(files, r.configFile)
+	}
+	if r.config.Users.File != "" {
+		files = append(files, r.config.Users.File)
+	}
+	for _, backend := range r.config.Backends {
+		if backend.File != "" {
+			files = append(files, backend.File)
+		}
+	}
+	if r.config.Policy != "" {
+		files = append(files, r.config.Policy)
+	}
+	return append(files, r.config.Dictionaries...)
+}
+
+// modTimes returns the modification time of each file, or the zero time if it is missing.
+func modTimes(files []string) map[string]time.Time {
+	times := make(map[string]time.Time, len(files))
+	for _, name := range files {
+		if info, err := os.Stat(name); err == nil {
+			times[name] = info.ModTime()
+		}
+	}
+	return times
+}
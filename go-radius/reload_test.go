@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jmoles/radius/radius"
+)
+
+// testReloader returns a reloader serving the configuration file called path.
+func testReloader(t *testing.T, path string) *reloader {
+	set := flag.NewFlagSet("go-radius", flag.ContinueOnError)
+	f := newFlags(set)
+	if err := set.Parse([]string{"-config", path}); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := f.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := newService(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &reloader{configFile: path, load: f.load}
+	r.swap(s, c)
+	return r
+}
+
+func TestReloadInvalid(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "go-radius.yaml", "secret: one\n")
+	r := testReloader(t, path)
+	running := r.service()
+
+	for _, content := range []string{
+		"secret: [\n",
+		"secrets: two\n",
+		"secret: two\ndrop_policy: random\n",
+		"secret: two\nusers:\n  file: missing\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.reload(); err == nil {
+			t.Errorf("%q: reload() succeeded", content)
+		}
+		if s := r.service(); s != running || s.secret != "one" || r.config.Secret != "one" {
+			t.Errorf("%q: running service replaced", content)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("secret: two\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if s := r.service(); s == running || s.secret != "two" {
+		t.Error("valid configuration not swapped in")
+	}
+}
+
+func TestSwapWaitsForRequests(t *testing.T) {
+	handling, release, closed := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	previous := &service{
+		handler: radius.HandlerFunc(func(req *radius.Request) *radius.Packet {
+			close(handling)
+			<-release
+			return nil
+		}),
+		closers: []func(){func() { close(closed) }},
+	}
+	r := &reloader{}
+	r.swap(previous, &config{})
+
+	done := make(chan struct{})
+	go func() {
+		r.ServeRADIUS(&radius.Request{})
+		close(done)
+	}()
+	<-handling
+
+	next := &service{handler: radius.HandlerFunc(func(req *radius.Request) *radius.Packet { return nil })}
+	r.swap(next, &config{})
+	if r.service() != next {
+		t.Fatal("new service not current")
+	}
+
+	select {
+	case <-closed:
+		t.Fatal("previous service closed while handling a request")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	<-done
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("previous service not closed once its request was answered")
+	}
+}
+
+func TestRunWatch(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "go-radius.yaml", "secret: one\nwatch: 10ms\n")
+	r := testReloader(t, path)
+	go r.run(make(chan os.Signal))
+
+	// The file changes without a signal. Its modification time keeps moving forward until the change is seen, as
+	// run may not have recorded the previous one yet.
+	if err := os.WriteFile(path, []byte("secret: two\nwatch: 10ms\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for i, deadline := 1, time.Now().Add(2*time.Second); r.service().secret != "two"; i++ {
+		if time.Now().After(deadline) {
+			t.Fatal("configuration not reloaded after the file changed")
+		}
+		later := time.Now().Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(path, later, later); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
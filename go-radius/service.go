@@ -0,0 +1,418 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jmoles/radius/radius"
+	"gopkg.in/yaml.v3"
+)
+
+// service holds the parts of go-radius which are rebuilt when the configuration is reloaded: the clients and
+// the handler of requests, with the files, databases and connections it uses.
+type service struct {
+	clients radius.ClientStore
+	secret  string
+	handler radius.Handler
+
+	// closers release the files, databases and connections opened for the service.
+	closers []func()
+
+	// requests counts the requests being handled, which must end before the service is closed.
+	requests sync.WaitGroup
+}
+
+// newService builds the service described by c, which must be valid.
+func newService(c *config) (_ *service, err error) {
+	s := &service{secret: c.Secret}
+	defer func() {
+		if err != nil {
+			s.close()
+		}
+	}()
+
+	dictionary := radius.DefaultDictionary.Clone()
+	for _, name := range c.Dictionaries {
+		if err := dictionary.LoadFile(name); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.clients, err = c.clientStore(); err != nil {
+		return nil, err
+	}
+	if s.handler, err = c.handler(s, dictionary); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// close releases the resources of the service.
+func (s *service) close() {
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		s.closers[i]()
+	}
+	s.closers = nil
+}
+
+// outputs are the logs and metrics of go-radius, which are kept when the configuration is reloaded.
+type outputs struct {
+	logger  *slog.Logger
+	audit   *radius.AuditLog
+	metrics *radius.Metrics
+
+	closers []func()
+}
+
+// newOutputs opens the logs and metrics described by c, which must be valid.
+func newOutputs(c *config) (*outputs, error) {
+	o := new(outputs)
+
+	var w io.Writer = os.Stderr
+	if c.Log.File != "" {
+		file, err := os.OpenFile(c.Log.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, err
+		}
+		o.closers = append(o.closers, func() { file.Close() })
+		w = file
+	}
+
+	level, _ := parseLevel(c.Log.Level)
+	options := &slog.HandlerOptions{Level: level}
+	if c.Log.Format == "json" {
+		o.logger = slog.New(slog.NewJSONHandler(w, options))
+	} else {
+		o.logger = slog.New(slog.NewTextHandler(w, options))
+	}
+
+	if audit := c.Log.Audit; audit != nil {
+		rotation, _ := parseRotation(audit.Rotation)
+		o.audit = &radius.AuditLog{Path: audit.Path, Rotation: rotation}
+		o.closers = append(o.closers, func() { o.audit.Close() })
+	}
+	if c.Metrics.Addr != "" {
+		o.metrics = new(radius.Metrics)
+	}
+	return o, nil
+}
+
+// close closes the log files.
+func (o *outputs) close() {
+	for _, f := range o.closers {
+		f()
+	}
+}
+
+// clientStore returns the clients of the configuration, or nil if requests from any address are answered.
+func (c *config) clientStore() (radius.ClientStore, error) {
+	if len(c.Clients) == 0 {
+		return nil, nil
+	}
+
+	clients := make(radius.NASClients, 0, len(c.Clients))
+	for _, client := range c.Clients {
+		nas := &radius.NASClient{Name: client.Name, Secret: client.Secret, Identity: client.Identity}
+		if nas.Secret == "" {
+			nas.Secret = c.Secret
+		}
+		if client.Network != "" {
+			network, err := parseNetwork(client.Network)
+			if err != nil {
+				return nil, fmt.Errorf("client %s: %v", client.Name, err)
+			}
+			nas.Network = network
+		}
+		clients = append(clients, nas)
+	}
+	return clients, nil
+}
+
+// handler returns the handler of the requests of s: Access-Requests are authenticated against the users backend
+// and Accounting-Requests stored in the accounting backends, after the policy, if any, is evaluated.
+func (c *config) handler(s *service, dictionary *radius.Dictionary) (radius.Handler, error) {
+	mux := radius.NewServeMux()
+
+	users, err := c.Users.handler("users", s, dictionary)
+	if err != nil {
+		return nil, err
+	}
+	if users != nil {
+		mux.Handle(radius.AccessRequest, users)
+	}
+
+	switch accounting := c.Accounting; {
+	case accounting.SQL != nil:
+		db, err := accounting.SQL.open(s)
+		if err != nil {
+			return nil, err
+		}
+		mux.Handle(radius.AccountingRequest, radius.AccountingHandler{Store: radius.NewSQLAccounting(db)})
+
+	case accounting.Detail != nil:
+		// The detail file is the only record of Accounting-Requests, which are acknowledged once written.
+		mux.HandleFunc(radius.AccountingRequest, func(req *radius.Request) *radius.Packet {
+			return req.Response(radius.AccountingResponse)
+		})
+	}
+
+	var handler radius.Handler = mux
+	if c.Policy != "" {
+		policy, err := radius.LoadPolicy(c.Policy, dictionary)
+		if err != nil {
+			return nil, err
+		}
+		backends := make(map[string]radius.Handler, len(c.Backends))
+		for name, backend := range c.Backends {
+			if backends[name], err = backend.handler("backends."+name, s, dictionary); err != nil {
+				return nil, err
+			}
+		}
+		if handler, err = policy.Handler(mux, backends); err != nil {
+			return nil, err
+		}
+	}
+
+	detail := c.Accounting.Detail
+	if detail == nil {
+		return handler, nil
+	}
+	if info, err := os.Stat(detail.Directory); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("accounting.detail: %s is not a directory", detail.Directory)
+	}
+	rotation, _ := parseRotation(detail.Rotation)
+	writer := &radius.DetailWriter{Directory: detail.Directory, Rotation: rotation, Auth: detail.Auth, Dictionary: dictionary}
+	s.closers = append(s.closers, func() { writer.Close() })
+	return writer.Handler(handler), nil
+}
+
+// handler returns the handler authenticating Access-Requests against the users backend u, configured by the
+// setting name, or nil if u sets none.
+func (u *usersConfig) handler(name string, s *service, dictionary *radius.Dictionary) (radius.Handler, error) {
+	switch {
+	case u.File != "":
+		store, err := loadUsers(u.File)
+		if err != nil {
+			return nil, err
+		}
+		return radius.AuthenticationHandler{Users: store}, nil
+
+	case u.LDAP != nil:
+		backend, err := u.LDAP.backend(name, dictionary)
+		if err != nil {
+			return nil, err
+		}
+		s.closers = append(s.closers, backend.Close)
+		return backend, nil
+
+	case u.SQL != nil:
+		db, err := u.SQL.open(s)
+		if err != nil {
+			return nil, err
+		}
+		backend := radius.NewSQLBackend(db)
+		backend.Dictionary = dictionary
+		return backend, nil
+	}
+	return nil, nil
+}
+
+// loadUsers reads a YAML file mapping user names to their stored password.
+func loadUsers(name string) (radius.Users, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var users radius.Users
+	if err := yaml.Unmarshal(b, &users); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if users == nil {
+		users = radius.Users{}
+	}
+	return users, nil
+}
+
+// open opens the database, closed with s.
+func (database *sqlConfig) open(s *service) (*sql.DB, error) {
+	db, err := sql.Open(database.Driver, database.DSN)
+	if err != nil {
+		return nil, err
+	}
+	s.closers = append(s.closers, func() { db.Close() })
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("%s database: %v", database.Driver, err)
+	}
+	return db, nil
+}
+
+// backend returns the LDAP backend of the users backend name, with reply items checked against dictionary.
+func (l *ldapConfig) backend(name string, dictionary *radius.Dictionary) (*radius.LDAPBackend, error) {
+	backend := &radius.LDAPBackend{
+		URL:            l.URL,
+		BindDN:         l.BindDN,
+		BindPassword:   l.BindPassword,
+		BaseDN:         l.BaseDN,
+		Filter:         l.Filter,
+		GroupAttribute: l.GroupAttribute,
+		GroupBaseDN:    l.GroupBaseDN,
+		GroupFilter:    l.GroupFilter,
+		Timeout:        l.Timeout,
+		Dictionary:     dictionary,
+	}
+
+	var err error
+	if backend.Reply, err = replyPairs(l.Reply, dictionary); err != nil {
+		return nil, fmt.Errorf("%s.ldap.reply: %v", name, err)
+	}
+	if len(l.Groups) > 0 {
+		backend.Groups = make(map[string]radius.Pairs, len(l.Groups))
+	}
+	for group, reply := range l.Groups {
+		if backend.Groups[group], err = replyPairs(reply, dictionary); err != nil {
+			return nil, fmt.Errorf("%s.ldap.groups.%s: %v", name, group, err)
+		}
+	}
+	return backend, nil
+}
+
+// replyPairs returns the reply items set by attributes, sorted by name, checking that dictionary can encode them.
+func replyPairs(attributes map[string]string, dictionary *radius.Dictionary) (radius.Pairs, error) {
+	var pairs radius.Pairs
+	for name, value := range attributes {
+		if _, _, err := dictionary.Encode(name, value); err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, radius.Pair{Attribute: name, Op: radius.OpEqual, Value: value})
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Attribute < pairs[j].Attribute })
+	return pairs, nil
+}
+
+// tlsConfig returns the TLS configuration of a TLS or DTLS listener.
+func (l *listenConfig) tlsConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(l.Cert, l.Key)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	b, err := os.ReadFile(l.ClientCA)
+	if err != nil {
+		return nil, err
+	}
+	config.ClientCAs = x509.NewCertPool()
+	if !config.ClientCAs.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("%s: no certificate found", l.ClientCA)
+	}
+	return config, nil
+}
+
+// servers returns a function serving each socket of the configuration, with the clients and handler of r and
+// the logs and metrics of o.
+func (c *config) servers(r *reloader, o *outputs) ([]func() error, error) {
+	listen := c.Listen
+	if len(listen) == 0 {
+		listen = []listenConfig{{Net: "udp", Addrs: []string{":1812"}}, {Net: "udp", Addrs: []string{":1813"}, Role: "accounting"}}
+	}
+
+	newServer := func(l listenConfig) *radius.Server {
+		srv := &radius.Server{
+			Net:         l.Net,
+			Clients:     r,
+			Handler:     r,
+			Logger:      o.logger,
+			AuditLog:    o.audit,
+			Metrics:     o.metrics,
+			Workers:     c.Workers,
+			QueueSize:   c.QueueSize,
+			MaxInFlight: c.MaxInFlight,
+			IdleTimeout: l.IdleTimeout,
+		}
+		if c.DropPolicy == "oldest" {
+			srv.DropPolicy = radius.DropOldest
+		}
+		if l.Role == "accounting" {
+			srv.Role = radius.RoleAccounting
+		}
+		return srv
+	}
+
+	var serve []func() error
+	for i, l := range listen {
+		switch {
+		case l.Net == "" || strings.HasPrefix(l.Net, "udp"):
+			srv := newServer(l)
+			srv.Addrs, srv.Readers, srv.ReusePort = l.Addrs, l.Readers, l.ReusePort
+			serve = append(serve, srv.ListenAndServe)
+
+		case strings.HasPrefix(l.Net, "tcp"):
+			for _, addr := range addrsOrDefault(l.Addrs, ":1812") {
+				srv := newServer(l)
+				srv.Addr = addr
+				serve = append(serve, srv.ListenAndServe)
+			}
+
+		case l.Net == "tls" || l.Net == "dtls":
+			config, err := l.tlsConfig()
+			if err != nil {
+				return nil, fmt.Errorf("listen[%d]: %v", i, err)
+			}
+			for _, addr := range addrsOrDefault(l.Addrs, ":"+radius.RadSecPort) {
+				srv := newServer(l)
+				srv.Net, srv.Addr, srv.TLSConfig = "", addr, config
+				if l.Net == "tls" {
+					serve = append(serve, func() error { return srv.ListenAndServeTLS("", "") })
+				} else {
+					serve = append(serve, func() error { return srv.ListenAndServeDTLS("", "") })
+				}
+			}
+
+		default:
+			return nil, errors.New("unknown net " + l.Net)
+		}
+	}
+	return serve, nil
+}
+
+func addrsOrDefault(addrs []string, addr string) []string {
+	if len(addrs) == 0 {
+		return []string{addr}
+	}
+	return addrs
+}
+
+// parseRotation parses the rotation period of a file.
+func parseRotation(s string) (radius.DetailRotation, error) {
+	switch s {
+	case "", "never":
+		return radius.RotateNever, nil
+	case "hourly":
+		return radius.RotateHourly, nil
+	case "daily":
+		return radius.RotateDaily, nil
+	}
+	return 0, fmt.Errorf("rotation %q is not hourly, daily or never", s)
+}
+
+// parseLevel parses a log level.
+func parseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("level %q is not debug, info, warn or error", s)
+	}
+	return level, nil
+}
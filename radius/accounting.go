@@ -0,0 +1,216 @@
+package radius
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AcctStatus is the value of the Acct-Status-Type attribute from RFC 2866.
+type AcctStatus uint32
+
+// Accounting status types from RFC 2866.
+const (
+	AcctStart         AcctStatus = 1
+	AcctStop                     = 2
+	AcctInterimUpdate            = 3
+	AcctOn                       = 7
+	AcctOff                      = 8
+)
+
+var acctStatusText = map[AcctStatus]string{
+	AcctStart:         "Start",
+	AcctStop:          "Stop",
+	AcctInterimUpdate: "Interim-Update",
+	AcctOn:            "Accounting-On",
+	AcctOff:           "Accounting-Off",
+}
+
+func (s AcctStatus) String() string {
+	return acctStatusText[s]
+}
+
+// AccountingRecord is the information carried by an Accounting-Request.
+type AccountingRecord struct {
+	Status AcctStatus
+
+	SessionID string
+	// UniqueID identifies the session across NASes, computed like the FreeRADIUS Acct-Unique-Session-Id.
+	UniqueID string
+	UserName string
+
+	// NASIPAddress is the NAS-IP-Address of the request, or its source address if absent.
+	NASIPAddress     net.IP
+	NASIdentifier    string
+	NASPort          uint32
+	NASPortID        string
+	FramedIPAddress  net.IP
+	CalledStationID  string
+	CallingStationID string
+
+	// SessionTime is the Acct-Session-Time of the request, valid if HasSessionTime is set.
+	SessionTime    time.Duration
+	HasSessionTime bool
+
+	// InputOctets and OutputOctets include the Acct-Input-Gigawords and Acct-Output-Gigawords.
+	InputOctets   uint64
+	OutputOctets  uint64
+	InputPackets  uint32
+	OutputPackets uint32
+
+	TerminateCause string
+
+	// Time is when the event happened: the Event-Timestamp of the request, or when it was received less
+	// its Acct-Delay-Time.
+	Time time.Time
+}
+
+// NewAccountingRecord extracts the accounting information of req, received at the given time.
+func NewAccountingRecord(req *Request, received time.Time) *AccountingRecord {
+	text := func(key Attribute) string {
+		value, _ := req.attribute(key)
+		return string(value)
+	}
+
+	record := &AccountingRecord{
+		SessionID:        text(AcctSessionID),
+		UserName:         text(UserName),
+		NASIdentifier:    text(NASIdentifier),
+		NASPortID:        text(NASPortID),
+		CalledStationID:  text(CalledStationID),
+		CallingStationID: text(CallingStationID),
+	}
+
+	status, _ := uint32Value(req.attribute(AcctStatusType))
+	record.Status = AcctStatus(status)
+
+	if ip, _ := req.attribute(NASIPAddress); len(ip) == net.IPv4len {
+		record.NASIPAddress = append(net.IP(nil), ip...)
+	} else {
+		record.NASIPAddress = hostIP(req.RemoteAddr)
+	}
+	if ip, _ := req.attribute(FramedIPAddress); len(ip) == net.IPv4len {
+		record.FramedIPAddress = append(net.IP(nil), ip...)
+	}
+	record.NASPort, _ = uint32Value(req.attribute(NASPort))
+
+	if seconds, ok := uint32Value(req.attribute(AcctSessionTime)); ok {
+		record.SessionTime = time.Duration(seconds) * time.Second
+		record.HasSessionTime = true
+	}
+
+	octets, _ := uint32Value(req.attribute(AcctInputOctets))
+	gigawords, _ := uint32Value(req.attribute(AcctInputGigawords))
+	record.InputOctets = uint64(gigawords)<<32 | uint64(octets)
+	octets, _ = uint32Value(req.attribute(AcctOutputOctets))
+	gigawords, _ = uint32Value(req.attribute(AcctOutputGigawords))
+	record.OutputOctets = uint64(gigawords)<<32 | uint64(octets)
+	record.InputPackets, _ = uint32Value(req.attribute(AcctInputPackets))
+	record.OutputPackets, _ = uint32Value(req.attribute(AcctOutputPackets))
+
+	if cause, ok := req.attribute(AcctTerminateCause); ok {
+		def, _ := DefaultDictionary.Definition(0, AcctTerminateCause)
+		record.TerminateCause, _ = def.Format(cause)
+	}
+
+	if timestamp, ok := uint32Value(req.attribute(EventTimestamp)); ok {
+		record.Time = time.Unix(int64(timestamp), 0)
+	} else {
+		delay, _ := uint32Value(req.attribute(AcctDelayTime))
+		record.Time = received.Add(-time.Duration(delay) * time.Second)
+	}
+	record.Time = record.Time.UTC()
+
+	record.UniqueID = record.uniqueID()
+
+	return record
+}
+
+// uniqueID hashes the attributes identifying a session the way FreeRADIUS builds Acct-Unique-Session-Id.
+func (record *AccountingRecord) uniqueID() string {
+	var nasIP string
+	if record.NASIPAddress != nil {
+		nasIP = record.NASIPAddress.String()
+	}
+
+	sum := md5.Sum([]byte(strings.Join([]string{
+		record.UserName,
+		record.SessionID,
+		nasIP,
+		record.NASIdentifier,
+		record.NASPortID,
+		strconv.FormatUint(uint64(record.NASPort), 10),
+	}, ",")))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Started returns when the session began, from the event time and the session time.
+func (record *AccountingRecord) Started() time.Time {
+	return record.Time.Add(-record.SessionTime)
+}
+
+// uint32Value returns the integer value of an attribute, as returned with ok by Lookup. ok is false if the
+// attribute is missing or not 4 octets long.
+func uint32Value(value []byte, ok bool) (uint32, bool) {
+	if !ok || len(value) != 4 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(value), true
+}
+
+// VerifyAccountingRequest checks the Request Authenticator of an Accounting-Request as described in RFC 2866 section 3.
+func VerifyAccountingRequest(packet Packet, secret string) bool {
+	md5Buff := new(bytes.Buffer)
+
+	md5Buff.WriteByte(uint8(packet.Code))
+	md5Buff.WriteByte(uint8(packet.Identifier))
+	binary.Write(md5Buff, binary.BigEndian, uint16(packet.Length))
+	md5Buff.Write(make([]byte, 16))
+	md5Buff.Write(packet.Attributes)
+	md5Buff.WriteString(secret)
+
+	return md5.Sum(md5Buff.Bytes()) == packet.Authenticator
+}
+
+// SignAccountingRequest sets the Request Authenticator of an Accounting-Request as described in RFC 2866 section 3.
+func SignAccountingRequest(packet *Packet, secret string) {
+	packet.Authenticator = [16]byte{}
+	packet.Authenticator = md5.Sum(append(packet.packetToBytes(), secret...))
+}
+
+// AccountingStore records accounting information. Account must be idempotent, as NASes retransmit requests
+// whose response was lost.
+type AccountingStore interface {
+	Account(record *AccountingRecord) error
+}
+
+// AccountingHandler stores Accounting-Requests and acknowledges them with an Accounting-Response. Requests with
+// an invalid authenticator or which could not be stored get no response, so that the NAS retransmits them.
+type AccountingHandler struct {
+	Store AccountingStore
+}
+
+// ServeRADIUS stores an Accounting-Request.
+func (h AccountingHandler) ServeRADIUS(req *Request) *Packet {
+	if req.Packet.Code != AccountingRequest {
+		return nil
+	}
+	if !VerifyAccountingRequest(req.Packet, req.Secret) {
+		log.Printf("radius: dropping Accounting-Request from %v with invalid authenticator", req.RemoteAddr)
+		return nil
+	}
+
+	if err := h.Store.Account(NewAccountingRecord(req, time.Now())); err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	return req.Response(AccountingResponse)
+}
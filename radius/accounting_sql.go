@@ -0,0 +1,178 @@
+package radius
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SQLAccountingQueries are the statements run by SQLAccounting, modelled on the FreeRADIUS radacct table.
+// Arguments are passed in the order documented for each statement, using "?" placeholders by default.
+type SQLAccountingQueries struct {
+	// Start inserts a session unless one with the same unique id exists. Arguments: unique id, session id,
+	// user name, NAS IP address, NAS port id, start time, called station id, calling station id, framed IP address.
+	Start string
+	// Update sets the counters of an open session unless a later update was stored. Arguments: update time,
+	// session time, input octets, output octets, unique id, update time.
+	Update string
+	// Stop closes an open session. Arguments: stop time, session time, input octets, output octets,
+	// terminate cause, unique id.
+	Stop string
+	// Close closes an open session without changing its counters. Arguments: stop time, session time,
+	// terminate cause, unique id.
+	Close string
+	// StartTime returns the start time of a session. Arguments: unique id.
+	StartTime string
+	// OpenSessions returns the unique id and start time of every open session of a NAS. Arguments: NAS IP address.
+	OpenSessions string
+}
+
+// DefaultSQLAccountingQueries work with SQLite. PostgreSQL drivers such as lib/pq and pgx only accept $1, $2, ...
+// placeholders, so the queries must be rewritten for them.
+var DefaultSQLAccountingQueries = SQLAccountingQueries{
+	Start: `INSERT INTO radacct (acctuniqueid, acctsessionid, username, nasipaddress, nasportid, acctstarttime,
+		calledstationid, callingstationid, framedipaddress, acctsessiontime, acctinputoctets, acctoutputoctets)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 0, 0, 0) ON CONFLICT (acctuniqueid) DO NOTHING`,
+	Update: `UPDATE radacct SET acctupdatetime = ?, acctsessiontime = ?, acctinputoctets = ?, acctoutputoctets = ?
+		WHERE acctuniqueid = ? AND acctstoptime IS NULL AND (acctupdatetime IS NULL OR acctupdatetime <= ?)`,
+	Stop: `UPDATE radacct SET acctstoptime = ?, acctsessiontime = ?, acctinputoctets = ?, acctoutputoctets = ?,
+		acctterminatecause = ? WHERE acctuniqueid = ? AND acctstoptime IS NULL`,
+	Close: `UPDATE radacct SET acctstoptime = ?, acctsessiontime = ?, acctterminatecause = ?
+		WHERE acctuniqueid = ? AND acctstoptime IS NULL`,
+	StartTime:    `SELECT acctstarttime FROM radacct WHERE acctuniqueid = ?`,
+	OpenSessions: `SELECT acctuniqueid, acctstarttime FROM radacct WHERE nasipaddress = ? AND acctstoptime IS NULL`,
+}
+
+// SQLAccounting is an AccountingStore keeping one row per session in a database.
+type SQLAccounting struct {
+	DB      *sql.DB
+	Queries SQLAccountingQueries
+}
+
+// NewSQLAccounting returns an SQLAccounting writing to db with DefaultSQLAccountingQueries.
+func NewSQLAccounting(db *sql.DB) *SQLAccounting {
+	return &SQLAccounting{DB: db, Queries: DefaultSQLAccountingQueries}
+}
+
+// Account stores record. Start opens a session, Interim-Update updates its counters and Stop closes it, opening
+// the session first if its Start was lost. Accounting-On and Accounting-Off close every open session of the NAS.
+// Retransmitted records leave the stored sessions unchanged.
+func (a *SQLAccounting) Account(record *AccountingRecord) error {
+	switch record.Status {
+	case AcctStart:
+		return a.start(record)
+	case AcctInterimUpdate:
+		return a.update(record)
+	case AcctStop:
+		return a.stop(record)
+	case AcctOn, AcctOff:
+		return a.closeNAS(record)
+	}
+
+	return fmt.Errorf("radius: unsupported Acct-Status-Type %d", record.Status)
+}
+
+func (a *SQLAccounting) start(record *AccountingRecord) error {
+	var nasIP, framedIP interface{}
+	if record.NASIPAddress != nil {
+		nasIP = record.NASIPAddress.String()
+	}
+	if record.FramedIPAddress != nil {
+		framedIP = record.FramedIPAddress.String()
+	}
+
+	_, err := a.DB.Exec(a.Queries.Start, record.UniqueID, record.SessionID, record.UserName, nasIP, record.NASPortID,
+		record.Started(), record.CalledStationID, record.CallingStationID, framedIP)
+	return err
+}
+
+// sessionTime returns the session time of record, computing it from the stored start time if the NAS did not send it.
+func (a *SQLAccounting) sessionTime(record *AccountingRecord) (int64, error) {
+	if record.HasSessionTime {
+		return int64(record.SessionTime / time.Second), nil
+	}
+
+	var started time.Time
+	err := a.DB.QueryRow(a.Queries.StartTime, record.UniqueID).Scan(&started)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(record.Time.Sub(started) / time.Second), nil
+}
+
+func (a *SQLAccounting) update(record *AccountingRecord) error {
+	// Inserting first is harmless if the session exists, and recovers sessions whose Start was lost.
+	if err := a.start(record); err != nil {
+		return err
+	}
+
+	sessionTime, err := a.sessionTime(record)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.DB.Exec(a.Queries.Update, record.Time, sessionTime, int64(record.InputOctets), int64(record.OutputOctets),
+		record.UniqueID, record.Time)
+	return err
+}
+
+func (a *SQLAccounting) stop(record *AccountingRecord) error {
+	if err := a.start(record); err != nil {
+		return err
+	}
+
+	sessionTime, err := a.sessionTime(record)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.DB.Exec(a.Queries.Stop, record.Time, sessionTime, int64(record.InputOctets), int64(record.OutputOctets),
+		record.TerminateCause, record.UniqueID)
+	return err
+}
+
+// closeNAS closes the open sessions of the NAS that sent record, which has restarted.
+func (a *SQLAccounting) closeNAS(record *AccountingRecord) error {
+	if record.NASIPAddress == nil {
+		return fmt.Errorf("radius: %s without NAS address", record.Status)
+	}
+
+	rows, err := a.DB.Query(a.Queries.OpenSessions, record.NASIPAddress.String())
+	if err != nil {
+		return err
+	}
+
+	type session struct {
+		uniqueID string
+		started  time.Time
+	}
+	var sessions []session
+	for rows.Next() {
+		var s session
+		if err := rows.Scan(&s.uniqueID, &s.started); err != nil {
+			rows.Close()
+			return err
+		}
+		sessions = append(sessions, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, s := range sessions {
+		sessionTime := int64(record.Time.Sub(s.started) / time.Second)
+		if sessionTime < 0 {
+			sessionTime = 0
+		}
+		if _, err := a.DB.Exec(a.Queries.Close, record.Time, sessionTime, "NAS-Reboot", s.uniqueID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package radius
+
+import (
+	"database/sql"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const radacctSchema = `
+CREATE TABLE radacct (
+	radacctid INTEGER PRIMARY KEY,
+	acctsessionid TEXT, acctuniqueid TEXT UNIQUE, username TEXT,
+	nasipaddress TEXT, nasportid TEXT,
+	acctstarttime DATETIME, acctupdatetime DATETIME, acctstoptime DATETIME,
+	acctsessiontime INTEGER, acctinputoctets INTEGER, acctoutputoctets INTEGER,
+	calledstationid TEXT, callingstationid TEXT, acctterminatecause TEXT, framedipaddress TEXT
+);
+`
+
+// buildAccountingRequest returns a signed Accounting-Request carrying the given attributes.
+func buildAccountingRequest(ident int, pairs Pairs) *Request {
+	p := Packet{Code: AccountingRequest, Identifier: ident}
+	if err := DefaultDictionary.AddPairs(&p, pairs); err != nil {
+		panic(err)
+	}
+
+	SignAccountingRequest(&p, secret)
+
+	return &Request{Packet: p, Secret: secret, RemoteAddr: &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1813}}
+}
+
+func TestVerifyAccountingRequest(t *testing.T) {
+	req := buildAccountingRequest(1, Pairs{{"Acct-Status-Type", OpSet, "Start"}})
+
+	if !VerifyAccountingRequest(req.Packet, secret) {
+		t.Errorf("VerifyAccountingRequest with the right secret == false, want true")
+	}
+	if VerifyAccountingRequest(req.Packet, "other") {
+		t.Errorf("VerifyAccountingRequest with the wrong secret == true, want false")
+	}
+}
+
+func TestSQLAccounting(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(radacctSchema); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := AccountingHandler{Store: NewSQLAccounting(db)}
+	start := time.Now().Add(-time.Hour).Unix()
+	at := func(offset int64) string {
+		return strconv.FormatInt(start+offset, 10)
+	}
+
+	session := func(id string, status string, extra ...Pair) Pairs {
+		return append(Pairs{
+			{"Acct-Status-Type", OpSet, status},
+			{"Acct-Session-Id", OpSet, id},
+			{"User-Name", OpSet, "alice"},
+			{"NAS-IP-Address", OpSet, "10.0.0.1"},
+		}, extra...)
+	}
+
+	requests := []Pairs{
+		// Session 1 starts, is updated twice with a retransmission, and stops past 4 GiB of input.
+		session("s1", "Start", Pair{"Event-Timestamp", OpSet, at(0)}),
+		session("s1", "Start", Pair{"Event-Timestamp", OpSet, at(0)}),
+		session("s1", "Interim-Update", Pair{"Event-Timestamp", OpSet, at(60)}, Pair{"Acct-Session-Time", OpSet, "60"},
+			Pair{"Acct-Input-Octets", OpSet, "100"}, Pair{"Acct-Output-Octets", OpSet, "200"}),
+		session("s1", "Interim-Update", Pair{"Event-Timestamp", OpSet, at(120)}, Pair{"Acct-Session-Time", OpSet, "120"},
+			Pair{"Acct-Input-Octets", OpSet, "300"}, Pair{"Acct-Output-Octets", OpSet, "400"}),
+		session("s1", "Interim-Update", Pair{"Event-Timestamp", OpSet, at(60)}, Pair{"Acct-Session-Time", OpSet, "60"},
+			Pair{"Acct-Input-Octets", OpSet, "100"}, Pair{"Acct-Output-Octets", OpSet, "200"}),
+		session("s1", "Stop", Pair{"Event-Timestamp", OpSet, at(300)}, Pair{"Acct-Input-Octets", OpSet, "5"},
+			Pair{"Acct-Input-Gigawords", OpSet, "1"}, Pair{"Acct-Output-Octets", OpSet, "600"},
+			Pair{"Acct-Terminate-Cause", OpSet, "User-Request"}),
+		session("s1", "Stop", Pair{"Event-Timestamp", OpSet, at(300)}, Pair{"Acct-Input-Octets", OpSet, "5"},
+			Pair{"Acct-Input-Gigawords", OpSet, "1"}, Pair{"Acct-Output-Octets", OpSet, "600"},
+			Pair{"Acct-Terminate-Cause", OpSet, "User-Request"}),
+		// Session 2 is open when the NAS reboots, session 3 only sends a Stop.
+		session("s2", "Start", Pair{"Event-Timestamp", OpSet, at(100)}),
+		session("s3", "Stop", Pair{"Event-Timestamp", OpSet, at(200)}, Pair{"Acct-Session-Time", OpSet, "50"}),
+		{{"Acct-Status-Type", OpSet, "Accounting-On"}, {"NAS-IP-Address", OpSet, "10.0.0.1"}, {"Event-Timestamp", OpSet, at(400)}},
+	}
+
+	for i, pairs := range requests {
+		req := buildAccountingRequest(i, pairs)
+		if got := handler.ServeRADIUS(req); got == nil || got.Code != AccountingResponse {
+			t.Fatalf("Request %d: ServeRADIUS(%v) == %v, want an Accounting-Response", i, pairs, got)
+		}
+	}
+
+	cases := []struct {
+		sessionID   string
+		sessionTime int64
+		input       int64
+		output      int64
+		cause       string
+	}{
+		{"s1", 300, 1<<32 + 5, 600, "User-Request"},
+		{"s2", 300, 0, 0, "NAS-Reboot"},
+		{"s3", 50, 0, 0, ""},
+	}
+
+	for test, c := range cases {
+		var sessionTime, input, output int64
+		var cause string
+		var stopped sql.NullTime
+		err := db.QueryRow(`SELECT acctsessiontime, acctinputoctets, acctoutputoctets, acctterminatecause, acctstoptime
+			FROM radacct WHERE acctsessionid = ?`, c.sessionID).Scan(&sessionTime, &input, &output, &cause, &stopped)
+		if err != nil {
+			t.Errorf("Test %d: session %s: %v", test, c.sessionID, err)
+			continue
+		}
+		if sessionTime != c.sessionTime || input != c.input || output != c.output || cause != c.cause || !stopped.Valid {
+			t.Errorf("Test %d: session %s == %d, %d, %d, %q, stopped %t, want %d, %d, %d, %q, stopped",
+				test, c.sessionID, sessionTime, input, output, cause, stopped.Valid, c.sessionTime, c.input, c.output, c.cause)
+		}
+	}
+
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM radacct").Scan(&count)
+	if count != 3 {
+		t.Errorf("radacct holds %d sessions, want 3", count)
+	}
+}
+
+func TestAccountingHandlerBadAuthenticator(t *testing.T) {
+	req := buildAccountingRequest(1, Pairs{{"Acct-Status-Type", OpSet, "Start"}})
+	req.Secret = "other"
+
+	if got := (AccountingHandler{Store: NewSQLAccounting(nil)}).ServeRADIUS(req); got != nil {
+		t.Errorf("ServeRADIUS with an invalid authenticator == %v, want no response", got)
+	}
+}
+
+func TestNewAccountingRecord(t *testing.T) {
+	received := time.Date(2024, 6, 3, 10, 0, 0, 0, time.UTC)
+	req := buildAccountingRequest(1, Pairs{
+		{"Acct-Status-Type", OpSet, "Stop"},
+		{"Acct-Session-Id", OpSet, "s1"},
+		{"User-Name", OpSet, "alice"},
+		{"Acct-Input-Octets", OpSet, "10"},
+		{"Acct-Input-Gigawords", OpSet, "1"},
+		{"Acct-Delay-Time", OpSet, "5"},
+		{"Acct-Terminate-Cause", OpSet, "User-Request"},
+	})
+	// A malformed trailing attribute is ignored.
+	req.Packet.Attributes = append(req.Packet.Attributes, 44, 0)
+	req.RemoteAddr = &net.TCPAddr{IP: net.IPv4(192, 0, 2, 7), Port: 2083}
+
+	record := NewAccountingRecord(req, received)
+	if record.Status != AcctStop || record.SessionID != "s1" || record.UserName != "alice" ||
+		record.InputOctets != 1<<32|10 || record.TerminateCause != "User-Request" ||
+		!record.Time.Equal(received.Add(-5*time.Second)) {
+		t.Errorf("NewAccountingRecord() = %+v", record)
+	}
+	// Without NAS-IP-Address, the NAS is the address the request came from, whatever the transport.
+	if !record.NASIPAddress.Equal(net.IPv4(192, 0, 2, 7)) {
+		t.Errorf("NASIPAddress = %v, want 192.0.2.7", record.NASIPAddress)
+	}
+}
@@ -6,7 +6,7 @@ type Attribute int
 // Attributes is the key-value pair of attributes in RFC2865.
 type Attributes map[Attribute][]byte
 
-// Radius attributes from RFC2865 and RFC2882.
+// Radius attributes from RFC2865, RFC2866, RFC2868, RFC2869, RFC2882 and RFC5176.
 const (
 	UserName     Attribute = 1
 	UserPassword           = 2
@@ -54,12 +54,40 @@ const (
 	FramedAppleTalkNetwork = 38
 	FramedAppleTalkZone    = 39
 
+	AcctStatusType      = 40
+	AcctDelayTime       = 41
+	AcctInputOctets     = 42
+	AcctOutputOctets    = 43
+	AcctSessionID       = 44
+	AcctAuthentic       = 45
+	AcctSessionTime     = 46
+	AcctInputPackets    = 47
+	AcctOutputPackets   = 48
+	AcctTerminateCause  = 49
+	AcctMultiSessionID  = 50
+	AcctLinkCount       = 51
+	AcctInputGigawords  = 52
+	AcctOutputGigawords = 53
+	EventTimestamp      = 55
+
 	CHAPChallenge = 60
 	NASPortType   = 61
 	PortLimit     = 62
 	LoginLATPort  = 63
 
+	TunnelType       = 64
+	TunnelMediumType = 65
+
+	TunnelPassword = 69
+
 	MessageAuthenticator = 80
+
+	TunnelPrivateGroupID = 81
+
+	AcctInterimInterval = 85
+	NASPortID           = 87
+
+	ErrorCause = 101
 )
 
 var attrText = map[Attribute]string{
@@ -109,12 +137,40 @@ var attrText = map[Attribute]string{
 	FramedAppleTalkNetwork: "Framed-AppleTalk-Network",
 	FramedAppleTalkZone:    "Framed-AppleTalk-Zone",
 
+	AcctStatusType:      "Acct-Status-Type",
+	AcctDelayTime:       "Acct-Delay-Time",
+	AcctInputOctets:     "Acct-Input-Octets",
+	AcctOutputOctets:    "Acct-Output-Octets",
+	AcctSessionID:       "Acct-Session-Id",
+	AcctAuthentic:       "Acct-Authentic",
+	AcctSessionTime:     "Acct-Session-Time",
+	AcctInputPackets:    "Acct-Input-Packets",
+	AcctOutputPackets:   "Acct-Output-Packets",
+	AcctTerminateCause:  "Acct-Terminate-Cause",
+	AcctMultiSessionID:  "Acct-Multi-Session-Id",
+	AcctLinkCount:       "Acct-Link-Count",
+	AcctInputGigawords:  "Acct-Input-Gigawords",
+	AcctOutputGigawords: "Acct-Output-Gigawords",
+	EventTimestamp:      "Event-Timestamp",
+
 	CHAPChallenge: "CHAP-Challenge",
 	NASPortType:   "NAS-Port-Type",
 	PortLimit:     "Port-Limit",
 	LoginLATPort:  "Login-LAT-Port",
 
+	TunnelType:       "Tunnel-Type",
+	TunnelMediumType: "Tunnel-Medium-Type",
+
+	TunnelPassword: "Tunnel-Password",
+
 	MessageAuthenticator: "Message-Authenticator",
+
+	TunnelPrivateGroupID: "Tunnel-Private-Group-Id",
+
+	AcctInterimInterval: "Acct-Interim-Interval",
+	NASPortID:           "NAS-Port-Id",
+
+	ErrorCause: "Error-Cause",
 }
 
 func (a Attribute) String() string {
@@ -0,0 +1,49 @@
+package radius
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// AuditLog records the outcome of every Access-Request received by a Server as JSON lines, one object per request
+// with its time, client, User-Name, Calling-Station-Id, NAS-IP-Address, outcome and reason. Passwords are never
+// recorded.
+type AuditLog struct {
+	// Path is the name of the audit file. With Rotation, the period is appended to it, as in "auth.log-20240131".
+	Path     string
+	Rotation DetailRotation
+
+	file rotatingFile
+
+	handlerOnce sync.Once
+	handler     slog.Handler
+}
+
+// Write appends b to the current audit file, starting a new one when the rotation period changes.
+func (a *AuditLog) Write(b []byte) (int, error) {
+	if err := a.file.write(a.Rotation.filename(a.Path, time.Now()), b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close closes the current audit file.
+func (a *AuditLog) Close() error {
+	return a.file.close()
+}
+
+// record appends an entry with attrs to the audit file.
+func (a *AuditLog) record(level slog.Level, attrs []slog.Attr) {
+	a.handlerOnce.Do(func() {
+		a.handler = slog.NewJSONHandler(a, nil)
+	})
+
+	record := slog.NewRecord(time.Now(), level, "authentication", 0)
+	record.AddAttrs(attrs...)
+	if err := a.handler.Handle(context.Background(), record); err != nil {
+		log.Println(err)
+	}
+}
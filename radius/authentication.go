@@ -1,5 +1,31 @@
 package radius
 
+import (
+	"errors"
+	"log"
+	"strings"
+)
+
+// ErrUnknownUser is returned by a UserStore that has no entry for a user.
+var ErrUnknownUser = errors.New("radius: unknown user")
+
+// UserStore looks up the stored Credential of a user.
+type UserStore interface {
+	Credential(user string) (Credential, error)
+}
+
+// Users is a UserStore holding credentials in memory, keyed by user name.
+type Users map[string]Credential
+
+// Credential returns the stored credential for user or ErrUnknownUser.
+func (u Users) Credential(user string) (Credential, error) {
+	c, ok := u[user]
+	if !ok {
+		return "", ErrUnknownUser
+	}
+	return c, nil
+}
+
 // Authenticate determines if a user is allowed access or not.
 // TODO: Complete this function.
 func Authenticate(user string, password string) (authenticated bool) {
@@ -10,3 +36,104 @@ func Authenticate(user string, password string) (authenticated bool) {
 	return false
 
 }
+
+// AuthenticatePAP verifies a cleartext password received with PAP against the credential in store.
+func AuthenticatePAP(store UserStore, user string, password string) (authenticated bool, err error) {
+	credential, err := store.Credential(user)
+	if err == ErrUnknownUser {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return credential.Verify(password)
+}
+
+// AuthenticateRequest verifies the PAP or CHAP password of req against the credential in store.
+func AuthenticateRequest(store UserStore, req *Request) (authenticated bool, err error) {
+	credential, err := store.Credential(req.UserName())
+	if err == ErrUnknownUser {
+		req.Reason = ReasonUnknownUser
+		return false, nil
+	}
+	if err != nil {
+		req.Reason = err.Error()
+		return false, err
+	}
+
+	return verifyRequest(req, credential)
+}
+
+// verifyRequest verifies the password of req against credential, setting the reason of failures.
+func verifyRequest(req *Request, credential Credential) (bool, error) {
+	authenticated, err := req.Verify(credential)
+	switch {
+	case err == ErrUnsupportedAuthType:
+		req.Reason = ReasonUnsupportedAuthType
+	case err != nil:
+		req.Reason = err.Error()
+	case !authenticated:
+		req.Reason = ReasonInvalidPassword
+	}
+	return authenticated, err
+}
+
+// AuthenticationHandler answers Access-Requests with an Access-Accept if their password matches the credential
+// of the user in Users, and with an Access-Reject otherwise.
+type AuthenticationHandler struct {
+	Users UserStore
+}
+
+// ServeRADIUS authenticates an Access-Request.
+func (h AuthenticationHandler) ServeRADIUS(req *Request) *Packet {
+	if req.Packet.Code != AccessRequest {
+		return nil
+	}
+
+	authenticated, err := AuthenticateRequest(h.Users, req)
+	if err != nil {
+		log.Println(err)
+	}
+	if authenticated {
+		return req.Response(AccessAccept)
+	}
+	return req.Response(AccessReject)
+}
+
+// AcceptWithPairs decides an authorized request from its control items and builds the response. Auth-Type
+// forces the outcome to Accept or Reject, otherwise the request's password must match the stored credential.
+// An Access-Accept carries the reply items encoded with dictionary.
+func AcceptWithPairs(req *Request, control Pairs, reply Pairs, dictionary *Dictionary) *Packet {
+	authType, _ := control.Lookup(AuthTypeAttribute)
+
+	switch {
+	case strings.EqualFold(authType, "Reject"):
+		req.Reason = ReasonAuthTypeReject
+		return req.Response(AccessReject)
+
+	case strings.EqualFold(authType, "Accept"):
+
+	default:
+		credential, ok := control.Credential()
+		if !ok {
+			req.Reason = ReasonNoCredential
+			return req.Response(AccessReject)
+		}
+		authenticated, err := verifyRequest(req, credential)
+		if err != nil {
+			log.Println(err)
+		}
+		if !authenticated {
+			return req.Response(AccessReject)
+		}
+	}
+
+	response := req.Response(AccessAccept)
+	if err := dictionary.AddPairs(response, reply); err != nil {
+		log.Println(err)
+		return req.Response(AccessReject)
+	}
+
+	return response
+}
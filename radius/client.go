@@ -0,0 +1,320 @@
+package radius
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrTimeout is returned by a Client when a server did not answer any transmission of a request.
+var ErrTimeout = errors.New("radius: no response from server")
+
+// ErrNoIdentifier is returned by a Client when all 256 Identifiers towards a server are in use.
+var ErrNoIdentifier = errors.New("radius: no free Identifier for server")
+
+// Client sends requests to RADIUS servers and waits for their responses. Requests to the same server share a
+// socket, on which Identifiers are allocated so that concurrent requests can be told apart.
+type Client struct {
+	// Net is the network used to reach servers, "udp" if empty. With "tcp", "tcp4" or "tcp6", packets are framed
+	// by their Length as described in RFC 6613, and requests are not retransmitted on the same connection. With
+	// "tls", the same framing is used over TLS connections as described in RFC 6614, and requests must be sent
+	// with RadSecSecret. With "dtls", requests are sent with RadSecSecret over DTLS sessions as described in RFC
+	// 7360, and retransmitted as over UDP.
+	Net string
+
+	// TLSConfig configures the sessions of the "tls" and "dtls" networks, such as the client certificate presented
+	// to servers and the roots their certificates are verified against.
+	TLSConfig *tls.Config
+
+	// Retry is how long the first transmission of a request waits for a response before it is retransmitted. Each
+	// retransmission doubles the wait, up to MaxRetry. They default to 2 and 16 seconds.
+	Retry    time.Duration
+	MaxRetry time.Duration
+
+	// MaxAttempts is how many times a request is sent before giving up, 3 if zero.
+	MaxAttempts int
+
+	mu    sync.Mutex
+	conns map[string]*clientConn
+}
+
+// clientConn is the socket of a Client towards one server, and the requests waiting for a response on it.
+type clientConn struct {
+	conn net.Conn
+	// stream is set on connections with reliable transport, on which requests are sent once.
+	stream bool
+
+	mu      sync.Mutex
+	pending map[int]chan Packet
+	next    int
+}
+
+// NewAccessRequest returns an Access-Request for userName with a random Request Authenticator and password
+// hidden with secret, as described in RFC 2865 section 5.2.
+func NewAccessRequest(userName string, password string, secret string) (*Packet, error) {
+	packet := &Packet{Code: AccessRequest}
+	if _, err := rand.Read(packet.Authenticator[:]); err != nil {
+		return nil, err
+	}
+
+	packet.AddAttribute(UserName, []byte(userName))
+	packet.AddAttribute(UserPassword, HidePassword(password, packet.Authenticator, secret))
+
+	return packet, nil
+}
+
+// NewAccountingRequest returns an Accounting-Request of the given status for session. Its Request Authenticator
+// is computed by the Client when it is sent.
+func NewAccountingRequest(status AcctStatus, session string) *Packet {
+	packet := &Packet{Code: AccountingRequest}
+
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(status))
+	packet.AddAttribute(AcctStatusType, b)
+	packet.AddAttribute(AcctSessionID, []byte(session))
+
+	return packet
+}
+
+// NewStatusServer returns a Status-Server request, as described in RFC 5997, with a Message-Authenticator computed
+// by the Client when it is sent.
+func NewStatusServer() *Packet {
+	packet := &Packet{Code: StatusServer}
+	packet.AddAttribute(MessageAuthenticator, make([]byte, 16))
+	return packet
+}
+
+// Exchange sends packet to the server at addr and returns its response. The Identifier of packet is allocated by
+// the client. Access-Requests and Status-Server requests keep their Request Authenticator, which is made random if
+// unset, while other requests are signed with secret as described in RFC 2866 section 3. A Message-Authenticator
+// carried by packet is computed by the client.
+//
+// The request is retransmitted with exponential backoff until a response with a valid Response Authenticator
+// arrives, MaxAttempts transmissions went unanswered or ctx is done. Over TCP and TLS the request is sent once,
+// and the same backoff only bounds how long its response is waited for.
+func (c *Client) Exchange(ctx context.Context, addr string, secret string, packet *Packet) (*Packet, error) {
+	cc, err := c.dial(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	identifier, responses, err := cc.allocate()
+	if err != nil {
+		return nil, err
+	}
+	defer cc.release(identifier)
+
+	packet.Identifier = identifier
+	switch packet.Code {
+	case AccessRequest, StatusServer:
+		if packet.Authenticator == [16]byte{} {
+			if _, err := rand.Read(packet.Authenticator[:]); err != nil {
+				return nil, err
+			}
+		}
+		signMessageAuthenticator(packet, secret)
+	default:
+		packet.Authenticator = [16]byte{}
+		signMessageAuthenticator(packet, secret)
+		SignAccountingRequest(packet, secret)
+	}
+	message := packet.packetToBytes()
+
+	wait := c.retry()
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for attempt := 0; attempt < c.maxAttempts(); attempt++ {
+		if attempt > 0 {
+			if wait *= 2; wait > c.maxRetry() {
+				wait = c.maxRetry()
+			}
+			timer.Reset(wait)
+		}
+
+		if attempt == 0 || !cc.stream {
+			if _, err := cc.conn.Write(message); err != nil {
+				return nil, err
+			}
+		}
+
+	receive:
+		for {
+			select {
+			case response, ok := <-responses:
+				if !ok {
+					return nil, net.ErrClosed
+				}
+				if VerifyResponse(*packet, response, secret) {
+					return &response, nil
+				}
+			case <-timer.C:
+				break receive
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	return nil, ErrTimeout
+}
+
+// Close closes the sockets of the client. Exchanges in progress fail.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var err error
+	for addr, cc := range c.conns {
+		if closeErr := cc.conn.Close(); err == nil {
+			err = closeErr
+		}
+		delete(c.conns, addr)
+	}
+	return err
+}
+
+func (c *Client) retry() time.Duration {
+	if c.Retry <= 0 {
+		return 2 * time.Second
+	}
+	return c.Retry
+}
+
+func (c *Client) maxRetry() time.Duration {
+	if c.MaxRetry <= 0 {
+		return 16 * time.Second
+	}
+	return c.MaxRetry
+}
+
+func (c *Client) maxAttempts() int {
+	if c.MaxAttempts <= 0 {
+		return 3
+	}
+	return c.MaxAttempts
+}
+
+// dial returns the socket towards addr, opening it on first use.
+func (c *Client) dial(addr string) (*clientConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cc, ok := c.conns[addr]; ok {
+		return cc, nil
+	}
+
+	network := c.Net
+	if network == "" {
+		network = "udp"
+	}
+	var conn net.Conn
+	var err error
+	switch network {
+	case "tls":
+		conn, err = tls.Dial("tcp", addr, c.TLSConfig)
+	case "dtls":
+		conn, err = dialDTLS("udp", addr, c.TLSConfig, c.maxRetry())
+	default:
+		conn, err = net.Dial(network, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stream := network == "tls" || strings.HasPrefix(network, "tcp")
+	cc := &clientConn{conn: conn, stream: stream, pending: make(map[int]chan Packet)}
+	if c.conns == nil {
+		c.conns = make(map[string]*clientConn)
+	}
+	c.conns[addr] = cc
+	go c.read(addr, cc)
+
+	return cc, nil
+}
+
+// read passes the packets received on cc to the exchange waiting for their Identifier until cc is closed.
+func (c *Client) read(addr string, cc *clientConn) {
+	buffer := make([]byte, maxPacketLength)
+
+	for {
+		var response Packet
+		if cc.stream {
+			var err error
+			if response, err = readPacket(cc.conn, buffer); err != nil {
+				break
+			}
+		} else {
+			n, err := cc.conn.Read(buffer)
+			if errors.Is(err, net.ErrClosed) || err == io.EOF {
+				break
+			}
+			// Errors such as ICMP port unreachable only concern the request that caused them, which will time out.
+			if err != nil {
+				continue
+			}
+			var ok bool
+			if response, ok = decodeDatagram(buffer[:n]); !ok {
+				continue
+			}
+		}
+		// The buffer is reused for the next packet.
+		response.Attributes = append([]byte(nil), response.Attributes...)
+
+		cc.mu.Lock()
+		if responses, ok := cc.pending[response.Identifier]; ok {
+			select {
+			case responses <- response:
+			default:
+			}
+		}
+		cc.mu.Unlock()
+	}
+	cc.conn.Close()
+
+	c.mu.Lock()
+	if c.conns[addr] == cc {
+		delete(c.conns, addr)
+	}
+	c.mu.Unlock()
+
+	cc.mu.Lock()
+	for identifier, responses := range cc.pending {
+		close(responses)
+		delete(cc.pending, identifier)
+	}
+	cc.mu.Unlock()
+}
+
+// allocate reserves an Identifier and returns the channel its responses are delivered to.
+func (cc *clientConn) allocate() (int, chan Packet, error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	for i := 0; i < 256; i++ {
+		identifier := (cc.next + i) % 256
+		if _, ok := cc.pending[identifier]; ok {
+			continue
+		}
+		responses := make(chan Packet, 1)
+		cc.pending[identifier] = responses
+		cc.next = (identifier + 1) % 256
+		return identifier, responses, nil
+	}
+
+	return 0, nil, ErrNoIdentifier
+}
+
+// release frees an Identifier reserved by allocate.
+func (cc *clientConn) release(identifier int) {
+	cc.mu.Lock()
+	delete(cc.pending, identifier)
+	cc.mu.Unlock()
+}
@@ -0,0 +1,134 @@
+package radius
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// listenTestServer starts srv on a random local port and returns its address.
+func listenTestServer(t *testing.T, srv *Server) string {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	srv.Conn = conn
+	go srv.serve()
+
+	return conn.LocalAddr().String()
+}
+
+func TestClientExchange(t *testing.T) {
+	srv := &Server{Secret: secret, Users: Users{"alice": "{CLEARTEXT}wonderland"}}
+	mux := NewServeMux()
+	mux.HandleFunc(AccessRequest, srv.authenticate)
+	mux.HandleFunc(AccountingRequest, func(req *Request) *Packet {
+		if !VerifyAccountingRequest(req.Packet, req.Secret) {
+			return nil
+		}
+		return req.Response(AccountingResponse)
+	})
+	srv.Handler = mux
+	addr := listenTestServer(t, srv)
+
+	client := &Client{}
+	defer client.Close()
+
+	for password, want := range map[string]Code{"wonderland": AccessAccept, "looking-glass": AccessReject} {
+		request, err := NewAccessRequest("alice", password, secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := client.Exchange(context.Background(), addr, secret, request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.Code != want {
+			t.Errorf("Access-Request with password %q answered with %v, want %v", password, response.Code, want)
+		}
+	}
+
+	response, err := client.Exchange(context.Background(), addr, secret, NewAccountingRequest(AcctStart, "s1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Code != AccountingResponse {
+		t.Errorf("Accounting-Request answered with %v, want %v", response.Code, AccountingResponse)
+	}
+}
+
+func TestClientRetransmit(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// The server ignores the first transmission, then answers with a forged response before the real one.
+	received := make(chan Packet, 8)
+	go func() {
+		buffer := make([]byte, 4096)
+		for attempt := 0; ; attempt++ {
+			n, addr, err := conn.ReadFromUDP(buffer)
+			if err != nil {
+				return
+			}
+			request := DecodePacket(append([]byte(nil), buffer[:n]...), n)
+			received <- request
+			if attempt == 0 {
+				continue
+			}
+			conn.WriteToUDP(PrepareResponse(request, &Packet{Code: AccessAccept}, "forged"), addr)
+			conn.WriteToUDP(PrepareResponse(request, &Packet{Code: AccessAccept}, secret), addr)
+		}
+	}()
+
+	client := &Client{Retry: 20 * time.Millisecond}
+	defer client.Close()
+
+	request, err := NewAccessRequest("alice", "wonderland", secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := client.Exchange(context.Background(), conn.LocalAddr().String(), secret, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Code != AccessAccept {
+		t.Errorf("response is %v, want %v", response.Code, AccessAccept)
+	}
+
+	first, second := <-received, <-received
+	if !first.Equal(second) || first.Identifier != request.Identifier {
+		t.Errorf("retransmission %v differs from first transmission %v", second, first)
+	}
+	if password := ReversePassword(first.DecodedAttributes()[UserPassword], first.Authenticator, secret); password != "wonderland" {
+		t.Errorf("User-Password == %q, want it hidden with the secret", password)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	addr := conn.LocalAddr().String()
+
+	client := &Client{Retry: 10 * time.Millisecond, MaxAttempts: 2}
+	defer client.Close()
+
+	if _, err := client.Exchange(context.Background(), addr, secret, NewAccountingRequest(AcctStop, "s1")); err != ErrTimeout {
+		t.Errorf("Exchange with silent server returned %v, want %v", err, ErrTimeout)
+	}
+
+	client.Retry = time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.Exchange(ctx, addr, secret, NewAccountingRequest(AcctStop, "s1")); err != context.DeadlineExceeded {
+		t.Errorf("Exchange past the context deadline returned %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,96 @@
+package radius
+
+import (
+	"crypto/x509"
+	"net"
+	"strings"
+)
+
+// ClientStore looks up the NASes allowed to send requests to a Server.
+type ClientStore interface {
+	// ClientByAddr returns the client sending from ip over UDP or TCP, or nil if there is none.
+	ClientByAddr(ip net.IP) *NASClient
+	// ClientByCertificate returns the client presenting cert over TLS, or nil if there is none.
+	ClientByCertificate(cert *x509.Certificate) *NASClient
+}
+
+// NASClient is a NAS allowed to send requests to a Server.
+type NASClient struct {
+	// Name identifies the client in logs.
+	Name string
+
+	// Network holds the addresses the client sends from over UDP and TCP.
+	Network *net.IPNet
+	// Secret is the shared secret of the client over UDP and TCP. Over TLS the secret is always RadSecSecret.
+	Secret string
+
+	// Identity is the Subject Common Name, DNS name or URI of the certificate the client presents over TLS.
+	Identity string
+}
+
+// NASClients is a ClientStore holding clients in memory. When several match, the first one is used.
+type NASClients []*NASClient
+
+// ClientByAddr returns the first client whose Network contains ip.
+func (c NASClients) ClientByAddr(ip net.IP) *NASClient {
+	for _, client := range c {
+		if client.Network != nil && client.Network.Contains(ip) {
+			return client
+		}
+	}
+	return nil
+}
+
+// ClientByCertificate returns the first client whose Identity is a name of cert.
+func (c NASClients) ClientByCertificate(cert *x509.Certificate) *NASClient {
+	names := certificateNames(cert)
+	for _, client := range c {
+		if client.Identity == "" {
+			continue
+		}
+		for _, name := range names {
+			if strings.EqualFold(client.Identity, name) {
+				return client
+			}
+		}
+	}
+	return nil
+}
+
+// certificateNames returns the Subject Common Name and the DNS and URI Subject Alternative Names of cert.
+func certificateNames(cert *x509.Certificate) []string {
+	var names []string
+	if cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+	names = append(names, cert.DNSNames...)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	return names
+}
+
+// hostIP returns the IP address of addr, or nil if it has none.
+func hostIP(addr net.Addr) net.IP {
+	switch addr := addr.(type) {
+	case *net.UDPAddr:
+		return addr.IP
+	case *net.TCPAddr:
+		return addr.IP
+	}
+	return nil
+}
+
+// clientFor returns the client sending from addr and its secret, or the secret of the server if it has no Clients.
+// ok is false if the server has Clients and none of them sends from addr.
+func (srv *Server) clientFor(addr net.Addr) (client *NASClient, secret string, ok bool) {
+	if srv.Clients == nil {
+		return nil, srv.Secret, true
+	}
+
+	client = srv.Clients.ClientByAddr(hostIP(addr))
+	if client == nil {
+		return nil, "", false
+	}
+	return client, client.Secret, true
+}
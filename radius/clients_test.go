@@ -0,0 +1,50 @@
+package radius
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestNASClients(t *testing.T) {
+	_, network, _ := net.ParseCIDR("10.0.0.0/24")
+	nas1 := &NASClient{Name: "nas1", Network: network, Secret: "nas1", Identity: "nas1.example.com"}
+	nas2 := &NASClient{Name: "nas2", Identity: "urn:nas:2"}
+	clients := NASClients{nas1, nas2}
+
+	if client := clients.ClientByAddr(net.IPv4(10, 0, 0, 7)); client != nas1 {
+		t.Errorf("ClientByAddr(10.0.0.7) == %v, want %v", client, nas1)
+	}
+	if client := clients.ClientByAddr(net.IPv4(10, 0, 1, 7)); client != nil {
+		t.Errorf("ClientByAddr(10.0.1.7) == %v, want nil", client)
+	}
+
+	ca := newTestCA(t)
+	for name, want := range map[string]*NASClient{"NAS1.example.com": nas1, "nas3.example.com": nil} {
+		cert, err := x509.ParseCertificate(ca.issue(t, name).Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if client := clients.ClientByCertificate(cert); client != want {
+			t.Errorf("ClientByCertificate(%s) == %v, want %v", name, client, want)
+		}
+	}
+}
+
+func TestServerClients(t *testing.T) {
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	srv := &Server{Secret: secret, Clients: NASClients{{Name: "local", Network: loopback, Secret: "local"}}}
+	addr := listenTestServer(t, srv)
+
+	client := &Client{Retry: 50 * time.Millisecond, MaxAttempts: 2}
+	defer client.Close()
+
+	// Requests are answered with the secret of the client, not that of the server.
+	for s, want := range map[string]error{"local": nil, secret: ErrTimeout} {
+		if _, err := client.Exchange(context.Background(), addr, s, NewStatusServer()); err != want {
+			t.Errorf("Status-Server with secret %q returned %v, want %v", s, err, want)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package radius
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/md4"
+)
+
+// AuthType is the authentication method used by an Access-Request.
+type AuthType int
+
+// Authentication methods a Credential may be asked to verify.
+const (
+	PAP AuthType = iota + 1
+	CHAP
+	MSCHAP
+	MSCHAPv2
+)
+
+var authTypeText = map[AuthType]string{
+	PAP:      "PAP",
+	CHAP:     "CHAP",
+	MSCHAP:   "MS-CHAP",
+	MSCHAPv2: "MS-CHAPv2",
+}
+
+func (t AuthType) String() string {
+	return authTypeText[t]
+}
+
+// Scheme is the algorithm used to store a Credential.
+type Scheme int
+
+// Password storage schemes recognised by Credential.
+const (
+	SchemeCleartext Scheme = iota
+	SchemeBcrypt
+	SchemeMD5Crypt
+	SchemeSHA256Crypt
+	SchemeSHA512Crypt
+	SchemeSHA
+	SchemeSSHA
+	SchemeSHA256
+	SchemeSSHA256
+	SchemeSHA512
+	SchemeSSHA512
+	SchemeNTHash
+	SchemeUnknown
+)
+
+var schemeText = map[Scheme]string{
+	SchemeCleartext:   "Cleartext",
+	SchemeBcrypt:      "bcrypt",
+	SchemeMD5Crypt:    "MD5-crypt",
+	SchemeSHA256Crypt: "SHA256-crypt",
+	SchemeSHA512Crypt: "SHA512-crypt",
+	SchemeSHA:         "SHA",
+	SchemeSSHA:        "SSHA",
+	SchemeSHA256:      "SHA256",
+	SchemeSSHA256:     "SSHA256",
+	SchemeSHA512:      "SHA512",
+	SchemeSSHA512:     "SSHA512",
+	SchemeNTHash:      "NT-Password",
+	SchemeUnknown:     "Unknown",
+}
+
+func (s Scheme) String() string {
+	return schemeText[s]
+}
+
+// Supports reports whether a password stored with the scheme can be used to verify authType.
+// CHAP needs the cleartext password and MS-CHAP needs either the cleartext or the NT hash,
+// so every other scheme can only verify PAP.
+func (s Scheme) Supports(authType AuthType) bool {
+	switch authType {
+	case PAP:
+		return s != SchemeUnknown
+	case CHAP:
+		return s == SchemeCleartext
+	case MSCHAP, MSCHAPv2:
+		return s == SchemeCleartext || s == SchemeNTHash
+	}
+	return false
+}
+
+// LDAP-style prefixes in front of digests and crypt(3) values, compared case-insensitively.
+var ldapPrefixes = []struct {
+	prefix string
+	scheme Scheme
+}{
+	{"{SHA}", SchemeSHA},
+	{"{SSHA}", SchemeSSHA},
+	{"{SHA256}", SchemeSHA256},
+	{"{SSHA256}", SchemeSSHA256},
+	{"{SHA512}", SchemeSHA512},
+	{"{SSHA512}", SchemeSSHA512},
+	{"{NT}", SchemeNTHash},
+	{"{NTHASH}", SchemeNTHash},
+	{"{CLEARTEXT}", SchemeCleartext},
+}
+
+// ErrUnsupportedAuthType is returned when a Credential cannot verify the requested authentication method.
+var ErrUnsupportedAuthType = errors.New("radius: authentication type not supported by stored password")
+
+// ErrMalformedCredential is returned when a stored password has a recognised prefix but an invalid body.
+var ErrMalformedCredential = errors.New("radius: malformed stored password")
+
+// Credential is a password as held by a user store. The hashing algorithm is chosen from its prefix:
+//
+//	$2a$, $2b$, $2y$          bcrypt
+//	$1$                       MD5-crypt
+//	$5$, $6$                  SHA256-crypt and SHA512-crypt
+//	{SHA}, {SSHA}             base64 SHA-1 digest, optionally salted (also {SHA256}, {SSHA256}, {SHA512}, {SSHA512})
+//	{NT}, {NTHASH}            hex encoded NT-Password (MD4 of the UTF-16LE password)
+//	{CRYPT}                   any of the crypt(3) formats above
+//	{CLEARTEXT} or no prefix  cleartext
+type Credential string
+
+// split returns the scheme of the credential and the value that follows its prefix.
+func (c Credential) split() (Scheme, string) {
+	value := string(c)
+
+	if len(value) >= len("{CRYPT}") && strings.EqualFold(value[:len("{CRYPT}")], "{CRYPT}") {
+		value = value[len("{CRYPT}"):]
+		if s := cryptScheme(value); s != SchemeCleartext {
+			return s, value
+		}
+		return SchemeUnknown, value
+	}
+
+	if s := cryptScheme(value); s != SchemeCleartext {
+		return s, value
+	}
+
+	for _, p := range ldapPrefixes {
+		if len(value) >= len(p.prefix) && strings.EqualFold(value[:len(p.prefix)], p.prefix) {
+			return p.scheme, value[len(p.prefix):]
+		}
+	}
+
+	if strings.HasPrefix(value, "{") && strings.Contains(value, "}") {
+		return SchemeUnknown, value
+	}
+
+	return SchemeCleartext, value
+}
+
+// cryptScheme returns the crypt(3) scheme of value or SchemeCleartext if value is not a crypt(3) hash.
+func cryptScheme(value string) Scheme {
+	switch {
+	case strings.HasPrefix(value, "$2a$"), strings.HasPrefix(value, "$2b$"), strings.HasPrefix(value, "$2y$"):
+		return SchemeBcrypt
+	case strings.HasPrefix(value, "$1$"):
+		return SchemeMD5Crypt
+	case strings.HasPrefix(value, "$5$"):
+		return SchemeSHA256Crypt
+	case strings.HasPrefix(value, "$6$"):
+		return SchemeSHA512Crypt
+	}
+	return SchemeCleartext
+}
+
+// Scheme returns the algorithm the credential is stored with.
+func (c Credential) Scheme() Scheme {
+	s, _ := c.split()
+	return s
+}
+
+// Supports reports whether the credential can be used to verify authType.
+func (c Credential) Supports(authType AuthType) bool {
+	return c.Scheme().Supports(authType)
+}
+
+// Cleartext returns the cleartext password if the credential is stored in the clear.
+func (c Credential) Cleartext() (password string, ok bool) {
+	s, value := c.split()
+	if s != SchemeCleartext {
+		return "", false
+	}
+	return value, true
+}
+
+// NTHash returns the NT-Password hash of the credential, computing it if the credential is cleartext.
+func (c Credential) NTHash() (ntHash []byte, ok bool) {
+	s, value := c.split()
+	switch s {
+	case SchemeCleartext:
+		return ntPasswordHash(value), true
+	case SchemeNTHash:
+		h, err := hex.DecodeString(value)
+		if err != nil || len(h) != md4.Size {
+			return nil, false
+		}
+		return h, true
+	}
+	return nil, false
+}
+
+// Verify checks a cleartext password, as received with PAP, against the credential.
+func (c Credential) Verify(password string) (bool, error) {
+	s, value := c.split()
+
+	switch s {
+	case SchemeCleartext:
+		return subtle.ConstantTimeCompare([]byte(value), []byte(password)) == 1, nil
+
+	case SchemeBcrypt:
+		err := bcrypt.CompareHashAndPassword([]byte(value), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		}
+		if err != nil {
+			return false, ErrMalformedCredential
+		}
+		return true, nil
+
+	case SchemeMD5Crypt, SchemeSHA256Crypt, SchemeSHA512Crypt:
+		var computed string
+		var err error
+		if s == SchemeMD5Crypt {
+			computed, err = md5Crypt(password, value)
+		} else {
+			computed, err = shaCrypt(password, value)
+		}
+		if err != nil {
+			return false, ErrMalformedCredential
+		}
+		return subtle.ConstantTimeCompare([]byte(computed), []byte(value)) == 1, nil
+
+	case SchemeSHA, SchemeSSHA, SchemeSHA256, SchemeSSHA256, SchemeSHA512, SchemeSSHA512:
+		return verifyDigest(s, value, password)
+
+	case SchemeNTHash:
+		stored, ok := c.NTHash()
+		if !ok {
+			return false, ErrMalformedCredential
+		}
+		return subtle.ConstantTimeCompare(stored, ntPasswordHash(password)) == 1, nil
+	}
+
+	return false, ErrMalformedCredential
+}
+
+// VerifyCHAP checks the value of a CHAP-Password attribute against the credential.
+// challenge is the CHAP-Challenge attribute or, if absent, the Request Authenticator.
+func (c Credential) VerifyCHAP(chapPassword []byte, challenge []byte) (bool, error) {
+	password, ok := c.Cleartext()
+	if !ok {
+		return false, ErrUnsupportedAuthType
+	}
+	if len(chapPassword) != 1+md5.Size {
+		return false, nil
+	}
+
+	h := md5.New()
+	h.Write(chapPassword[:1])
+	h.Write([]byte(password))
+	h.Write(challenge)
+
+	return subtle.ConstantTimeCompare(h.Sum(nil), chapPassword[1:]) == 1, nil
+}
+
+// verifyDigest checks password against a base64 LDAP-style digest, where the salt, if any, follows the digest.
+func verifyDigest(s Scheme, value string, password string) (bool, error) {
+	var h hash.Hash
+	switch s {
+	case SchemeSHA, SchemeSSHA:
+		h = sha1.New()
+	case SchemeSHA256, SchemeSSHA256:
+		h = sha256.New()
+	default:
+		h = sha512.New()
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(raw) < h.Size() {
+		return false, ErrMalformedCredential
+	}
+	digest, salt := raw[:h.Size()], raw[h.Size():]
+	if len(salt) > 0 && (s == SchemeSHA || s == SchemeSHA256 || s == SchemeSHA512) {
+		return false, ErrMalformedCredential
+	}
+
+	h.Write([]byte(password))
+	h.Write(salt)
+
+	return subtle.ConstantTimeCompare(h.Sum(nil), digest) == 1, nil
+}
+
+// ntPasswordHash returns the MD4 hash of the UTF-16LE encoding of password.
+func ntPasswordHash(password string) []byte {
+	u := utf16.Encode([]rune(password))
+	b := make([]byte, 2*len(u))
+	for i, r := range u {
+		b[2*i] = byte(r)
+		b[2*i+1] = byte(r >> 8)
+	}
+
+	h := md4.New()
+	h.Write(b)
+	return h.Sum(nil)
+}
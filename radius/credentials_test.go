@@ -0,0 +1,97 @@
+package radius
+
+import (
+	"crypto/md5"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestCredentialVerify(t *testing.T) {
+	bcryptHash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+
+	cases := []struct {
+		stored   Credential
+		password string
+		scheme   Scheme
+		expected bool
+	}{
+		// Cleartext with and without a prefix.
+		{"secret", "secret", SchemeCleartext, true},
+		{"{CLEARTEXT}secret", "secret", SchemeCleartext, true},
+		{"secret", "Secret", SchemeCleartext, false},
+		// bcrypt.
+		{Credential(bcryptHash), "secret", SchemeBcrypt, true},
+		{Credential(bcryptHash), "wrong", SchemeBcrypt, false},
+		// crypt(3) MD5, SHA-256 and SHA-512, with and without an LDAP {CRYPT} prefix.
+		{"$1$saltsalt$9xy1btjgzLYfb7hivXtC//", "secret", SchemeMD5Crypt, true},
+		{"$1$saltsalt$9xy1btjgzLYfb7hivXtC//", "wrong", SchemeMD5Crypt, false},
+		{"$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5", "Hello world!", SchemeSHA256Crypt, true},
+		{"$5$rounds=10000$saltstringsaltst$3xv.VbSHBb41AL9AvLeujZkZRBAwqFMz2.opqey6IcA", "Hello world!", SchemeSHA256Crypt, true},
+		{"$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1", "Hello world!", SchemeSHA512Crypt, true},
+		{"{CRYPT}$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1", "Hello world!", SchemeSHA512Crypt, true},
+		{"$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1", "hello world!", SchemeSHA512Crypt, false},
+		// LDAP-style salted and unsalted SHA-1.
+		{"{SSHA}gVK8WC9YyFT1gMsQHTGCgT3sSv5zYWx0", "secret", SchemeSSHA, true},
+		{"{ssha}gVK8WC9YyFT1gMsQHTGCgT3sSv5zYWx0", "wrong", SchemeSSHA, false},
+		{"{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=", "secret", SchemeSHA, true},
+		// NT-Password.
+		{"{NT}8846F7EAEE8FB117AD06BDD830B7586C", "password", SchemeNTHash, true},
+		{"{nthash}8846f7eaee8fb117ad06bdd830b7586c", "Password", SchemeNTHash, false},
+	}
+
+	for test, c := range cases {
+		if got := c.stored.Scheme(); got != c.scheme {
+			t.Errorf("Test %d: Scheme() == %s, want %s", test, got, c.scheme)
+		}
+
+		got, err := c.stored.Verify(c.password)
+		if err != nil {
+			t.Errorf("Test %d: Verify(%q) returned error %v", test, c.password, err)
+		}
+		if got != c.expected {
+			t.Errorf("Test %d: Verify(%q) == %t, want %t", test, c.password, got, c.expected)
+		}
+	}
+}
+
+func TestSchemeSupports(t *testing.T) {
+	cases := []struct {
+		scheme   Scheme
+		authType AuthType
+		expected bool
+	}{
+		{SchemeCleartext, PAP, true},
+		{SchemeCleartext, CHAP, true},
+		{SchemeCleartext, MSCHAPv2, true},
+		{SchemeNTHash, PAP, true},
+		{SchemeNTHash, CHAP, false},
+		{SchemeNTHash, MSCHAP, true},
+		{SchemeBcrypt, PAP, true},
+		{SchemeBcrypt, CHAP, false},
+		{SchemeSSHA, MSCHAPv2, false},
+		{SchemeUnknown, PAP, false},
+	}
+
+	for test, c := range cases {
+		if got := c.scheme.Supports(c.authType); got != c.expected {
+			t.Errorf("Test %d: %s.Supports(%s) == %t, want %t", test, c.scheme, c.authType, got, c.expected)
+		}
+	}
+}
+
+func TestCredentialVerifyCHAP(t *testing.T) {
+	challenge := []byte("0123456789abcdef")
+	response := md5.Sum(append(append([]byte{7}, "secret"...), challenge...))
+	chapPassword := append([]byte{7}, response[:]...)
+
+	if ok, err := Credential("secret").VerifyCHAP(chapPassword, challenge); !ok || err != nil {
+		t.Errorf("VerifyCHAP with matching cleartext == %t, %v, want true, nil", ok, err)
+	}
+	if ok, _ := Credential("other").VerifyCHAP(chapPassword, challenge); ok {
+		t.Errorf("VerifyCHAP with different cleartext == true, want false")
+	}
+	if _, err := Credential("{NT}8846F7EAEE8FB117AD06BDD830B7586C").VerifyCHAP(chapPassword, challenge); err != ErrUnsupportedAuthType {
+		t.Errorf("VerifyCHAP with NT hash returned %v, want %v", err, ErrUnsupportedAuthType)
+	}
+}
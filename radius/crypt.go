@@ -0,0 +1,252 @@
+package radius
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// cryptAlphabet is the base64 alphabet used by crypt(3).
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// Round limits and defaults for SHA-crypt from the specification by Ulrich Drepper.
+const (
+	shaCryptRoundsDefault = 5000
+	shaCryptRoundsMin     = 1000
+	shaCryptRoundsMax     = 999999999
+	shaCryptSaltMax       = 16
+	md5CryptSaltMax       = 8
+)
+
+var errMalformedCrypt = errors.New("radius: malformed crypt(3) hash")
+
+// Byte permutations used when encoding the final digest of each crypt(3) variant.
+var (
+	md5CryptOrder = [][3]int{
+		{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5},
+	}
+	sha256CryptOrder = [][3]int{
+		{0, 10, 20}, {21, 1, 11}, {12, 22, 2}, {3, 13, 23}, {24, 4, 14},
+		{15, 25, 5}, {6, 16, 26}, {27, 7, 17}, {18, 28, 8}, {9, 19, 29},
+	}
+	sha512CryptOrder = [][3]int{
+		{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4},
+		{47, 5, 26}, {6, 27, 48}, {28, 49, 7}, {50, 8, 29}, {9, 30, 51},
+		{31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13}, {56, 14, 35},
+		{15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19},
+		{62, 20, 41},
+	}
+)
+
+// cryptEncode appends n characters of the 24 bit value made of b2, b1 and b0 to out.
+func cryptEncode(out []byte, b2, b1, b0 byte, n int) []byte {
+	w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+	for ; n > 0; n-- {
+		out = append(out, cryptAlphabet[w&0x3f])
+		w >>= 6
+	}
+	return out
+}
+
+// md5Crypt computes the "$1$" MD5-crypt hash of password using the salt found in settings.
+func md5Crypt(password, settings string) (string, error) {
+	const magic = "$1$"
+
+	if !strings.HasPrefix(settings, magic) {
+		return "", errMalformedCrypt
+	}
+	salt := settings[len(magic):]
+	if i := strings.IndexByte(salt, '$'); i >= 0 {
+		salt = salt[:i]
+	}
+	if len(salt) > md5CryptSaltMax {
+		salt = salt[:md5CryptSaltMax]
+	}
+
+	pw := []byte(password)
+
+	alt := md5.Sum([]byte(password + salt + password))
+
+	ctx := md5.New()
+	ctx.Write([]byte(password + magic + salt))
+	for pl := len(pw); pl > 0; pl -= 16 {
+		if pl > 16 {
+			ctx.Write(alt[:])
+		} else {
+			ctx.Write(alt[:pl])
+		}
+	}
+	for i := len(pw); i != 0; i >>= 1 {
+		if i&1 != 0 {
+			ctx.Write([]byte{0})
+		} else if len(pw) > 0 {
+			ctx.Write(pw[:1])
+		}
+	}
+	final := ctx.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		ctx.Reset()
+		if i&1 != 0 {
+			ctx.Write(pw)
+		} else {
+			ctx.Write(final)
+		}
+		if i%3 != 0 {
+			ctx.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			ctx.Write(pw)
+		}
+		if i&1 != 0 {
+			ctx.Write(final)
+		} else {
+			ctx.Write(pw)
+		}
+		final = ctx.Sum(final[:0])
+	}
+
+	out := []byte(magic + salt + "$")
+	for _, o := range md5CryptOrder {
+		out = cryptEncode(out, final[o[0]], final[o[1]], final[o[2]], 4)
+	}
+	out = cryptEncode(out, 0, 0, final[11], 2)
+
+	return string(out), nil
+}
+
+// shaCrypt computes the "$5$" or "$6$" SHA-crypt hash of password using the salt and rounds found in settings.
+func shaCrypt(password, settings string) (string, error) {
+	var newHash func() hash.Hash
+	var order [][3]int
+
+	switch {
+	case strings.HasPrefix(settings, "$5$"):
+		newHash, order = sha256.New, sha256CryptOrder
+	case strings.HasPrefix(settings, "$6$"):
+		newHash, order = sha512.New, sha512CryptOrder
+	default:
+		return "", errMalformedCrypt
+	}
+	magic := settings[:3]
+	salt := settings[3:]
+
+	rounds := shaCryptRoundsDefault
+	customRounds := false
+	if strings.HasPrefix(salt, "rounds=") {
+		i := strings.IndexByte(salt, '$')
+		if i < 0 {
+			return "", errMalformedCrypt
+		}
+		n, err := strconv.ParseUint(salt[len("rounds="):i], 10, 32)
+		if err != nil {
+			return "", errMalformedCrypt
+		}
+		rounds = int(n)
+		if rounds < shaCryptRoundsMin {
+			rounds = shaCryptRoundsMin
+		}
+		if rounds > shaCryptRoundsMax {
+			rounds = shaCryptRoundsMax
+		}
+		customRounds = true
+		salt = salt[i+1:]
+	}
+	if i := strings.IndexByte(salt, '$'); i >= 0 {
+		salt = salt[:i]
+	}
+	if len(salt) > shaCryptSaltMax {
+		salt = salt[:shaCryptSaltMax]
+	}
+
+	pw := []byte(password)
+	s := []byte(salt)
+
+	ctx := newHash()
+	ctx.Write(pw)
+	ctx.Write(s)
+	ctx.Write(pw)
+	alt := ctx.Sum(nil)
+	size := len(alt)
+
+	ctx.Reset()
+	ctx.Write(pw)
+	ctx.Write(s)
+	cnt := len(pw)
+	for ; cnt > size; cnt -= size {
+		ctx.Write(alt)
+	}
+	ctx.Write(alt[:cnt])
+	for cnt = len(pw); cnt > 0; cnt >>= 1 {
+		if cnt&1 != 0 {
+			ctx.Write(alt)
+		} else {
+			ctx.Write(pw)
+		}
+	}
+	alt = ctx.Sum(nil)
+
+	ctx.Reset()
+	for i := 0; i < len(pw); i++ {
+		ctx.Write(pw)
+	}
+	dp := ctx.Sum(nil)
+	p := make([]byte, 0, len(pw))
+	for cnt = len(pw); cnt >= size; cnt -= size {
+		p = append(p, dp...)
+	}
+	p = append(p, dp[:cnt]...)
+
+	ctx.Reset()
+	for i := 0; i < 16+int(alt[0]); i++ {
+		ctx.Write(s)
+	}
+	ds := ctx.Sum(nil)
+	sp := make([]byte, 0, len(s))
+	for cnt = len(s); cnt >= size; cnt -= size {
+		sp = append(sp, ds...)
+	}
+	sp = append(sp, ds[:cnt]...)
+
+	for i := 0; i < rounds; i++ {
+		ctx.Reset()
+		if i&1 != 0 {
+			ctx.Write(p)
+		} else {
+			ctx.Write(alt)
+		}
+		if i%3 != 0 {
+			ctx.Write(sp)
+		}
+		if i%7 != 0 {
+			ctx.Write(p)
+		}
+		if i&1 != 0 {
+			ctx.Write(alt)
+		} else {
+			ctx.Write(p)
+		}
+		alt = ctx.Sum(alt[:0])
+	}
+
+	out := []byte(magic)
+	if customRounds {
+		out = append(out, "rounds="+strconv.Itoa(rounds)+"$"...)
+	}
+	out = append(out, salt...)
+	out = append(out, '$')
+	for _, o := range order {
+		out = cryptEncode(out, alt[o[0]], alt[o[1]], alt[o[2]], 4)
+	}
+	if size == sha256.Size {
+		out = cryptEncode(out, 0, alt[31], alt[30], 3)
+	} else {
+		out = cryptEncode(out, 0, 0, alt[63], 2)
+	}
+
+	return string(out), nil
+}
@@ -0,0 +1,141 @@
+package radius
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+// DAPort is the port NASes receive Dynamic Authorization requests on (RFC 5176 section 3).
+const DAPort = "3799"
+
+// DACause is the value of the Error-Cause attribute from RFC 5176.
+type DACause uint32
+
+// Error-Cause values from RFC 5176 section 3.5.
+const (
+	CauseResidualContextRemoved              DACause = 201
+	CauseInvalidEAPPacket                            = 202
+	CauseUnsupportedAttribute                        = 401
+	CauseMissingAttribute                            = 402
+	CauseNASIdentificationMismatch                   = 403
+	CauseInvalidRequest                              = 404
+	CauseUnsupportedService                          = 405
+	CauseUnsupportedExtension                        = 406
+	CauseInvalidAttributeValue                       = 407
+	CauseAdministrativelyProhibited                  = 501
+	CauseRequestNotRoutable                          = 502
+	CauseSessionContextNotFound                      = 503
+	CauseSessionContextNotRemovable                  = 504
+	CauseOtherProxyProcessingError                   = 505
+	CauseResourcesUnavailable                        = 506
+	CauseRequestInitiated                            = 507
+	CauseMultipleSessionSelectionUnsupported         = 508
+)
+
+func (c DACause) String() string {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(c))
+	def, _ := DefaultDictionary.Definition(0, ErrorCause)
+	text, _ := def.Format(b)
+	return text
+}
+
+// DAError is returned when a NAS answers a Dynamic Authorization request with a Disconnect-NAK or CoA-NAK.
+type DAError struct {
+	Code Code
+	// Cause is the Error-Cause of the NAK, or 0 if it had none.
+	Cause DACause
+}
+
+func (e *DAError) Error() string {
+	if e.Cause == 0 {
+		return fmt.Sprintf("radius: %s", e.Code)
+	}
+	return fmt.Sprintf("radius: %s: %s", e.Code, e.Cause)
+}
+
+// DASession identifies the session a Dynamic Authorization request applies to, as described in RFC 5176 section
+// 3. Empty fields are not sent.
+type DASession struct {
+	UserName         string
+	AcctSessionID    string
+	NASIPAddress     net.IP
+	NASIdentifier    string
+	FramedIPAddress  net.IP
+	CallingStationID string
+}
+
+// addTo appends the session identification attributes to packet.
+func (s DASession) addTo(packet *Packet) {
+	if s.UserName != "" {
+		packet.AddAttribute(UserName, []byte(s.UserName))
+	}
+	if s.AcctSessionID != "" {
+		packet.AddAttribute(AcctSessionID, []byte(s.AcctSessionID))
+	}
+	if ip := s.NASIPAddress.To4(); ip != nil {
+		packet.AddAttribute(NASIPAddress, ip)
+	}
+	if s.NASIdentifier != "" {
+		packet.AddAttribute(NASIdentifier, []byte(s.NASIdentifier))
+	}
+	if ip := s.FramedIPAddress.To4(); ip != nil {
+		packet.AddAttribute(FramedIPAddress, ip)
+	}
+	if s.CallingStationID != "" {
+		packet.AddAttribute(CallingStationID, []byte(s.CallingStationID))
+	}
+}
+
+// Disconnect asks the NAS at addr, on DAPort if addr has no port, to end session. It returns a *DAError if the
+// NAS answers with a Disconnect-NAK.
+func (c *Client) Disconnect(ctx context.Context, addr string, secret string, session DASession) error {
+	packet := &Packet{Code: DisconnectRequest}
+	session.addTo(packet)
+
+	return c.exchangeDA(ctx, addr, secret, packet, DisconnectACK, DisconnectNAK)
+}
+
+// ChangeOfAuthorization asks the NAS at addr, on DAPort if addr has no port, to apply the authorization attributes
+// to session. It returns a *DAError if the NAS answers with a CoA-NAK.
+func (c *Client) ChangeOfAuthorization(ctx context.Context, addr string, secret string, session DASession, attributes Pairs) error {
+	packet := &Packet{Code: CoARequest}
+	session.addTo(packet)
+	if err := DefaultDictionary.AddPairs(packet, attributes); err != nil {
+		return err
+	}
+
+	return c.exchangeDA(ctx, addr, secret, packet, CoAACK, CoANAK)
+}
+
+// exchangeDA sends a Dynamic Authorization request stamped with Event-Timestamp and interprets its response.
+func (c *Client) exchangeDA(ctx context.Context, addr string, secret string, packet *Packet, ack Code, nak Code) error {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, DAPort)
+	}
+
+	timestamp := make([]byte, 4)
+	binary.BigEndian.PutUint32(timestamp, uint32(time.Now().Unix()))
+	packet.AddAttribute(EventTimestamp, timestamp)
+
+	response, err := c.Exchange(ctx, addr, secret, packet)
+	if err != nil {
+		return err
+	}
+
+	switch response.Code {
+	case ack:
+		return nil
+	case nak:
+		daErr := &DAError{Code: nak}
+		if cause, ok := uint32Value(response.Lookup(ErrorCause)); ok {
+			daErr.Cause = DACause(cause)
+		}
+		return daErr
+	}
+
+	return fmt.Errorf("radius: unexpected response code %d to %s", response.Code, packet.Code)
+}
@@ -0,0 +1,226 @@
+package radius
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"log"
+	"net"
+	"sync"
+)
+
+// DynamicAuthorizer applies Dynamic Authorization requests to the sessions of a NAS. Methods return nil to
+// acknowledge the request, or an error to reject it, with the Error-Cause of a *DAError.
+type DynamicAuthorizer interface {
+	Disconnect(req *Request) error
+	ChangeOfAuthorization(req *Request) error
+}
+
+// DAHandler answers Disconnect-Requests and CoA-Requests, as described in RFC 5176, with the outcome of applying
+// them with Authorizer. Requests with an invalid authenticator get no response.
+type DAHandler struct {
+	Authorizer DynamicAuthorizer
+}
+
+// NewDAServer returns a Server receiving Dynamic Authorization requests on DAPort and applying them with authorizer.
+func NewDAServer(secret string, authorizer DynamicAuthorizer) *Server {
+	return &Server{Addr: ":" + DAPort, Secret: secret, Handler: DAHandler{Authorizer: authorizer}}
+}
+
+// ServeRADIUS applies a Disconnect-Request or CoA-Request and answers with an ACK or NAK.
+func (h DAHandler) ServeRADIUS(req *Request) *Packet {
+	var ack, nak Code
+	var apply func(req *Request) error
+
+	switch req.Packet.Code {
+	case DisconnectRequest:
+		ack, nak, apply = DisconnectACK, DisconnectNAK, h.Authorizer.Disconnect
+	case CoARequest:
+		ack, nak, apply = CoAACK, CoANAK, h.Authorizer.ChangeOfAuthorization
+	default:
+		return nil
+	}
+
+	// Dynamic Authorization requests are signed like Accounting-Requests (RFC 5176 section 2.3).
+	if !VerifyAccountingRequest(req.Packet, req.Secret) {
+		log.Printf("radius: dropping %s from %v with invalid authenticator", req.Packet.Code, req.RemoteAddr)
+		return nil
+	}
+
+	err := apply(req)
+	if err == nil {
+		return req.Response(ack)
+	}
+
+	response := req.Response(nak)
+	var daErr *DAError
+	if errors.As(err, &daErr) && daErr.Cause != 0 {
+		cause := make([]byte, 4)
+		binary.BigEndian.PutUint32(cause, uint32(daErr.Cause))
+		response.AddAttribute(ErrorCause, cause)
+	} else {
+		log.Println(err)
+	}
+	return response
+}
+
+// NASSession is a session of a SessionTable.
+type NASSession struct {
+	DASession
+
+	// Attributes holds the authorization of the session, updated by CoA-Requests.
+	Attributes Pairs
+}
+
+// SessionTable is an in-memory table of sessions implementing DynamicAuthorizer, to emulate a NAS.
+type SessionTable struct {
+	mu       sync.Mutex
+	sessions []*NASSession
+}
+
+// daIdentification lists the attributes identifying the sessions a Dynamic Authorization request applies to.
+var daIdentification = map[Attribute]bool{
+	UserName:         true,
+	AcctSessionID:    true,
+	NASIPAddress:     true,
+	NASIdentifier:    true,
+	FramedIPAddress:  true,
+	CallingStationID: true,
+}
+
+// daIgnored lists the attributes of a CoA-Request that do not change the authorization of a session.
+var daIgnored = map[Attribute]bool{
+	EventTimestamp:       true,
+	MessageAuthenticator: true,
+	ProxyState:           true,
+	State:                true,
+}
+
+// Add adds a session with the given authorization to the table.
+func (t *SessionTable) Add(session DASession, attributes Pairs) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sessions = append(t.sessions, &NASSession{DASession: session, Attributes: append(Pairs(nil), attributes...)})
+}
+
+// Sessions returns a copy of the sessions of the table.
+func (t *SessionTable) Sessions() []NASSession {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sessions := make([]NASSession, len(t.sessions))
+	for i, session := range t.sessions {
+		sessions[i] = *session
+		sessions[i].Attributes = append(Pairs(nil), session.Attributes...)
+	}
+	return sessions
+}
+
+// Disconnect removes the sessions identified by req.
+func (t *SessionTable) Disconnect(req *Request) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	matched, err := t.match(req)
+	if err != nil {
+		return err
+	}
+
+	kept := t.sessions[:0]
+	for _, session := range t.sessions {
+		if !matched[session] {
+			kept = append(kept, session)
+		}
+	}
+	t.sessions = kept
+
+	return nil
+}
+
+// ChangeOfAuthorization replaces the attributes carried by req in the authorization of the sessions it identifies.
+func (t *SessionTable) ChangeOfAuthorization(req *Request) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	matched, err := t.match(req)
+	if err != nil {
+		return err
+	}
+
+	var changes Pairs
+	walkAttributes(req.Packet.Attributes, func(key Attribute, value []byte) {
+		if daIdentification[key] || daIgnored[key] {
+			return
+		}
+		var single Packet
+		single.AddAttribute(key, value)
+		changes = append(changes, DefaultDictionary.Pairs(&single)...)
+	})
+
+	for session := range matched {
+		for _, change := range changes {
+			session.Attributes = session.Attributes.Merge(Pair{change.Attribute, OpSet, change.Value})
+		}
+	}
+
+	return nil
+}
+
+// match returns the sessions identified by req.
+func (t *SessionTable) match(req *Request) (map[*NASSession]bool, error) {
+	attributes := req.Attributes()
+	nak := Code(CoANAK)
+	if req.Packet.Code == DisconnectRequest {
+		nak = DisconnectNAK
+	}
+
+	identified := false
+	for _, key := range []Attribute{UserName, AcctSessionID, FramedIPAddress, CallingStationID} {
+		if _, ok := attributes[key]; ok {
+			identified = true
+		}
+	}
+	if !identified {
+		return nil, &DAError{Code: nak, Cause: CauseMissingAttribute}
+	}
+
+	matched := make(map[*NASSession]bool)
+	for _, session := range t.sessions {
+		if session.matches(attributes) {
+			matched[session] = true
+		}
+	}
+	if len(matched) == 0 {
+		return nil, &DAError{Code: nak, Cause: CauseSessionContextNotFound}
+	}
+
+	return matched, nil
+}
+
+// matches reports whether every identification attribute of a request is that of the session.
+func (s *NASSession) matches(attributes Attributes) bool {
+	text := map[Attribute]string{
+		UserName:         s.UserName,
+		AcctSessionID:    s.AcctSessionID,
+		NASIdentifier:    s.NASIdentifier,
+		CallingStationID: s.CallingStationID,
+	}
+	for key, value := range text {
+		if requested, ok := attributes[key]; ok && string(requested) != value {
+			return false
+		}
+	}
+
+	addresses := map[Attribute]net.IP{
+		NASIPAddress:    s.NASIPAddress.To4(),
+		FramedIPAddress: s.FramedIPAddress.To4(),
+	}
+	for key, value := range addresses {
+		if requested, ok := attributes[key]; ok && !bytes.Equal(requested, value) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,92 @@
+package radius
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestClientDynamicAuthorization(t *testing.T) {
+	mux := NewServeMux()
+	mux.HandleFunc(DisconnectRequest, func(req *Request) *Packet {
+		if !VerifyAccountingRequest(req.Packet, req.Secret) {
+			return nil
+		}
+		if string(req.Attributes()[AcctSessionID]) != "s1" {
+			response := req.Response(DisconnectNAK)
+			DefaultDictionary.AddAttribute(response, "Error-Cause", "Session-Context-Not-Found")
+			return response
+		}
+		return req.Response(DisconnectACK)
+	})
+	mux.HandleFunc(CoARequest, func(req *Request) *Packet {
+		if !VerifyAccountingRequest(req.Packet, req.Secret) {
+			return nil
+		}
+		if string(req.Attributes()[FilterID]) != "10mbit" {
+			return req.Response(CoANAK)
+		}
+		return req.Response(CoAACK)
+	})
+	addr := listenTestServer(t, &Server{Secret: secret, Handler: mux})
+
+	client := &Client{}
+	defer client.Close()
+	ctx := context.Background()
+
+	if err := client.Disconnect(ctx, addr, secret, DASession{UserName: "alice", AcctSessionID: "s1"}); err != nil {
+		t.Errorf("Disconnect of existing session returned %v", err)
+	}
+
+	err := client.Disconnect(ctx, addr, secret, DASession{UserName: "alice", AcctSessionID: "s2"})
+	if daErr, ok := err.(*DAError); !ok || daErr.Code != DisconnectNAK || daErr.Cause != CauseSessionContextNotFound {
+		t.Errorf("Disconnect of unknown session returned %v, want a Disconnect-NAK for Session-Context-Not-Found", err)
+	} else if err.Error() != "radius: Disconnect-NAK: Session-Context-Not-Found" {
+		t.Errorf("DAError.Error() == %q", err.Error())
+	}
+
+	if err := client.ChangeOfAuthorization(ctx, addr, secret, DASession{AcctSessionID: "s1"}, Pairs{{"Filter-Id", OpSet, "10mbit"}}); err != nil {
+		t.Errorf("ChangeOfAuthorization returned %v", err)
+	}
+	err = client.ChangeOfAuthorization(ctx, addr, secret, DASession{AcctSessionID: "s1"}, nil)
+	if daErr, ok := err.(*DAError); !ok || daErr.Code != CoANAK || daErr.Cause != 0 {
+		t.Errorf("ChangeOfAuthorization without Filter-Id returned %v, want a CoA-NAK", err)
+	}
+}
+
+func TestSessionTable(t *testing.T) {
+	table := &SessionTable{}
+	table.Add(DASession{UserName: "alice", AcctSessionID: "s1", FramedIPAddress: net.IPv4(192, 0, 2, 10)}, Pairs{{"Filter-Id", OpSet, "1mbit"}})
+	table.Add(DASession{UserName: "bob", AcctSessionID: "s2"}, nil)
+
+	srv := NewDAServer(secret, table)
+	addr := listenTestServer(t, srv)
+
+	client := &Client{}
+	defer client.Close()
+	ctx := context.Background()
+
+	if err := client.ChangeOfAuthorization(ctx, addr, secret, DASession{FramedIPAddress: net.IPv4(192, 0, 2, 10)}, Pairs{{"Filter-Id", OpSet, "10mbit"}, {"Session-Timeout", OpSet, "60"}}); err != nil {
+		t.Errorf("ChangeOfAuthorization returned %v", err)
+	}
+	alice := table.Sessions()[0]
+	if filter, _ := alice.Attributes.Lookup("Filter-Id"); filter != "10mbit" || len(alice.Attributes) != 2 {
+		t.Errorf("authorization after CoA-Request == %v, want Filter-Id 10mbit and a Session-Timeout", alice.Attributes)
+	}
+
+	err := client.Disconnect(ctx, addr, secret, DASession{UserName: "alice", AcctSessionID: "s2"})
+	if daErr, ok := err.(*DAError); !ok || daErr.Code != DisconnectNAK || daErr.Cause != CauseSessionContextNotFound {
+		t.Errorf("Disconnect of mismatched session returned %v, want Session-Context-Not-Found", err)
+	}
+	err = client.Disconnect(ctx, addr, secret, DASession{NASIdentifier: "nas"})
+	if daErr, ok := err.(*DAError); !ok || daErr.Cause != CauseMissingAttribute {
+		t.Errorf("Disconnect without session identification returned %v, want Missing-Attribute", err)
+	}
+
+	if err := client.Disconnect(ctx, addr, secret, DASession{AcctSessionID: "s2"}); err != nil {
+		t.Errorf("Disconnect returned %v", err)
+	}
+	if sessions := table.Sessions(); len(sessions) != 1 || sessions[0].UserName != "alice" {
+		t.Errorf("sessions after Disconnect == %v, want only alice", sessions)
+	}
+}
@@ -0,0 +1,471 @@
+package radius
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DetailRotation selects how often a DetailWriter starts a new file.
+type DetailRotation int
+
+// Rotation periods of detail files.
+const (
+	RotateNever DetailRotation = iota
+	RotateHourly
+	RotateDaily
+)
+
+// Attributes written to detail files by FreeRADIUS in addition to those of the request.
+const (
+	detailClientIPAddress = "Client-IP-Address"
+	detailTimestamp       = "Timestamp"
+	detailPacketType      = "Packet-Type"
+	detailUniqueID        = "Acct-Unique-Session-Id"
+)
+
+// detailInternal lists FreeRADIUS internal attributes that may appear in detail files but are not sent on the wire.
+var detailInternal = map[string]bool{
+	"acct-unique-session-id":    true,
+	"packet-src-ip-address":     true,
+	"packet-dst-ip-address":     true,
+	"packet-src-ipv6-address":   true,
+	"packet-dst-ipv6-address":   true,
+	"packet-src-port":           true,
+	"packet-dst-port":           true,
+	"packet-original-timestamp": true,
+	"packet-transmit-counter":   true,
+	"realm":                     true,
+	"stripped-user-name":        true,
+}
+
+// DetailWriter appends requests to text files in the FreeRADIUS detail format, for auditing and replay.
+type DetailWriter struct {
+	// Directory holds the detail files, named "detail", "detail-YYYYMMDDHH" or "detail-YYYYMMDD" following Rotation.
+	Directory string
+	Rotation  DetailRotation
+
+	// Auth also records Access-Requests, without their passwords.
+	Auth bool
+
+	// Dictionary is used to write attribute values. If nil, DefaultDictionary is used.
+	Dictionary *Dictionary
+
+	file rotatingFile
+}
+
+func (w *DetailWriter) dictionary() *Dictionary {
+	if w.Dictionary == nil {
+		return DefaultDictionary
+	}
+	return w.Dictionary
+}
+
+// filename returns the name of the file an entry received at t belongs to.
+func (w *DetailWriter) filename(t time.Time) string {
+	return w.Rotation.filename(filepath.Join(w.Directory, "detail"), t)
+}
+
+// Write appends req, received at the given time, to the current detail file.
+func (w *DetailWriter) Write(req *Request, received time.Time) error {
+	return w.file.write(w.filename(received), w.format(req, received))
+}
+
+// Close closes the current detail file.
+func (w *DetailWriter) Close() error {
+	return w.file.close()
+}
+
+// filename returns the name of the file starting with base that an entry written at t belongs to.
+func (r DetailRotation) filename(base string, t time.Time) string {
+	switch r {
+	case RotateHourly:
+		return base + "-" + t.Format("2006010215")
+	case RotateDaily:
+		return base + "-" + t.Format("20060102")
+	}
+	return base
+}
+
+// rotatingFile appends entries to a file, reopened whenever the name entries belong to changes.
+type rotatingFile struct {
+	mu   sync.Mutex
+	file *os.File
+	name string
+}
+
+// write appends b to the file called name, closing the previous file if it had another name.
+func (f *rotatingFile) write(name string, b []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil || name != f.name {
+		if f.file != nil {
+			f.file.Close()
+			f.file = nil
+		}
+		file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		f.file, f.name = file, name
+	}
+
+	_, err := f.file.Write(b)
+	return err
+}
+
+// close closes the current file.
+func (f *rotatingFile) close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// format renders a detail entry for req.
+func (w *DetailWriter) format(req *Request, received time.Time) []byte {
+	var b bytes.Buffer
+
+	b.WriteString(received.Format(time.ANSIC))
+	b.WriteByte('\n')
+
+	if req.Packet.Code != AccountingRequest {
+		fmt.Fprintf(&b, "\t%s = %s\n", detailPacketType, req.Packet.Code)
+	}
+
+	for _, p := range w.dictionary().Pairs(&req.Packet) {
+		name, _, _ := splitTag(p.Attribute)
+		def, _ := w.dictionary().Lookup(name)
+		if def != nil && def.Vendor == 0 && (def.Attribute == UserPassword || def.Attribute == CHAPPassword) {
+			continue
+		}
+
+		value := p.Value
+		if def != nil && def.Type == TypeString {
+			value = quoteDetail(value)
+		}
+		fmt.Fprintf(&b, "\t%s = %s\n", p.Attribute, value)
+	}
+
+	if ip := hostIP(req.RemoteAddr); ip != nil {
+		fmt.Fprintf(&b, "\t%s = %s\n", detailClientIPAddress, ip)
+	}
+	if req.Packet.Code == AccountingRequest {
+		fmt.Fprintf(&b, "\t%s = %s\n", detailUniqueID, quoteDetail(NewAccountingRecord(req, received).UniqueID))
+	}
+	fmt.Fprintf(&b, "\t%s = %d\n\n", detailTimestamp, received.Unix())
+
+	return b.Bytes()
+}
+
+// Handler returns a Handler recording Accounting-Requests with a valid authenticator, and Access-Requests if Auth
+// is set, before passing them to next. Accounting-Requests which could not be recorded are not answered.
+func (w *DetailWriter) Handler(next Handler) Handler {
+	return HandlerFunc(func(req *Request) *Packet {
+		switch req.Packet.Code {
+		case AccountingRequest:
+			if !VerifyAccountingRequest(req.Packet, req.Secret) {
+				break
+			}
+			if err := w.Write(req, time.Now()); err != nil {
+				log.Println(err)
+				return nil
+			}
+		case AccessRequest:
+			if !w.Auth {
+				break
+			}
+			if err := w.Write(req, time.Now()); err != nil {
+				log.Println(err)
+			}
+		}
+
+		return next.ServeRADIUS(req)
+	})
+}
+
+// quoteDetail quotes a string value the way FreeRADIUS does, escaping non-printable bytes in octal.
+func quoteDetail(s string) string {
+	var b strings.Builder
+
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&b, "\\%03o", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+
+	return b.String()
+}
+
+// unquoteDetail reverses quoteDetail, also accepting the \n, \r and \t escapes.
+func unquoteDetail(s string) (string, error) {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s, nil
+	}
+	s = s[1 : len(s)-1]
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		if i == len(s) {
+			return "", errMalformedDetail
+		}
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case '0', '1', '2', '3':
+			if i+3 > len(s) {
+				return "", errMalformedDetail
+			}
+			n, err := strconv.ParseUint(s[i:i+3], 8, 8)
+			if err != nil {
+				return "", errMalformedDetail
+			}
+			b.WriteByte(byte(n))
+			i += 2
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return b.String(), nil
+}
+
+var errMalformedDetail = errors.New("radius: malformed detail file")
+
+// DetailEntry is a request read from a detail file.
+type DetailEntry struct {
+	// Time is when the request was received.
+	Time     time.Time
+	Code     Code
+	ClientIP net.IP
+	// Pairs holds the attributes of the request.
+	Pairs Pairs
+}
+
+// Packet builds the request of the entry, encoding its attributes with dictionary.
+func (e *DetailEntry) Packet(dictionary *Dictionary) (*Packet, error) {
+	packet := &Packet{Code: e.Code}
+	if err := dictionary.AddPairs(packet, e.Pairs); err != nil {
+		return nil, err
+	}
+	return packet, nil
+}
+
+// DetailReader reads the entries of a detail file.
+type DetailReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewDetailReader returns a DetailReader reading from r.
+func NewDetailReader(r io.Reader) *DetailReader {
+	return &DetailReader{scanner: bufio.NewScanner(r)}
+}
+
+// Next returns the next entry, or io.EOF at the end of the file.
+func (r *DetailReader) Next() (*DetailEntry, error) {
+	var entry *DetailEntry
+
+	for r.scanner.Scan() {
+		r.line++
+		line := r.scanner.Text()
+
+		if strings.TrimSpace(line) == "" {
+			if entry != nil {
+				return entry, nil
+			}
+			continue
+		}
+
+		if line[0] != ' ' && line[0] != '\t' {
+			if entry != nil {
+				return nil, fmt.Errorf("%v: line %d: missing blank line between entries", errMalformedDetail, r.line)
+			}
+			t, err := time.ParseInLocation(time.ANSIC, strings.TrimSpace(line), time.Local)
+			if err != nil {
+				return nil, fmt.Errorf("%v: line %d: %v", errMalformedDetail, r.line, err)
+			}
+			entry = &DetailEntry{Time: t, Code: AccountingRequest}
+			continue
+		}
+
+		if entry == nil {
+			return nil, fmt.Errorf("%v: line %d: attribute before timestamp", errMalformedDetail, r.line)
+		}
+
+		i := strings.Index(line, " = ")
+		if i < 0 {
+			return nil, fmt.Errorf("%v: line %d: %q", errMalformedDetail, r.line, line)
+		}
+		name := strings.TrimSpace(line[:i])
+		value, err := unquoteDetail(strings.TrimSpace(line[i+3:]))
+		if err != nil {
+			return nil, fmt.Errorf("%v: line %d", err, r.line)
+		}
+
+		switch {
+		case strings.EqualFold(name, detailTimestamp):
+			if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+				entry.Time = time.Unix(seconds, 0)
+			}
+		case strings.EqualFold(name, detailClientIPAddress):
+			entry.ClientIP = net.ParseIP(value)
+		case strings.EqualFold(name, detailPacketType):
+			code, ok := codeByName(value)
+			if !ok {
+				return nil, fmt.Errorf("%v: line %d: unknown packet type %q", errMalformedDetail, r.line, value)
+			}
+			entry.Code = code
+		case detailInternal[strings.ToLower(name)]:
+		default:
+			entry.Pairs = append(entry.Pairs, Pair{name, OpEqual, value})
+		}
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		return entry, nil
+	}
+	return nil, io.EOF
+}
+
+// codeByName returns the Code called name.
+func codeByName(name string) (Code, bool) {
+	for code, text := range codeText {
+		if strings.EqualFold(text, name) {
+			return code, true
+		}
+	}
+	return 0, false
+}
+
+// ReplayDetail reads the Accounting-Requests of a detail file and passes each to handler as a signed request from
+// its original client, with Acct-Delay-Time increased by the time elapsed since it was received. It stops at the
+// first request the handler does not acknowledge and returns the number of requests acknowledged.
+func ReplayDetail(r io.Reader, handler Handler, secret string, dictionary *Dictionary) (int, error) {
+	if dictionary == nil {
+		dictionary = DefaultDictionary
+	}
+
+	reader := NewDetailReader(r)
+	replayed := 0
+
+	for identifier := 0; ; identifier = (identifier + 1) % 256 {
+		entry, err := reader.Next()
+		if err == io.EOF {
+			return replayed, nil
+		}
+		if err != nil {
+			return replayed, err
+		}
+		if entry.Code != AccountingRequest {
+			continue
+		}
+
+		delay := int64(time.Since(entry.Time) / time.Second)
+		if value, ok := entry.Pairs.Lookup("Acct-Delay-Time"); ok {
+			previous, _ := strconv.ParseInt(value, 10, 64)
+			delay += previous
+		}
+		if delay < 0 {
+			delay = 0
+		}
+		pairs := append(Pairs(nil), entry.Pairs...).Merge(Pair{"Acct-Delay-Time", OpSet, strconv.FormatInt(delay, 10)})
+
+		packet := &Packet{Code: AccountingRequest, Identifier: identifier}
+		if err := dictionary.AddPairs(packet, pairs); err != nil {
+			return replayed, err
+		}
+		SignAccountingRequest(packet, secret)
+
+		req := &Request{Packet: *packet, Secret: secret}
+		if entry.ClientIP != nil {
+			req.RemoteAddr = &net.UDPAddr{IP: entry.ClientIP}
+		}
+
+		response := handler.ServeRADIUS(req)
+		if response == nil || response.Code != AccountingResponse {
+			return replayed, fmt.Errorf("radius: detail entry of %s not acknowledged", entry.Time.Format(time.ANSIC))
+		}
+		replayed++
+	}
+}
+
+// ForwardDetail replays the Accounting-Requests of a detail file to the RADIUS server at addr, like ReplayDetail.
+// Each request is sent up to retries times, waiting timeout for the Accounting-Response.
+func ForwardDetail(r io.Reader, addr string, secret string, timeout time.Duration, retries int) (int, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	forward := func(req *Request) *Packet {
+		request := req.Packet
+		message := request.packetToBytes()
+		buffer := make([]byte, 4096)
+
+		for attempt := 0; attempt < retries; attempt++ {
+			if _, err := conn.Write(message); err != nil {
+				log.Println(err)
+				return nil
+			}
+
+			conn.SetReadDeadline(time.Now().Add(timeout))
+			for {
+				n, err := conn.Read(buffer)
+				if err != nil {
+					break
+				}
+				if n < 20 {
+					continue
+				}
+				response := DecodePacket(buffer, n)
+				if response.Identifier == request.Identifier && VerifyResponse(request, response, secret) {
+					return &response
+				}
+			}
+		}
+
+		return nil
+	}
+
+	return ReplayDetail(r, HandlerFunc(forward), secret, nil)
+}
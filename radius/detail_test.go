@@ -0,0 +1,132 @@
+package radius
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetailWriteAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	writer := &DetailWriter{Directory: dir, Rotation: RotateDaily, Auth: true}
+
+	received := time.Now().Add(-30 * time.Second).Truncate(time.Second)
+	accounting := buildAccountingRequest(1, Pairs{
+		{"Acct-Status-Type", OpSet, "Start"},
+		{"Acct-Session-Id", OpSet, "s1"},
+		{"User-Name", OpSet, "al\"ice\n"},
+		{"NAS-IP-Address", OpSet, "10.0.0.1"},
+		{"Acct-Delay-Time", OpSet, "5"},
+		{"Tunnel-Private-Group-Id:1", OpSet, "42"},
+	})
+	// The Client-IP-Address is recorded whatever the transport.
+	accounting.RemoteAddr = &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 2083}
+	access := buildAccessRequest("alice", "wonderland", "10.0.0.1")
+	access.RemoteAddr = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1)}
+
+	if err := writer.Write(accounting, received); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Write(access, received); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+
+	name := filepath.Join(dir, "detail-"+received.Format("20060102"))
+	content, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "User-Password") {
+		t.Errorf("detail file contains a User-Password:\n%s", content)
+	}
+	if !strings.Contains(string(content), "\tUser-Name = \"al\\\"ice\\012\"\n") {
+		t.Errorf("detail file does not quote User-Name like FreeRADIUS:\n%s", content)
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	// Replayed requests are recorded again by the Handler of another writer.
+	replica := &DetailWriter{Directory: t.TempDir()}
+	handler := replica.Handler(HandlerFunc(func(req *Request) *Packet { return req.Response(AccountingResponse) }))
+	defer replica.Close()
+
+	var replayed []*Request
+	n, err := ReplayDetail(file, HandlerFunc(func(req *Request) *Packet {
+		replayed = append(replayed, req)
+		return handler.ServeRADIUS(req)
+	}), "replay", nil)
+	if err != nil || n != 1 {
+		t.Fatalf("ReplayDetail == %d, %v, want 1 replayed Accounting-Request", n, err)
+	}
+
+	req := replayed[0]
+	if !VerifyAccountingRequest(req.Packet, "replay") {
+		t.Errorf("replayed request is not signed with the replay secret")
+	}
+	if req.RemoteAddr.(*net.UDPAddr).IP.String() != "192.0.2.1" {
+		t.Errorf("replayed request comes from %v, want 192.0.2.1", req.RemoteAddr)
+	}
+
+	got := DefaultDictionary.Pairs(&req.Packet)
+	for _, p := range DefaultDictionary.Pairs(&accounting.Packet) {
+		if p.Attribute == "Acct-Delay-Time" {
+			continue
+		}
+		if value, ok := got.Lookup(p.Attribute); !ok || value != p.Value {
+			t.Errorf("replayed %s == %q, want %q", p.Attribute, value, p.Value)
+		}
+	}
+	if delay, _ := got.Lookup("Acct-Delay-Time"); delay < "35" || delay > "40" {
+		t.Errorf("replayed Acct-Delay-Time == %s, want about 35", delay)
+	}
+
+	if _, err := os.Stat(filepath.Join(replica.Directory, "detail")); err != nil {
+		t.Errorf("replayed request not recorded: %v", err)
+	}
+
+	writer.Rotation = RotateHourly
+	if err := writer.Write(accounting, received); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+	if _, err := os.Stat(filepath.Join(dir, "detail-"+received.Format("2006010215"))); err != nil {
+		t.Errorf("hourly detail file not created: %v", err)
+	}
+}
+
+func TestDetailReaderFreeRADIUS(t *testing.T) {
+	const detail = `Fri Jan 26 10:00:00 2024
+	Acct-Status-Type = Stop
+	User-Name = "bob"
+	Event-Timestamp = "Jan 26 2024 10:00:00 UTC"
+	Acct-Session-Time = 60
+	Acct-Unique-Session-Id = "0123"
+	Client-IP-Address = 192.0.2.7
+	Timestamp = 1706263200
+
+`
+
+	entry, err := NewDetailReader(strings.NewReader(detail)).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Time.Unix() != 1706263200 || entry.ClientIP.String() != "192.0.2.7" || len(entry.Pairs) != 4 {
+		t.Errorf("Next() == %v, want the entry of 1706263200 from 192.0.2.7 with 4 attributes", entry)
+	}
+
+	packet, err := entry.Packet(DefaultDictionary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := DefaultDictionary.Pairs(packet); got[2].Value != "1706263200" {
+		t.Errorf("Event-Timestamp == %s, want 1706263200", got[2].Value)
+	}
+}
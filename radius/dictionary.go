@@ -0,0 +1,552 @@
+package radius
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AttributeType is the data type of an attribute value.
+type AttributeType int
+
+// Attribute data types from RFC 2865 and RFC 8044.
+const (
+	TypeString AttributeType = iota
+	TypeOctets
+	TypeInteger
+	TypeIPAddr
+	TypeDate
+	TypeIPv6Addr
+	TypeIPv6Prefix
+	TypeInteger64
+)
+
+var attributeTypeText = map[AttributeType]string{
+	TypeString:     "string",
+	TypeOctets:     "octets",
+	TypeInteger:    "integer",
+	TypeIPAddr:     "ipaddr",
+	TypeDate:       "date",
+	TypeIPv6Addr:   "ipv6addr",
+	TypeIPv6Prefix: "ipv6prefix",
+	TypeInteger64:  "integer64",
+}
+
+func (t AttributeType) String() string {
+	return attributeTypeText[t]
+}
+
+// attrType holds the data type of the attributes known to DefaultDictionary. Attributes not listed are strings.
+var attrType = map[Attribute]AttributeType{
+	UserPassword: TypeOctets,
+	CHAPPassword: TypeOctets,
+
+	NASIPAddress: TypeIPAddr,
+	NASPort:      TypeInteger,
+	ServiceType:  TypeInteger,
+
+	FramedProtocol:    TypeInteger,
+	FramedIPAddress:   TypeIPAddr,
+	FramedIPNetmask:   TypeIPAddr,
+	FramedRouting:     TypeInteger,
+	FramedMTU:         TypeInteger,
+	FramedCompression: TypeInteger,
+
+	LoginIPHost:  TypeIPAddr,
+	LoginService: TypeInteger,
+	LoginTCPPort: TypeInteger,
+
+	FramedIPXNetwork: TypeIPAddr,
+
+	State:              TypeOctets,
+	Class:              TypeOctets,
+	VendorSpecific:     TypeOctets,
+	SessionTimeout:     TypeInteger,
+	IdleTimeout:        TypeInteger,
+	TerminiationAction: TypeInteger,
+	ProxyState:         TypeOctets,
+
+	FramedAppleTalkLink:    TypeInteger,
+	FramedAppleTalkNetwork: TypeInteger,
+
+	AcctStatusType:      TypeInteger,
+	AcctDelayTime:       TypeInteger,
+	AcctInputOctets:     TypeInteger,
+	AcctOutputOctets:    TypeInteger,
+	AcctAuthentic:       TypeInteger,
+	AcctSessionTime:     TypeInteger,
+	AcctInputPackets:    TypeInteger,
+	AcctOutputPackets:   TypeInteger,
+	AcctTerminateCause:  TypeInteger,
+	AcctLinkCount:       TypeInteger,
+	AcctInputGigawords:  TypeInteger,
+	AcctOutputGigawords: TypeInteger,
+	EventTimestamp:      TypeDate,
+
+	CHAPChallenge: TypeOctets,
+	NASPortType:   TypeInteger,
+	PortLimit:     TypeInteger,
+
+	TunnelType:       TypeInteger,
+	TunnelMediumType: TypeInteger,
+
+	// Tunnel-Password carries a tag and salt before its encrypted value, see HideTunnelPassword.
+	TunnelPassword: TypeOctets,
+
+	MessageAuthenticator: TypeOctets,
+
+	AcctInterimInterval: TypeInteger,
+
+	ErrorCause: TypeInteger,
+}
+
+// attrTagged lists the attributes of DefaultDictionary carrying an RFC 2868 tag.
+var attrTagged = map[Attribute]bool{
+	TunnelType:           true,
+	TunnelMediumType:     true,
+	TunnelPrivateGroupID: true,
+}
+
+// attrValues holds the names of enumerated values of attributes in DefaultDictionary.
+var attrValues = map[Attribute]map[string]uint32{
+	ServiceType: {
+		"Login-User":              1,
+		"Framed-User":             2,
+		"Callback-Login-User":     3,
+		"Callback-Framed-User":    4,
+		"Outbound-User":           5,
+		"Administrative-User":     6,
+		"NAS-Prompt-User":         7,
+		"Authenticate-Only":       8,
+		"Callback-NAS-Prompt":     9,
+		"Call-Check":              10,
+		"Callback-Administrative": 11,
+	},
+	FramedProtocol: {
+		"PPP":  1,
+		"SLIP": 2,
+	},
+	TunnelType: {
+		"PPTP": 1,
+		"L2F":  2,
+		"L2TP": 3,
+		"GRE":  10,
+		"VLAN": 13,
+	},
+	TunnelMediumType: {
+		"IPv4":     1,
+		"IPv6":     2,
+		"IEEE-802": 6,
+	},
+	AcctStatusType: {
+		"Start":          1,
+		"Stop":           2,
+		"Interim-Update": 3,
+		"Accounting-On":  7,
+		"Accounting-Off": 8,
+	},
+	AcctAuthentic: {
+		"RADIUS": 1,
+		"Local":  2,
+		"Remote": 3,
+	},
+	AcctTerminateCause: {
+		"User-Request":        1,
+		"Lost-Carrier":        2,
+		"Lost-Service":        3,
+		"Idle-Timeout":        4,
+		"Session-Timeout":     5,
+		"Admin-Reset":         6,
+		"Admin-Reboot":        7,
+		"Port-Error":          8,
+		"NAS-Error":           9,
+		"NAS-Request":         10,
+		"NAS-Reboot":          11,
+		"Port-Unneeded":       12,
+		"Port-Preempted":      13,
+		"Port-Suspended":      14,
+		"Service-Unavailable": 15,
+		"Callback":            16,
+		"User-Error":          17,
+		"Host-Request":        18,
+	},
+	ErrorCause: {
+		"Residual-Context-Removed":               201,
+		"Invalid-EAP-Packet":                     202,
+		"Unsupported-Attribute":                  401,
+		"Missing-Attribute":                      402,
+		"NAS-Identification-Mismatch":            403,
+		"Invalid-Request":                        404,
+		"Unsupported-Service":                    405,
+		"Unsupported-Extension":                  406,
+		"Invalid-Attribute-Value":                407,
+		"Administratively-Prohibited":            501,
+		"Proxy-Request-Not-Routable":             502,
+		"Session-Context-Not-Found":              503,
+		"Session-Context-Not-Removable":          504,
+		"Proxy-Processing-Error":                 505,
+		"Resources-Unavailable":                  506,
+		"Request-Initiated":                      507,
+		"Multiple-Session-Selection-Unsupported": 508,
+	},
+}
+
+// freeRADIUSDate is the layout of date attributes in FreeRADIUS users and detail files.
+const freeRADIUSDate = "Jan _2 2006 15:04:05 MST"
+
+// AttributeDefinition describes an attribute known to a Dictionary.
+type AttributeDefinition struct {
+	Name      string
+	Attribute Attribute
+	// Vendor is the SMI Private Enterprise Code of a vendor-specific attribute, or 0 for standard attributes.
+	Vendor uint32
+	Type   AttributeType
+	// Tagged is set for attributes carrying an RFC 2868 tag.
+	Tagged bool
+	// Values maps the names of enumerated integer values to their number.
+	Values map[string]uint32
+}
+
+// Dictionary maps attribute names to their number and type, in the spirit of the FreeRADIUS dictionary.
+type Dictionary struct {
+	byName  map[string]*AttributeDefinition
+	byCode  map[dictionaryKey]*AttributeDefinition
+	vendors map[string]uint32
+}
+
+type dictionaryKey struct {
+	vendor    uint32
+	attribute Attribute
+}
+
+// ErrUnknownAttribute is returned when an attribute name is not in the dictionary.
+var ErrUnknownAttribute = errors.New("radius: unknown attribute")
+
+// DefaultDictionary holds the standard attributes defined by this package and the FreeRADIUS statistics attributes.
+var DefaultDictionary = newDefaultDictionary()
+
+func newDefaultDictionary() *Dictionary {
+	d := NewDictionary()
+	for a, name := range attrText {
+		d.Add(AttributeDefinition{Name: name, Attribute: a, Type: attrType[a], Tagged: attrTagged[a], Values: attrValues[a]})
+	}
+	d.AddVendor("FreeRADIUS", VendorFreeRADIUS)
+	for _, def := range freeRADIUSDefinitions() {
+		d.Add(def)
+	}
+	return d
+}
+
+// NewDictionary returns an empty Dictionary.
+func NewDictionary() *Dictionary {
+	return &Dictionary{
+		byName:  make(map[string]*AttributeDefinition),
+		byCode:  make(map[dictionaryKey]*AttributeDefinition),
+		vendors: make(map[string]uint32),
+	}
+}
+
+// Add adds def to the dictionary, replacing any definition with the same name or number.
+func (d *Dictionary) Add(def AttributeDefinition) {
+	def.Values = copyValues(def.Values)
+	d.byName[strings.ToLower(def.Name)] = &def
+	d.byCode[dictionaryKey{def.Vendor, def.Attribute}] = &def
+}
+
+// AddVendor records the name of a vendor's Private Enterprise Code.
+func (d *Dictionary) AddVendor(name string, vendor uint32) {
+	d.vendors[strings.ToLower(name)] = vendor
+}
+
+// Vendor returns the Private Enterprise Code of a named vendor.
+func (d *Dictionary) Vendor(name string) (vendor uint32, ok bool) {
+	vendor, ok = d.vendors[strings.ToLower(name)]
+	return
+}
+
+// Lookup returns the definition of the attribute called name. Names are case-insensitive. Attributes missing
+// from the dictionary may be named "Attr-N" or "Vendor-V-Attr-N" and are then handled as octets.
+func (d *Dictionary) Lookup(name string) (*AttributeDefinition, bool) {
+	def, ok := d.byName[strings.ToLower(name)]
+	if !ok {
+		return rawDefinition(name)
+	}
+	return def, ok
+}
+
+// rawDefinition returns an octets definition for an attribute named "Attr-N" or "Vendor-V-Attr-N".
+func rawDefinition(name string) (*AttributeDefinition, bool) {
+	var vendor, a uint32
+	if n, _ := fmt.Sscanf(name, "Vendor-%d-Attr-%d", &vendor, &a); n == 2 && a <= 255 {
+		return &AttributeDefinition{Name: name, Attribute: Attribute(a), Vendor: vendor, Type: TypeOctets}, true
+	}
+	if n, _ := fmt.Sscanf(name, "Attr-%d", &a); n == 1 && a <= 255 {
+		return &AttributeDefinition{Name: name, Attribute: Attribute(a), Type: TypeOctets}, true
+	}
+	return nil, false
+}
+
+// definitionOrRaw returns the definition of an attribute, or a raw octets definition if it is unknown.
+func (d *Dictionary) definitionOrRaw(vendor uint32, a Attribute) *AttributeDefinition {
+	if def, ok := d.Definition(vendor, a); ok {
+		return def
+	}
+	if vendor != 0 {
+		return &AttributeDefinition{Name: fmt.Sprintf("Vendor-%d-Attr-%d", vendor, a), Attribute: a, Vendor: vendor, Type: TypeOctets}
+	}
+	return &AttributeDefinition{Name: fmt.Sprintf("Attr-%d", a), Attribute: a, Type: TypeOctets}
+}
+
+// Definition returns the definition of attribute a of vendor, where vendor 0 means a standard attribute.
+func (d *Dictionary) Definition(vendor uint32, a Attribute) (*AttributeDefinition, bool) {
+	def, ok := d.byCode[dictionaryKey{vendor, a}]
+	return def, ok
+}
+
+// Clone returns a copy of d which may be extended without changing d.
+func (d *Dictionary) Clone() *Dictionary {
+	c := NewDictionary()
+	for _, def := range d.byCode {
+		c.Add(*def)
+	}
+	for name, vendor := range d.vendors {
+		c.vendors[name] = vendor
+	}
+	return c
+}
+
+func copyValues(values map[string]uint32) map[string]uint32 {
+	if values == nil {
+		return nil
+	}
+	c := make(map[string]uint32, len(values))
+	for k, v := range values {
+		c[k] = v
+	}
+	return c
+}
+
+// splitTag separates an RFC 2868 tag from an attribute name written as "Name:tag".
+func splitTag(name string) (string, byte, error) {
+	i := strings.LastIndexByte(name, ':')
+	if i < 0 {
+		return name, 0, nil
+	}
+	tag, err := strconv.ParseUint(name[i+1:], 10, 8)
+	if err != nil || tag > 0x1f {
+		return "", 0, fmt.Errorf("radius: invalid tag in %q", name)
+	}
+	return name[:i], byte(tag), nil
+}
+
+// Encode converts the textual value of an attribute to its wire format. For tagged attributes tag is included.
+func (def *AttributeDefinition) Encode(value string, tag byte) ([]byte, error) {
+	var b []byte
+
+	switch def.Type {
+	case TypeString:
+		b = []byte(value)
+
+	case TypeOctets:
+		if strings.HasPrefix(value, "0x") {
+			var err error
+			if b, err = hex.DecodeString(value[2:]); err != nil {
+				return nil, fmt.Errorf("radius: invalid octets for %s: %v", def.Name, err)
+			}
+		} else {
+			b = []byte(value)
+		}
+
+	case TypeInteger, TypeDate:
+		n, ok := def.Values[value]
+		if !ok {
+			parsed, err := strconv.ParseUint(value, 0, 32)
+			if err != nil && def.Type == TypeDate {
+				// Dates as written by FreeRADIUS, such as "Jan  2 2006 15:04:05 UTC".
+				var t time.Time
+				if t, err = time.Parse(freeRADIUSDate, value); err == nil {
+					parsed = uint64(t.Unix())
+				}
+			}
+			if err != nil {
+				return nil, fmt.Errorf("radius: invalid %s for %s: %q", def.Type, def.Name, value)
+			}
+			n = uint32(parsed)
+		}
+		b = make([]byte, 4)
+		binary.BigEndian.PutUint32(b, n)
+		if def.Tagged {
+			b[0] = tag
+		}
+		return b, nil
+
+	case TypeInteger64:
+		n, err := strconv.ParseUint(value, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("radius: invalid integer64 for %s: %q", def.Name, value)
+		}
+		b = make([]byte, 8)
+		binary.BigEndian.PutUint64(b, n)
+
+	case TypeIPAddr:
+		ip := net.ParseIP(value).To4()
+		if ip == nil {
+			return nil, fmt.Errorf("radius: invalid ipaddr for %s: %q", def.Name, value)
+		}
+		b = []byte(ip)
+
+	case TypeIPv6Addr:
+		ip := net.ParseIP(value)
+		if ip == nil || ip.To4() != nil {
+			return nil, fmt.Errorf("radius: invalid ipv6addr for %s: %q", def.Name, value)
+		}
+		b = []byte(ip.To16())
+
+	case TypeIPv6Prefix:
+		_, prefix, err := net.ParseCIDR(value)
+		if err != nil || prefix.IP.To4() != nil {
+			return nil, fmt.Errorf("radius: invalid ipv6prefix for %s: %q", def.Name, value)
+		}
+		ones, _ := prefix.Mask.Size()
+		b = append([]byte{0, byte(ones)}, prefix.IP[:(ones+7)/8]...)
+	}
+
+	if def.Tagged && tag != 0 {
+		b = append([]byte{tag}, b...)
+	}
+
+	return b, nil
+}
+
+// Format converts the wire format of an attribute value to text, the inverse of Encode.
+// The tag of tagged attributes is returned separately.
+func (def *AttributeDefinition) Format(b []byte) (value string, tag byte) {
+	if def.Tagged && len(b) > 0 && b[0] <= 0x1f {
+		if def.Type == TypeInteger {
+			tag = b[0]
+			b = append([]byte{0}, b[1:]...)
+		} else if b[0] != 0 {
+			tag, b = b[0], b[1:]
+		}
+	}
+
+	switch def.Type {
+	case TypeString:
+		return string(b), tag
+
+	case TypeInteger, TypeDate:
+		if len(b) != 4 {
+			break
+		}
+		n := binary.BigEndian.Uint32(b)
+		for name, v := range def.Values {
+			if v == n {
+				return name, tag
+			}
+		}
+		return strconv.FormatUint(uint64(n), 10), tag
+
+	case TypeInteger64:
+		if len(b) != 8 {
+			break
+		}
+		return strconv.FormatUint(binary.BigEndian.Uint64(b), 10), tag
+
+	case TypeIPAddr:
+		if len(b) != net.IPv4len {
+			break
+		}
+		return net.IP(b).String(), tag
+
+	case TypeIPv6Addr:
+		if len(b) != net.IPv6len {
+			break
+		}
+		return net.IP(b).String(), tag
+
+	case TypeIPv6Prefix:
+		if len(b) < 2 || int(b[1]) > 128 || len(b)-2 > net.IPv6len {
+			break
+		}
+		ip := make(net.IP, net.IPv6len)
+		copy(ip, b[2:])
+		return fmt.Sprintf("%s/%d", ip, b[1]), tag
+	}
+
+	return "0x" + hex.EncodeToString(b), tag
+}
+
+// Encode converts an attribute written as "Name" or "Name:tag" with a textual value to its
+// definition and wire format using the dictionary.
+func (d *Dictionary) Encode(name string, value string) (*AttributeDefinition, []byte, error) {
+	name, tag, err := splitTag(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	def, ok := d.Lookup(name)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s", ErrUnknownAttribute, name)
+	}
+
+	b, err := def.Encode(value, tag)
+	if err != nil {
+		return nil, nil, err
+	}
+	if def.Vendor != 0 && len(b) > maxVendorValue {
+		return nil, nil, fmt.Errorf("radius: %s value is longer than %d bytes", def.Name, maxVendorValue)
+	}
+
+	return def, b, nil
+}
+
+// AddAttribute encodes the attribute called name with value and appends it to packet, wrapping
+// vendor-specific attributes in a Vendor-Specific attribute.
+func (d *Dictionary) AddAttribute(packet *Packet, name string, value string) error {
+	def, b, err := d.Encode(name, value)
+	if err != nil {
+		return err
+	}
+
+	if def.Vendor != 0 {
+		packet.AddVendorAttribute(def.Vendor, def.Attribute, b)
+		return nil
+	}
+
+	packet.AddAttribute(def.Attribute, b)
+	return nil
+}
+
+// Pairs converts every attribute of packet to text, in order, splitting Vendor-Specific attributes into the
+// vendor attributes they carry. Tagged attributes are named "Name:tag".
+func (d *Dictionary) Pairs(packet *Packet) Pairs {
+	var pairs Pairs
+
+	add := func(def *AttributeDefinition, value []byte) {
+		text, tag := def.Format(value)
+		name := def.Name
+		if tag != 0 {
+			name += ":" + strconv.Itoa(int(tag))
+		}
+		pairs = append(pairs, Pair{name, OpEqual, text})
+	}
+
+	walkAttributes(packet.Attributes, func(key Attribute, value []byte) {
+		if key != VendorSpecific || len(value) < 4 {
+			add(d.definitionOrRaw(0, key), value)
+			return
+		}
+
+		vendor := binary.BigEndian.Uint32(value)
+		walkAttributes(value[4:], func(key Attribute, value []byte) {
+			add(d.definitionOrRaw(vendor, key), value)
+		})
+	})
+
+	return pairs
+}
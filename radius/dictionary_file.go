@@ -0,0 +1,201 @@
+package radius
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// maxDictionaryIncludes bounds the nesting of $INCLUDE directives, to stop include loops.
+const maxDictionaryIncludes = 16
+
+// dictionaryTypes maps the data types of FreeRADIUS dictionaries to the types of this package. Other types are
+// loaded as octets.
+var dictionaryTypes = map[string]AttributeType{
+	"string":     TypeString,
+	"octets":     TypeOctets,
+	"integer":    TypeInteger,
+	"signed":     TypeInteger,
+	"ipaddr":     TypeIPAddr,
+	"date":       TypeDate,
+	"ipv6addr":   TypeIPv6Addr,
+	"ipv6prefix": TypeIPv6Prefix,
+	"integer64":  TypeInteger64,
+}
+
+// LoadFile adds the vendors, attributes and values defined in name, a dictionary in the FreeRADIUS format, to d.
+// It understands the ATTRIBUTE, VALUE, VENDOR, BEGIN-VENDOR, END-VENDOR and $INCLUDE directives, with included
+// files looked up relative to the including one. Attributes numbered above 255 or with nested numbers, such as
+// TLVs, are skipped.
+func (d *Dictionary) LoadFile(name string) error {
+	return d.loadFile(name, 0)
+}
+
+func (d *Dictionary) loadFile(name string, depth int) error {
+	if depth > maxDictionaryIncludes {
+		return fmt.Errorf("radius: %s: too many nested $INCLUDE", name)
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	parser := dictionaryParser{dictionary: d, name: name, depth: depth, skipped: make(map[string]bool)}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		parser.line++
+		if err := parser.parse(scanner.Text()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// dictionaryParser holds the state of the dictionary file being loaded.
+type dictionaryParser struct {
+	dictionary *Dictionary
+	name       string
+	line       int
+	depth      int
+
+	// vendor is the vendor of the BEGIN-VENDOR block being read, or 0.
+	vendor uint32
+	// skipped holds the names of the attributes that were skipped, whose values are skipped too.
+	skipped map[string]bool
+}
+
+// errorf returns an error located at the current line.
+func (p *dictionaryParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("radius: %s:%d: %s", p.name, p.line, fmt.Sprintf(format, args...))
+}
+
+// parse reads one line of a dictionary file.
+func (p *dictionaryParser) parse(line string) error {
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	switch keyword := fields[0]; keyword {
+	case "$INCLUDE", "$INCLUDE-":
+		if len(fields) != 2 {
+			return p.errorf("%s takes a file name", keyword)
+		}
+		name := fields[1]
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(filepath.Dir(p.name), name)
+		}
+		err := p.dictionary.loadFile(name, p.depth+1)
+		if keyword == "$INCLUDE-" && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+
+	case "VENDOR":
+		if len(fields) < 3 {
+			return p.errorf("VENDOR takes a name and a number")
+		}
+		vendor, err := strconv.ParseUint(fields[2], 0, 32)
+		if err != nil {
+			return p.errorf("invalid vendor number %q", fields[2])
+		}
+		p.dictionary.AddVendor(fields[1], uint32(vendor))
+
+	case "BEGIN-VENDOR":
+		if len(fields) < 2 {
+			return p.errorf("BEGIN-VENDOR takes a vendor name")
+		}
+		vendor, ok := p.dictionary.Vendor(fields[1])
+		if !ok {
+			return p.errorf("unknown vendor %q", fields[1])
+		}
+		p.vendor = vendor
+
+	case "END-VENDOR":
+		p.vendor = 0
+
+	case "ATTRIBUTE":
+		return p.attribute(fields[1:])
+
+	case "VALUE":
+		return p.value(fields[1:])
+
+	default:
+		return p.errorf("unsupported keyword %q", keyword)
+	}
+	return nil
+}
+
+// attribute reads the fields of an ATTRIBUTE line: its name, number, type and optional flags or vendor.
+func (p *dictionaryParser) attribute(fields []string) error {
+	if len(fields) < 3 {
+		return p.errorf("ATTRIBUTE takes a name, a number and a type")
+	}
+	name := fields[0]
+
+	number, err := strconv.ParseUint(fields[1], 0, 32)
+	if err != nil && !strings.Contains(fields[1], ".") {
+		return p.errorf("invalid attribute number %q", fields[1])
+	}
+	if err != nil || number > 255 {
+		p.skipped[strings.ToLower(name)] = true
+		return nil
+	}
+
+	typ, ok := dictionaryTypes[fields[2]]
+	if !ok {
+		typ = TypeOctets
+	}
+	def := AttributeDefinition{Name: name, Attribute: Attribute(number), Vendor: p.vendor, Type: typ}
+
+	if len(fields) > 3 {
+		flags := fields[3]
+		if vendor, ok := p.dictionary.Vendor(flags); ok {
+			// The vendor of attributes outside BEGIN-VENDOR blocks in older dictionaries.
+			def.Vendor = vendor
+		} else {
+			for _, flag := range strings.Split(flags, ",") {
+				if flag == "has_tag" {
+					def.Tagged = true
+				}
+			}
+		}
+	}
+
+	p.dictionary.Add(def)
+	return nil
+}
+
+// value reads the fields of a VALUE line: the attribute name, the value name and its number.
+func (p *dictionaryParser) value(fields []string) error {
+	if len(fields) != 3 {
+		return p.errorf("VALUE takes an attribute name, a value name and a number")
+	}
+	if p.skipped[strings.ToLower(fields[0])] {
+		return nil
+	}
+
+	def, ok := p.dictionary.byName[strings.ToLower(fields[0])]
+	if !ok {
+		return p.errorf("VALUE of unknown attribute %q", fields[0])
+	}
+	number, err := strconv.ParseUint(fields[2], 0, 32)
+	if err != nil {
+		return p.errorf("invalid value number %q", fields[2])
+	}
+
+	if def.Values == nil {
+		def.Values = make(map[string]uint32)
+	}
+	def.Values[fields[1]] = uint32(number)
+	return nil
+}
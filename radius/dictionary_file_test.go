@@ -0,0 +1,102 @@
+package radius
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDictionaryLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"dictionary": `# Local attributes
+$INCLUDE dictionary.example
+$INCLUDE- dictionary.missing
+ATTRIBUTE	Site-Policy		240	string
+ATTRIBUTE	Site-Tunnel		241	integer	has_tag
+VALUE	Site-Tunnel		Guest		2
+ATTRIBUTE	Site-Options		242.1	tlv
+VALUE	Site-Options		Unused		1
+`,
+		"dictionary.example": `VENDOR	Example	32473
+BEGIN-VENDOR	Example
+ATTRIBUTE	Example-Role		1	string
+ATTRIBUTE	Example-Limit		2	integer
+VALUE	Example-Limit		Unlimited	0
+ATTRIBUTE	Example-MAC		3	ether
+END-VENDOR	Example
+`,
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := DefaultDictionary.Clone()
+	if err := d.LoadFile(filepath.Join(dir, "dictionary")); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		vendor uint32
+		a      Attribute
+		typ    AttributeType
+	}{
+		{"Site-Policy", 0, 240, TypeString},
+		{"Site-Tunnel", 0, 241, TypeInteger},
+		{"Example-Role", 32473, 1, TypeString},
+		{"Example-Limit", 32473, 2, TypeInteger},
+		{"Example-MAC", 32473, 3, TypeOctets},
+		{"User-Name", 0, UserName, TypeString},
+	}
+	for _, c := range cases {
+		def, ok := d.Lookup(c.name)
+		if !ok {
+			t.Errorf("%s is not defined", c.name)
+			continue
+		}
+		if def.Vendor != c.vendor || def.Attribute != c.a || def.Type != c.typ {
+			t.Errorf("%s == %+v, want vendor %d, attribute %d and type %v", c.name, def, c.vendor, c.a, c.typ)
+		}
+	}
+	if def, _ := d.Lookup("Site-Tunnel"); !def.Tagged || def.Values["Guest"] != 2 {
+		t.Errorf("Site-Tunnel == %+v, want a tagged attribute with value Guest", def)
+	}
+	if _, ok := d.Lookup("Site-Options"); ok {
+		t.Error("TLV Site-Options is defined")
+	}
+	if _, ok := DefaultDictionary.Lookup("Site-Policy"); ok {
+		t.Error("loading a clone changed DefaultDictionary")
+	}
+
+	packet := new(Packet)
+	if err := d.AddAttribute(packet, "Example-Limit", "Unlimited"); err != nil {
+		t.Fatal(err)
+	}
+	if pairs := d.Pairs(packet); len(pairs) != 1 || pairs[0].Attribute != "Example-Limit" || pairs[0].Value != "Unlimited" {
+		t.Errorf("Pairs() == %v", pairs)
+	}
+}
+
+func TestDictionaryLoadFileErrors(t *testing.T) {
+	cases := map[string]string{
+		"ATTRIBUTE Broken 12":          "ATTRIBUTE takes",
+		"VALUE Unknown-Attribute X 1":  "unknown attribute",
+		"BEGIN-VENDOR Nobody":          "unknown vendor",
+		"ATTRIBUTE Broken twelve text": "invalid attribute number",
+		"FLAGS internal":               "unsupported keyword",
+	}
+	for contents, want := range cases {
+		name := filepath.Join(t.TempDir(), "dictionary")
+		if err := os.WriteFile(name, []byte("# Broken\n"+contents+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		err := NewDictionary().LoadFile(name)
+		if err == nil || !strings.Contains(err.Error(), want) || !strings.Contains(err.Error(), "dictionary:2:") {
+			t.Errorf("loading %q: error %v, want one at line 2 containing %q", contents, err, want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package radius
+
+import (
+	"net"
+	"sync"
+)
+
+// DropPolicy selects which request a Server drops when its queue is full.
+type DropPolicy int
+
+// Drop policies.
+const (
+	// DropNewest drops the request just received, keeping the queued ones.
+	DropNewest DropPolicy = iota
+	// DropOldest drops the request that waited longest in the queue, which its client most likely retransmitted
+	// or gave up on already, to queue the one just received.
+	DropOldest
+)
+
+// job is a request waiting for a worker.
+type job struct {
+	// client is the IP address the request was received from, addr, and nas the NASClient which sent it if known.
+	client string
+	addr   net.Addr
+	nas    *NASClient
+	run    func()
+	// dropped is called instead of run if the job is dropped.
+	dropped func()
+}
+
+// dispatcher runs the requests of a Server on a bounded number of workers, with a bounded queue and a limit of
+// requests in flight per client.
+type dispatcher struct {
+	srv *Server
+
+	mu       sync.Mutex
+	ready    *sync.Cond
+	queue    []job
+	inFlight map[string]int
+	// stopped lets the workers exit once the queue is empty.
+	stopped bool
+	workers sync.WaitGroup
+}
+
+// dispatcher returns the dispatcher of the server, starting its workers on first use.
+func (srv *Server) dispatcher() *dispatcher {
+	srv.dispatchMu.Lock()
+	defer srv.dispatchMu.Unlock()
+
+	if srv.jobs == nil {
+		d := &dispatcher{srv: srv, inFlight: make(map[string]int)}
+		d.ready = sync.NewCond(&d.mu)
+		d.workers.Add(srv.Workers)
+		for i := 0; i < srv.Workers; i++ {
+			go d.work()
+		}
+		srv.jobs = d
+	}
+	return srv.jobs
+}
+
+// serving records that a socket or connection of the server starts serving requests, and returns the function
+// recording that it stopped. Once none is serving, the workers exit after running the queued requests.
+func (srv *Server) serving() (stopped func()) {
+	srv.dispatchMu.Lock()
+	srv.sockets++
+	srv.dispatchMu.Unlock()
+
+	return func() {
+		srv.dispatchMu.Lock()
+		defer srv.dispatchMu.Unlock()
+
+		if srv.sockets--; srv.sockets == 0 && srv.jobs != nil {
+			srv.jobs.stop()
+			srv.jobs = nil
+		}
+	}
+}
+
+// submit runs the request received from addr, sent by client if known, with run, or calls dropped if it is dropped
+// because its client has MaxInFlight requests in flight or the queue is full. dropped may be nil.
+func (d *dispatcher) submit(addr net.Addr, client *NASClient, run func(), dropped func()) {
+	j := job{client: addr.String(), addr: addr, nas: client, run: run, dropped: dropped}
+	if ip := hostIP(addr); ip != nil {
+		j.client = ip.String()
+	}
+
+	d.mu.Lock()
+	if limit := d.srv.MaxInFlight; limit > 0 && d.inFlight[j.client] >= limit {
+		d.mu.Unlock()
+		d.srv.countDrop(&d.srv.stats.ClientDropped)
+		d.srv.dropped(addr, client, DropClientLimit)
+		j.drop()
+		return
+	}
+
+	if d.srv.Workers <= 0 {
+		d.inFlight[j.client]++
+		d.mu.Unlock()
+		go d.run(j)
+		return
+	}
+
+	if len(d.queue) >= d.srv.queueSize() {
+		if d.srv.DropPolicy != DropOldest {
+			d.mu.Unlock()
+			d.dropQueued(j)
+			return
+		}
+		oldest := d.queue[0]
+		d.queue = d.queue[1:]
+		d.release(oldest.client)
+		// Deferred calls run once d.mu is unlocked below.
+		defer d.dropQueued(oldest)
+	}
+
+	d.inFlight[j.client]++
+	d.queue = append(d.queue, j)
+	d.ready.Signal()
+	d.mu.Unlock()
+}
+
+// stop lets the workers exit once they have run the queued jobs.
+func (d *dispatcher) stop() {
+	d.mu.Lock()
+	d.stopped = true
+	d.ready.Broadcast()
+	d.mu.Unlock()
+}
+
+// work runs queued jobs until the dispatcher is stopped and its queue is empty.
+func (d *dispatcher) work() {
+	defer d.workers.Done()
+
+	for {
+		d.mu.Lock()
+		for len(d.queue) == 0 && !d.stopped {
+			d.ready.Wait()
+		}
+		if len(d.queue) == 0 {
+			d.mu.Unlock()
+			return
+		}
+		j := d.queue[0]
+		d.queue[0] = job{}
+		d.queue = d.queue[1:]
+		d.mu.Unlock()
+
+		d.run(j)
+	}
+}
+
+// run runs j and releases its slot of the client in flight requests.
+func (d *dispatcher) run(j job) {
+	defer func() {
+		d.mu.Lock()
+		d.release(j.client)
+		d.mu.Unlock()
+	}()
+
+	j.run()
+}
+
+// release decrements the requests in flight of client. d.mu must be held.
+func (d *dispatcher) release(client string) {
+	if d.inFlight[client]--; d.inFlight[client] <= 0 {
+		delete(d.inFlight, client)
+	}
+}
+
+// dropQueued drops j because the queue is full, charging the drop to its client. d.mu must not be held.
+func (d *dispatcher) dropQueued(j job) {
+	d.srv.countDrop(&d.srv.stats.QueueDropped)
+	d.srv.dropped(j.addr, j.nas, DropQueueFull)
+	j.drop()
+}
+
+func (j job) drop() {
+	if j.dropped != nil {
+		j.dropped()
+	}
+}
+
+func (srv *Server) queueSize() int {
+	if srv.QueueSize <= 0 {
+		return 16 * srv.Workers
+	}
+	return srv.QueueSize
+}
+
+// countDrop increments a counter of dropped requests in the statistics of the server.
+func (srv *Server) countDrop(counter *uint64) {
+	srv.statsMu.Lock()
+	*counter++
+	srv.statsMu.Unlock()
+}
@@ -0,0 +1,122 @@
+package radius
+
+import (
+	"bytes"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+)
+
+var (
+	client1 = &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1024}
+	client2 = &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 1024}
+)
+
+// submitTest submits a job from addr to srv and returns channels receiving when it runs or is dropped. The job
+// holds its worker until release is closed.
+func submitTest(srv *Server, addr net.Addr, release chan struct{}) (ran chan struct{}, dropped chan struct{}) {
+	ran, dropped = make(chan struct{}, 1), make(chan struct{}, 1)
+	srv.dispatcher().submit(addr, nil, func() {
+		ran <- struct{}{}
+		<-release
+	}, func() {
+		dropped <- struct{}{}
+	})
+	return ran, dropped
+}
+
+func TestDispatcherQueue(t *testing.T) {
+	for _, policy := range []DropPolicy{DropNewest, DropOldest} {
+		var logged bytes.Buffer
+		srv := &Server{Workers: 1, QueueSize: 1, DropPolicy: policy, Logger: slog.New(slog.NewJSONHandler(&logged, nil))}
+		release := make(chan struct{})
+
+		running, _ := submitTest(srv, client1, release)
+		<-running
+
+		_, firstDropped := submitTest(srv, client1, release)
+		secondRan, secondDropped := submitTest(srv, client2, release)
+
+		if policy == DropNewest {
+			<-secondDropped
+		} else {
+			<-firstDropped
+			close(release)
+			<-secondRan
+		}
+		if dropped := srv.Stats().QueueDropped; dropped != 1 {
+			t.Errorf("with policy %d, QueueDropped == %d, want 1", policy, dropped)
+		}
+		// The drop is charged to the client of the dropped request.
+		remote := client2.String()
+		if policy == DropOldest {
+			remote = client1.String()
+		}
+		if entries := decodeLog(t, logged.Bytes()); len(entries) != 1 || entries[0]["remote"] != remote {
+			t.Errorf("with policy %d, logged %v, want a drop from %s", policy, entries, remote)
+		}
+		if policy == DropNewest {
+			close(release)
+		}
+	}
+}
+
+func TestDispatcherMaxInFlight(t *testing.T) {
+	for _, workers := range []int{0, 2} {
+		srv := &Server{Workers: workers, MaxInFlight: 1}
+		release := make(chan struct{})
+
+		running, _ := submitTest(srv, client1, release)
+		<-running
+
+		_, dropped := submitTest(srv, &net.UDPAddr{IP: client1.IP, Port: 2048}, release)
+		<-dropped
+		otherRan, _ := submitTest(srv, client2, release)
+		<-otherRan
+
+		if stats := srv.Stats(); stats.ClientDropped != 1 || stats.QueueDropped != 0 {
+			t.Errorf("with %d workers, Stats() == %+v, want one request dropped for its client", workers, stats)
+		}
+
+		close(release)
+	}
+}
+
+func TestDispatcherStop(t *testing.T) {
+	srv := &Server{Workers: 2}
+	first, second := srv.serving(), srv.serving()
+	d := srv.dispatcher()
+
+	release := make(chan struct{})
+	running, _ := submitTest(srv, client1, release)
+	<-running
+	queued, _ := submitTest(srv, client2, release)
+	close(release)
+
+	first()
+	if srv.dispatcher() != d {
+		t.Fatal("dispatcher replaced while a socket is serving")
+	}
+	second()
+
+	// The queued job still runs before the workers exit.
+	stopped := make(chan struct{})
+	go func() {
+		d.workers.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("workers still running once the server stopped serving")
+	}
+	select {
+	case <-queued:
+	default:
+		t.Error("queued job dropped when the server stopped serving")
+	}
+	if srv.jobs != nil {
+		t.Error("stopped dispatcher kept")
+	}
+}
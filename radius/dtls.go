@@ -0,0 +1,129 @@
+package radius
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pion/dtls/v2"
+	"github.com/pion/transport/v2/udp"
+)
+
+// dtlsHandshake is the DTLS record content type of handshake messages, the only ones allowed to open a session.
+const dtlsHandshake = 22
+
+// ListenAndServeDTLS listens for RADIUS over DTLS, as described in RFC 7360, on srv.Addr or ":2083" if empty, and
+// serves the requests of each session with RadSecSecret. Certificates are configured and mapped to Clients as by
+// ListenAndServeTLS.
+//
+// Clients must answer a cookie exchange (RFC 6347 section 4.2.1) before the server sends its certificate, so that
+// spoofed handshakes cannot be used for amplification. Each peer address gets its own session, which is closed
+// when idle for IdleTimeout.
+func (srv *Server) ListenAndServeDTLS(certFile, keyFile string) error {
+	config, err := srv.serverTLSConfig(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+
+	network := "udp"
+	if strings.HasPrefix(srv.Net, "udp") {
+		network = srv.Net
+	}
+	addr := srv.Addr
+	if addr == "" {
+		addr = ":" + RadSecPort
+	}
+
+	srv.SAddr, err = net.ResolveUDPAddr(network, addr)
+	if err != nil {
+		return err
+	}
+
+	listenConfig := udp.ListenConfig{
+		AcceptFilter: func(packet []byte) bool {
+			return len(packet) > 0 && packet[0] == dtlsHandshake
+		},
+	}
+	srv.Listener, err = listenConfig.Listen(network, srv.SAddr)
+	if err != nil {
+		return err
+	}
+
+	defer srv.Listener.Close()
+
+	return srv.serveDTLS(dtlsConfig(config, srv.idleTimeout()))
+}
+
+// serveDTLS accepts the sessions of new peers on srv.Listener and serves the requests received in each until the
+// listener is closed.
+func (srv *Server) serveDTLS(config *dtls.Config) error {
+	srv.recordStart()
+	defer srv.serving()()
+
+	for {
+		conn, err := srv.Listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			session, err := dtls.Server(conn, config)
+			if err != nil {
+				log.Printf("radius: closing DTLS session from %v: %v", conn.RemoteAddr(), err)
+				conn.Close()
+				return
+			}
+			srv.serveStream(session)
+		}()
+	}
+}
+
+// dtlsClient returns the client presenting the peer certificate of session, or nil if the server has no Clients.
+func (srv *Server) dtlsClient(session *dtls.Conn) (*NASClient, error) {
+	var cert *x509.Certificate
+	if certificates := session.ConnectionState().PeerCertificates; len(certificates) > 0 {
+		var err error
+		if cert, err = x509.ParseCertificate(certificates[0]); err != nil {
+			return nil, err
+		}
+	}
+	return srv.certificateClient(cert)
+}
+
+// dtlsConfig returns the DTLS equivalent of config, with handshakes limited to timeout.
+func dtlsConfig(config *tls.Config, timeout time.Duration) *dtls.Config {
+	return &dtls.Config{
+		Certificates:         config.Certificates,
+		RootCAs:              config.RootCAs,
+		ClientCAs:            config.ClientCAs,
+		ClientAuth:           dtls.ClientAuthType(config.ClientAuth),
+		ServerName:           config.ServerName,
+		InsecureSkipVerify:   config.InsecureSkipVerify,
+		ExtendedMasterSecret: dtls.RequireExtendedMasterSecret,
+		ConnectContextMaker: func() (context.Context, func()) {
+			return context.WithTimeout(context.Background(), timeout)
+		},
+	}
+}
+
+// dialDTLS opens a DTLS session towards addr, verified with config.
+func dialDTLS(network string, addr string, config *tls.Config, timeout time.Duration) (net.Conn, error) {
+	raddr, err := net.ResolveUDPAddr(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+
+	return dtls.Dial(network, raddr, dtlsConfig(config, timeout))
+}
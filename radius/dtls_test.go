@@ -0,0 +1,89 @@
+package radius
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/transport/v2/udp"
+)
+
+// listenTestDTLSServer starts srv over DTLS on a random local port, with a certificate from ca, and returns its
+// address.
+func listenTestDTLSServer(t *testing.T, srv *Server, ca *testCA) string {
+	config := &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, "radius.example.com")},
+		ClientCAs:    ca.pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	listener, err := (&udp.ListenConfig{}).Listen("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	srv.Listener = listener
+	go srv.serveDTLS(dtlsConfig(config, time.Second))
+
+	return listener.Addr().String()
+}
+
+func TestDTLS(t *testing.T) {
+	ca := newTestCA(t)
+	nas := &NASClient{Name: "nas1", Identity: "nas1.example.com"}
+	clients := make(chan *NASClient, 2)
+	srv := &Server{Clients: NASClients{nas}, Users: Users{"alice": "{CLEARTEXT}wonderland"}, IdleTimeout: 100 * time.Millisecond}
+	srv.Handler = HandlerFunc(func(req *Request) *Packet {
+		clients <- req.Client
+		return srv.authenticate(req)
+	})
+	addr := listenTestDTLSServer(t, srv, ca)
+
+	newClient := func(cert string) *Client {
+		c := &Client{Net: "dtls", MaxAttempts: 2, Retry: 200 * time.Millisecond, MaxRetry: time.Second, TLSConfig: &tls.Config{
+			RootCAs:    ca.pool,
+			ServerName: "radius.example.com",
+		}}
+		if cert != "" {
+			c.TLSConfig.Certificates = []tls.Certificate{ca.issue(t, cert)}
+		}
+		return c
+	}
+	exchange := func(c *Client) (*Packet, error) {
+		request, err := NewAccessRequest("alice", "wonderland", RadSecSecret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c.Exchange(context.Background(), addr, RadSecSecret, request)
+	}
+
+	client := newClient("nas1.example.com")
+	defer client.Close()
+
+	// The second request is sent after the server closed the idle session, in a new one.
+	for i := 0; i < 2; i++ {
+		if i > 0 {
+			time.Sleep(3 * srv.IdleTimeout)
+		}
+		response, err := exchange(client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.Code != AccessAccept {
+			t.Errorf("Access-Request over DTLS answered with %v, want %v", response.Code, AccessAccept)
+		}
+		if client := <-clients; client != nas {
+			t.Errorf("request over DTLS from %v, want %v", client, nas)
+		}
+	}
+
+	for _, cert := range []string{"", "nas2.example.com"} {
+		c := newClient(cert)
+		if response, err := exchange(c); err == nil {
+			t.Errorf("Access-Request over DTLS with certificate %q answered with %v, want no response", cert, response.Code)
+		}
+		c.Close()
+	}
+}
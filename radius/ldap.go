@@ -0,0 +1,309 @@
+package radius
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Defaults used by LDAPBackend when the corresponding field is zero.
+const (
+	DefaultLDAPTimeout  = 5 * time.Second
+	DefaultLDAPPoolSize = 4
+)
+
+// LDAPBackend authenticates PAP Access-Requests by binding to a directory as the user, and maps the
+// user's group membership to reply attributes. It is a Handler.
+type LDAPBackend struct {
+	// URL of the directory, such as "ldap://ldap.example.com" or "ldaps://ldap.example.com".
+	URL       string
+	TLSConfig *tls.Config
+
+	// BindDN and BindPassword are used to search for users. If empty, searches are anonymous.
+	BindDN       string
+	BindPassword string
+
+	// BaseDN is where users are searched for with Filter, in which every "%s" is replaced by the escaped User-Name,
+	// for example "(&(objectClass=person)(uid=%s))".
+	BaseDN string
+	Filter string
+
+	// GroupAttribute is the attribute of the user entry listing its groups. If empty, "memberOf" is used.
+	GroupAttribute string
+
+	// GroupBaseDN and GroupFilter, if set, also search for the groups of the user, with "%s" in GroupFilter
+	// replaced by the escaped DN of the user, for example "(member=%s)".
+	GroupBaseDN string
+	GroupFilter string
+
+	// Reply items are added to every Access-Accept. Groups maps group DNs, or the value of the first RDN of
+	// the DN such as the cn, to the reply items added for members of the group. Keys are case-insensitive, and the
+	// items of a full DN override those of its first RDN.
+	Reply  Pairs
+	Groups map[string]Pairs
+
+	// Timeout bounds connecting and every operation on the directory. If zero, DefaultLDAPTimeout is used.
+	Timeout time.Duration
+	// PoolSize is the number of idle connections kept open. If zero, DefaultLDAPPoolSize is used.
+	PoolSize int
+
+	// Dictionary is used to encode reply items. If nil, DefaultDictionary is used.
+	Dictionary *Dictionary
+
+	poolOnce sync.Once
+	pool     chan *ldapConn
+}
+
+// ldapConn is a pooled connection, remembering whether it is still bound as BindDN.
+type ldapConn struct {
+	*ldap.Conn
+	bound bool
+}
+
+// ErrLDAPAmbiguousUser is returned when the user filter matches more than one entry.
+var ErrLDAPAmbiguousUser = errors.New("radius: LDAP filter matched more than one user")
+
+func (b *LDAPBackend) timeout() time.Duration {
+	if b.Timeout == 0 {
+		return DefaultLDAPTimeout
+	}
+	return b.Timeout
+}
+
+func (b *LDAPBackend) dictionary() *Dictionary {
+	if b.Dictionary == nil {
+		return DefaultDictionary
+	}
+	return b.Dictionary
+}
+
+// get returns an idle connection from the pool or dials a new one.
+func (b *LDAPBackend) get() (*ldapConn, error) {
+	b.poolOnce.Do(func() {
+		size := b.PoolSize
+		if size == 0 {
+			size = DefaultLDAPPoolSize
+		}
+		b.pool = make(chan *ldapConn, size)
+	})
+
+	for {
+		var c *ldapConn
+		select {
+		case c = <-b.pool:
+		default:
+		}
+		if c == nil {
+			break
+		}
+		if !c.IsClosing() {
+			return c, nil
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: b.timeout()}
+	conn, err := ldap.DialURL(b.URL, ldap.DialWithDialer(dialer), ldap.DialWithTLSConfig(b.TLSConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(b.timeout())
+
+	return &ldapConn{Conn: conn}, nil
+}
+
+// put returns a healthy connection to the pool, closing it if the pool is full.
+func (b *LDAPBackend) put(c *ldapConn) {
+	select {
+	case b.pool <- c:
+	default:
+		c.Close()
+	}
+}
+
+// Close closes the idle connections of the pool.
+func (b *LDAPBackend) Close() {
+	if b.pool == nil {
+		return
+	}
+	for {
+		select {
+		case c := <-b.pool:
+			c.Close()
+		default:
+			return
+		}
+	}
+}
+
+// search finds the entry of user and the names of its groups, binding as BindDN first if needed.
+func (b *LDAPBackend) search(c *ldapConn, user string) (dn string, groups []string, err error) {
+	if !c.bound {
+		if b.BindDN == "" {
+			err = c.UnauthenticatedBind("")
+		} else {
+			err = c.Bind(b.BindDN, b.BindPassword)
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		c.bound = true
+	}
+
+	groupAttribute := b.GroupAttribute
+	if groupAttribute == "" {
+		groupAttribute = "memberOf"
+	}
+
+	filter := strings.Replace(b.Filter, "%s", ldap.EscapeFilter(user), -1)
+	timeLimit := int(b.timeout() / time.Second)
+
+	result, err := c.Search(ldap.NewSearchRequest(b.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, timeLimit, false, filter, []string{groupAttribute}, nil))
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return "", nil, ErrLDAPAmbiguousUser
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	switch len(result.Entries) {
+	case 0:
+		return "", nil, ErrUnknownUser
+	case 1:
+	default:
+		return "", nil, ErrLDAPAmbiguousUser
+	}
+
+	entry := result.Entries[0]
+	groups = entry.GetAttributeValues(groupAttribute)
+
+	if b.GroupFilter != "" {
+		filter := strings.Replace(b.GroupFilter, "%s", ldap.EscapeFilter(entry.DN), -1)
+		result, err := c.Search(ldap.NewSearchRequest(b.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+			0, timeLimit, false, filter, []string{"1.1"}, nil))
+		if err != nil {
+			return "", nil, err
+		}
+		for _, group := range result.Entries {
+			groups = append(groups, group.DN)
+		}
+	}
+
+	return entry.DN, groups, nil
+}
+
+// Authenticate binds as user with password and returns the names and DNs of the user's groups.
+// authenticated is false if the user is unknown or the password is wrong.
+func (b *LDAPBackend) Authenticate(user string, password string) (authenticated bool, groups []string, err error) {
+	// An empty password would be an unauthenticated bind, which most directories accept.
+	if user == "" || password == "" {
+		return false, nil, nil
+	}
+
+	c, err := b.get()
+	if err != nil {
+		return false, nil, err
+	}
+
+	dn, groups, err := b.search(c, user)
+	if err == ErrUnknownUser {
+		b.put(c)
+		return false, nil, nil
+	}
+	if err != nil {
+		c.Close()
+		return false, nil, err
+	}
+
+	c.bound = false
+	err = c.Bind(dn, password)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		b.put(c)
+		return false, nil, nil
+	}
+	if err != nil {
+		c.Close()
+		return false, nil, err
+	}
+	b.put(c)
+
+	return true, groups, nil
+}
+
+// groupReply returns the reply items of the groups, matching either full DNs or the value of their first RDN. The
+// items of a group's first RDN are merged before those of its full DN, which override them.
+func (b *LDAPBackend) groupReply(groups []string) (reply Pairs) {
+	keys := make([]string, 0, len(b.Groups))
+	for key := range b.Groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, group := range groups {
+		var names []string
+		if dn, err := ldap.ParseDN(group); err == nil && len(dn.RDNs) > 0 && len(dn.RDNs[0].Attributes) > 0 {
+			names = append(names, dn.RDNs[0].Attributes[0].Value)
+		}
+		names = append(names, group)
+
+		for _, name := range names {
+			for _, key := range keys {
+				if strings.EqualFold(key, name) {
+					for _, item := range b.Groups[key] {
+						reply = reply.Merge(item)
+					}
+				}
+			}
+		}
+	}
+	return reply
+}
+
+// ServeRADIUS answers a PAP Access-Request with an Access-Accept carrying Reply and the reply items of the
+// user's groups if binding as the user succeeds, and with an Access-Reject otherwise. Other requests get no
+// response.
+func (b *LDAPBackend) ServeRADIUS(req *Request) *Packet {
+	if req.Packet.Code != AccessRequest {
+		return nil
+	}
+	if req.AuthType() != PAP {
+		req.Reason = ReasonUnsupportedAuthType
+		return req.Response(AccessReject)
+	}
+
+	authenticated, groups, err := b.Authenticate(req.UserName(), req.Password())
+	if err != nil {
+		err = fmt.Errorf("radius: LDAP authentication of %q: %v", req.UserName(), err)
+		req.Reason = err.Error()
+		log.Println(err)
+	}
+	if !authenticated {
+		if req.Reason == "" {
+			req.Reason = ReasonInvalidPassword
+		}
+		return req.Response(AccessReject)
+	}
+
+	var reply Pairs
+	for _, item := range b.Reply {
+		reply = reply.Merge(item)
+	}
+	for _, item := range b.groupReply(groups) {
+		reply = reply.Merge(item)
+	}
+
+	response := req.Response(AccessAccept)
+	if err := b.dictionary().AddPairs(response, reply); err != nil {
+		log.Println(err)
+		return req.Response(AccessReject)
+	}
+
+	return response
+}
@@ -0,0 +1,273 @@
+package radius
+
+import (
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ldapStandIn is an in-process directory answering the simple binds and equality searches made by LDAPBackend.
+type ldapStandIn struct {
+	listener    net.Listener
+	entries     map[string]map[string][]string
+	passwords   map[string]string
+	connections int32
+	silent      bool
+}
+
+func newLDAPStandIn(t *testing.T) *ldapStandIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &ldapStandIn{
+		listener: listener,
+		entries: map[string]map[string][]string{
+			"uid=alice,ou=people,dc=example,dc=com": {
+				"uid":      {"alice"},
+				"memberOf": {"cn=staff,ou=groups,dc=example,dc=com"},
+			},
+			"uid=bob,ou=people,dc=example,dc=com": {
+				"uid": {"bob"},
+			},
+			"cn=wifi,ou=groups,dc=example,dc=com": {
+				"cn":     {"wifi"},
+				"member": {"uid=bob,ou=people,dc=example,dc=com"},
+			},
+		},
+		passwords: map[string]string{
+			"cn=radius,dc=example,dc=com":           "service",
+			"uid=alice,ou=people,dc=example,dc=com": "wonderland",
+			"uid=bob,ou=people,dc=example,dc=com":   "builder",
+		},
+	}
+	go s.serve()
+
+	return s
+}
+
+func (s *ldapStandIn) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *ldapStandIn) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		atomic.AddInt32(&s.connections, 1)
+		go s.serveConn(conn)
+	}
+}
+
+func (s *ldapStandIn) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		request, err := ber.ReadPacket(conn)
+		if err != nil || len(request.Children) < 2 {
+			return
+		}
+		if s.silent {
+			continue
+		}
+		id := request.Children[0].Value.(int64)
+		op := request.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := op.Children[1].Data.String()
+			password := op.Children[2].Data.String()
+			code := int64(ldap.LDAPResultSuccess)
+			if expected, ok := s.passwords[dn]; (dn != "" || password != "") && (!ok || expected != password) {
+				code = ldap.LDAPResultInvalidCredentials
+			}
+			s.write(conn, id, ldapStandInResult(ldap.ApplicationBindResponse, code))
+
+		case ldap.ApplicationSearchRequest:
+			filter, _ := ldap.DecompileFilter(op.Children[6])
+			key, value := ldapStandInFilter(filter)
+			for dn, attributes := range s.entries {
+				if !strings.HasSuffix(dn, op.Children[0].Data.String()) || !ldapStandInContains(attributes[key], value) {
+					continue
+				}
+				entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+				entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, ""))
+				list := ber.NewSequence("")
+				for name, values := range attributes {
+					attribute := ber.NewSequence("")
+					attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+					set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+					for _, v := range values {
+						set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, ""))
+					}
+					attribute.AppendChild(set)
+					list.AppendChild(attribute)
+				}
+				entry.AppendChild(list)
+				s.write(conn, id, entry)
+			}
+			s.write(conn, id, ldapStandInResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+
+		case ldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+func (s *ldapStandIn) write(conn net.Conn, id int64, op *ber.Packet) {
+	envelope := ber.NewSequence("")
+	envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+	envelope.AppendChild(op)
+	conn.Write(envelope.Bytes())
+}
+
+func ldapStandInResult(tag ber.Tag, code int64) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, ""))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	return result
+}
+
+// ldapStandInFilter splits a filter of the form "(key=value)".
+func ldapStandInFilter(filter string) (key string, value string) {
+	filter = strings.TrimSuffix(strings.TrimPrefix(filter, "("), ")")
+	i := strings.IndexByte(filter, '=')
+	if i < 0 {
+		return "", ""
+	}
+	return filter[:i], filter[i+1:]
+}
+
+func ldapStandInContains(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLDAPBackend(t *testing.T) {
+	directory := newLDAPStandIn(t)
+	defer directory.listener.Close()
+
+	backend := &LDAPBackend{
+		URL:          directory.URL(),
+		BindDN:       "cn=radius,dc=example,dc=com",
+		BindPassword: "service",
+		BaseDN:       "ou=people,dc=example,dc=com",
+		Filter:       "(uid=%s)",
+		GroupBaseDN:  "ou=groups,dc=example,dc=com",
+		GroupFilter:  "(member=%s)",
+		Reply:        Pairs{{"Service-Type", OpSet, "Framed-User"}},
+		Groups: map[string]Pairs{
+			"staff": {{"Filter-Id", OpSet, "staff"}},
+			"cn=wifi,ou=groups,dc=example,dc=com": {
+				{"Tunnel-Type:1", OpSet, "VLAN"},
+				{"Tunnel-Medium-Type:1", OpSet, "IEEE-802"},
+				{"Tunnel-Private-Group-Id:1", OpSet, "42"},
+			},
+		},
+	}
+	defer backend.Close()
+
+	cases := []struct {
+		req      *Request
+		code     Code
+		expected Pairs
+	}{
+		// Group from memberOf, matched by its cn.
+		{buildAccessRequest("alice", "wonderland", "127.0.0.1"), AccessAccept,
+			Pairs{{"Service-Type", OpSet, "Framed-User"}, {"Filter-Id", OpSet, "staff"}}},
+		// Group found by searching for the user's DN, matched by its full DN.
+		{buildAccessRequest("bob", "builder", "127.0.0.1"), AccessAccept,
+			Pairs{{"Service-Type", OpSet, "Framed-User"}, {"Tunnel-Type:1", OpSet, "VLAN"},
+				{"Tunnel-Medium-Type:1", OpSet, "IEEE-802"}, {"Tunnel-Private-Group-Id:1", OpSet, "42"}}},
+		// Wrong, empty and injected passwords or users.
+		{buildAccessRequest("alice", "wrong", "127.0.0.1"), AccessReject, nil},
+		{buildAccessRequest("alice", "", "127.0.0.1"), AccessReject, nil},
+		{buildAccessRequest("*", "wonderland", "127.0.0.1"), AccessReject, nil},
+		{buildAccessRequest("mallory", "secret", "127.0.0.1"), AccessReject, nil},
+		// Binding as the user must not leave the pooled connection bound as that user.
+		{buildAccessRequest("alice", "wonderland", "127.0.0.1"), AccessAccept,
+			Pairs{{"Service-Type", OpSet, "Framed-User"}, {"Filter-Id", OpSet, "staff"}}},
+	}
+
+	for test, c := range cases {
+		got := backend.ServeRADIUS(c.req)
+
+		if got.Code != c.code {
+			t.Errorf("Test %d: ServeRADIUS(%s).Code == %s, want %s", test, c.req.UserName(), got.Code, c.code)
+			continue
+		}
+
+		expected := &Packet{}
+		if err := DefaultDictionary.AddPairs(expected, c.expected); err != nil {
+			t.Fatal(err)
+		}
+		if string(got.Attributes) != string(expected.Attributes) {
+			t.Errorf("Test %d: ServeRADIUS(%s).Attributes == %X, want %X", test, c.req.UserName(), got.Attributes, expected.Attributes)
+		}
+	}
+
+	if n := atomic.LoadInt32(&directory.connections); n != 1 {
+		t.Errorf("LDAPBackend opened %d connections, want 1 pooled connection", n)
+	}
+
+	accounting := buildAccountingRequest(1, Pairs{{"Acct-Status-Type", OpSet, "Start"}, {"User-Name", OpSet, "alice"}})
+	if got := backend.ServeRADIUS(accounting); got != nil {
+		t.Errorf("ServeRADIUS(Accounting-Request) == %v, want no response", got)
+	}
+}
+
+func TestLDAPBackendTimeout(t *testing.T) {
+	directory := newLDAPStandIn(t)
+	defer directory.listener.Close()
+	directory.silent = true
+
+	backend := &LDAPBackend{URL: directory.URL(), BaseDN: "dc=example,dc=com", Filter: "(uid=%s)", Timeout: 100 * time.Millisecond}
+	defer backend.Close()
+
+	start := time.Now()
+	authenticated, _, err := backend.Authenticate("alice", "wonderland")
+	if authenticated || err == nil {
+		t.Errorf("Authenticate against an unresponsive directory == %t, %v, want false and an error", authenticated, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Authenticate against an unresponsive directory took %s, want about %s", elapsed, backend.Timeout)
+	}
+}
+
+func TestLDAPGroupReplyOrder(t *testing.T) {
+	backend := &LDAPBackend{Groups: map[string]Pairs{
+		"cn=wifi,ou=groups,dc=example,dc=com": {{"Filter-Id", OpSet, "dn"}},
+		"WIFI":                                {{"Filter-Id", OpSet, "cn"}, {"Session-Timeout", OpSet, "60"}},
+		"wifi":                                {{"Session-Timeout", OpSet, "120"}},
+	}}
+	expected := Pairs{{"Filter-Id", OpSet, "dn"}, {"Session-Timeout", OpSet, "120"}}
+
+	for i := 0; i < 20; i++ {
+		reply := backend.groupReply([]string{"cn=wifi,ou=groups,dc=example,dc=com"})
+		if len(reply) != len(expected) {
+			t.Fatalf("groupReply = %v, want %v", reply, expected)
+		}
+		for _, item := range expected {
+			found := false
+			for _, got := range reply {
+				found = found || got == item
+			}
+			if !found {
+				t.Fatalf("groupReply = %v, want %v", reply, expected)
+			}
+		}
+	}
+}
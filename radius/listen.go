@@ -0,0 +1,124 @@
+package radius
+
+import (
+	"context"
+	"net"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// udpSocket reads requests from a UDP socket and sends responses from the local address each request was sent to,
+// which matters on sockets bound to an unspecified address of a host with several addresses.
+type udpSocket struct {
+	conn *net.UDPConn
+
+	// Only one of p4 and p6 is set, on sockets bound to an unspecified address that deliver the destination
+	// address of packets.
+	p4 *ipv4.PacketConn
+	p6 *ipv6.PacketConn
+}
+
+// newUDPSocket returns the udpSocket of conn, asking for the destination address of packets if conn is bound to
+// an unspecified address.
+func newUDPSocket(conn *net.UDPConn) *udpSocket {
+	socket := &udpSocket{conn: conn}
+
+	local, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok || !local.IP.IsUnspecified() {
+		return socket
+	}
+
+	if local.IP.To4() != nil {
+		p4 := ipv4.NewPacketConn(conn)
+		if p4.SetControlMessage(ipv4.FlagDst|ipv4.FlagInterface, true) == nil {
+			socket.p4 = p4
+		}
+	} else {
+		p6 := ipv6.NewPacketConn(conn)
+		if p6.SetControlMessage(ipv6.FlagDst|ipv6.FlagInterface, true) == nil {
+			socket.p6 = p6
+		}
+	}
+	return socket
+}
+
+// readFrom reads a packet into b and returns the address of its sender and the local address it was sent to, with
+// the index of the interface it arrived on if known.
+func (s *udpSocket) readFrom(b []byte) (n int, src *net.UDPAddr, dst *net.UDPAddr, ifIndex int, err error) {
+	local := s.conn.LocalAddr().(*net.UDPAddr)
+	dst = local
+
+	var addr net.Addr
+	switch {
+	case s.p4 != nil:
+		var cm *ipv4.ControlMessage
+		n, cm, addr, err = s.p4.ReadFrom(b)
+		if cm != nil && cm.Dst != nil {
+			dst, ifIndex = &net.UDPAddr{IP: cm.Dst, Port: local.Port}, cm.IfIndex
+		}
+	case s.p6 != nil:
+		var cm *ipv6.ControlMessage
+		n, cm, addr, err = s.p6.ReadFrom(b)
+		if cm != nil && cm.Dst != nil {
+			dst, ifIndex = &net.UDPAddr{IP: cm.Dst, Port: local.Port}, cm.IfIndex
+		}
+	default:
+		n, src, err = s.conn.ReadFromUDP(b)
+		return n, src, dst, 0, err
+	}
+	if err != nil {
+		return 0, nil, nil, 0, err
+	}
+
+	src, _ = addr.(*net.UDPAddr)
+	return n, src, dst, ifIndex, nil
+}
+
+// writeTo sends b to dst from the local address src, the destination of the request b answers.
+func (s *udpSocket) writeTo(b []byte, dst *net.UDPAddr, src *net.UDPAddr, ifIndex int) error {
+	var err error
+	switch {
+	case s.p4 != nil:
+		_, err = s.p4.WriteTo(b, &ipv4.ControlMessage{Src: src.IP, IfIndex: ifIndex}, dst)
+	case s.p6 != nil:
+		_, err = s.p6.WriteTo(b, &ipv6.ControlMessage{Src: src.IP, IfIndex: ifIndex}, dst)
+	default:
+		_, err = s.conn.WriteToUDP(b, dst)
+	}
+	return err
+}
+
+// listenUDP opens the sockets of the server on addr: one shared by Readers reader goroutines, or with ReusePort one
+// per reader, all bound to addr.
+func (srv *Server) listenUDP(network string, addr string) ([]*net.UDPConn, error) {
+	var config net.ListenConfig
+	sockets := 1
+	if srv.ReusePort {
+		config.Control = reusePort
+		sockets = srv.readers()
+	}
+
+	var conns []*net.UDPConn
+	for i := 0; i < sockets; i++ {
+		conn, err := config.ListenPacket(context.Background(), network, addr)
+		if err != nil {
+			for _, conn := range conns {
+				conn.Close()
+			}
+			return nil, err
+		}
+		conns = append(conns, conn.(*net.UDPConn))
+
+		// Further sockets share the port picked for the first one.
+		addr = conn.LocalAddr().String()
+	}
+	return conns, nil
+}
+
+func (srv *Server) readers() int {
+	if srv.Readers <= 0 {
+		return 1
+	}
+	return srv.Readers
+}
@@ -0,0 +1,125 @@
+package radius
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// serveTestConns serves srv on conns until the test ends.
+func serveTestConns(t *testing.T, srv *Server, conns []*net.UDPConn) {
+	t.Cleanup(func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+	go srv.serveConns(conns)
+}
+
+func TestListenAddrs(t *testing.T) {
+	addrs := []string{"127.0.0.1:0", "127.0.0.1:0"}
+	if conn, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback}); err == nil {
+		conn.Close()
+		addrs = append(addrs, "[::1]:0")
+	}
+
+	srv := &Server{Secret: secret, Users: Users{"alice": "{CLEARTEXT}wonderland"}, Readers: 2}
+	conns, err := srv.listenAddrs("udp", addrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conns) != len(addrs) {
+		t.Fatalf("listenAddrs(%q) opened %d sockets, want one per address", addrs, len(conns))
+	}
+	serveTestConns(t, srv, conns)
+
+	client := &Client{}
+	defer client.Close()
+	for _, conn := range conns {
+		request, err := NewAccessRequest("alice", "wonderland", secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := client.Exchange(context.Background(), conn.LocalAddr().String(), secret, request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.Code != AccessAccept {
+			t.Errorf("Access-Request to %v answered with %v, want %v", conn.LocalAddr(), response.Code, AccessAccept)
+		}
+	}
+}
+
+func TestListenReusePort(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("SO_REUSEPORT is only supported on Linux")
+	}
+
+	srv := &Server{Secret: secret, ReusePort: true, Readers: 4}
+	conns, err := srv.listenAddrs("udp", []string{"127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conns) != 4 {
+		t.Fatalf("listenAddrs() with ReusePort opened %d sockets, want 4", len(conns))
+	}
+	for _, conn := range conns[1:] {
+		if conn.LocalAddr().String() != conns[0].LocalAddr().String() {
+			t.Errorf("socket bound to %v, want %v", conn.LocalAddr(), conns[0].LocalAddr())
+		}
+	}
+	serveTestConns(t, srv, conns)
+
+	// Requests from several source ports are spread over the sockets, all of which answer.
+	for i := 0; i < 8; i++ {
+		client := &Client{Retry: 100 * time.Millisecond}
+		if _, err := client.Exchange(context.Background(), conns[0].LocalAddr().String(), secret, NewStatusServer()); err != nil {
+			t.Error(err)
+		}
+		client.Close()
+	}
+}
+
+func TestReplyFromLocalAddress(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("needs the 127.0.0.0/8 loopback network of Linux")
+	}
+
+	srv := &Server{Secret: secret}
+	conns, err := srv.listenAddrs("udp4", []string{"0.0.0.0:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serveTestConns(t, srv, conns)
+	port := conns[0].LocalAddr().(*net.UDPAddr).Port
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	request := NewStatusServer()
+	request.Authenticator[0] = 1
+	signMessageAuthenticator(request, secret)
+	message := request.packetToBytes()
+
+	for _, ip := range []net.IP{net.IPv4(127, 0, 0, 1), net.IPv4(127, 0, 0, 2)} {
+		dst := &net.UDPAddr{IP: ip, Port: port}
+		if _, err := conn.WriteToUDP(message, dst); err != nil {
+			t.Fatal(err)
+		}
+
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		buffer := make([]byte, maxPacketLength)
+		_, src, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !src.IP.Equal(ip) || src.Port != port {
+			t.Errorf("response to request sent to %v came from %v", dst, src)
+		}
+	}
+}
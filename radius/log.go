@@ -0,0 +1,136 @@
+package radius
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"net"
+	"time"
+)
+
+// Reasons for which Access-Requests are rejected, as logged by a Server.
+const (
+	ReasonUnknownUser         = "unknown_user"
+	ReasonInvalidPassword     = "invalid_password"
+	ReasonUnsupportedAuthType = "unsupported_auth_type"
+	ReasonAuthTypeReject      = "auth_type_reject"
+	ReasonNoCredential        = "no_credential"
+	ReasonPolicyReject        = "policy_reject"
+)
+
+// Outcome logged for requests which get no response.
+const outcomeDropped = "dropped"
+
+// logRequest logs the outcome of req from client, answered with response, or dropped for reason if response is nil,
+// and records Access-Requests in the AuditLog.
+func (srv *Server) logRequest(req *Request, client string, response *Packet, reason string, elapsed time.Duration) {
+	if srv.Logger == nil && srv.AuditLog == nil {
+		return
+	}
+
+	level, outcome := slog.LevelInfo, outcomeDropped
+	if response != nil {
+		outcome = codeLabel(response.Code)
+	} else {
+		level = slog.LevelWarn
+	}
+	if reason == "" {
+		reason = req.Reason
+	}
+	if reason == "" && response == nil {
+		reason = DropNoResponse
+	}
+
+	attrs := requestAttrs(req, client)
+	attrs = append(attrs, slog.String("outcome", outcome))
+	if reason != "" {
+		attrs = append(attrs, slog.String("reason", reason))
+	}
+	attrs = append(attrs, slog.Duration("duration", elapsed))
+
+	if srv.Logger != nil {
+		srv.Logger.LogAttrs(context.Background(), level, "request", attrs...)
+	}
+	if srv.AuditLog != nil && req.Packet.Code == AccessRequest {
+		srv.AuditLog.record(level, attrs)
+	}
+}
+
+// requestAttrs returns the attributes identifying req from client in logs. Passwords are left out.
+func requestAttrs(req *Request, client string) []slog.Attr {
+	attrs := make([]slog.Attr, 0, 10)
+	attrs = append(attrs,
+		slog.String("client", client),
+		slog.String("remote", req.RemoteAddr.String()),
+		slog.String("code", codeLabel(req.Packet.Code)),
+		slog.Int("identifier", req.Packet.Identifier),
+	)
+	if value, ok := req.Packet.Lookup(UserName); ok {
+		attrs = append(attrs, slog.String("user", string(value)))
+	}
+	if value, ok := req.Packet.Lookup(CallingStationID); ok {
+		attrs = append(attrs, slog.String("calling_station_id", string(value)))
+	}
+	if value, ok := req.Packet.Lookup(NASIPAddress); ok && len(value) == net.IPv4len {
+		attrs = append(attrs, slog.String("nas_ip_address", net.IP(value).String()))
+	}
+	return attrs
+}
+
+// dropLogInterval is the shortest time between two logs of requests dropped for the same reason before being
+// handled, so that a flood of such requests does not flood the logs as well.
+const dropLogInterval = time.Second
+
+// dropLog is when a request dropped for a reason was last logged, and how many were dropped since.
+type dropLog struct {
+	time       time.Time
+	suppressed int
+}
+
+// dropped records that a request from addr, sent by client if known, was dropped for reason before being decoded
+// or handled. It is logged unless another request was dropped for the same reason within dropLogInterval.
+func (srv *Server) dropped(addr net.Addr, client *NASClient, reason string) {
+	label := clientLabel(client)
+	srv.Metrics.drop(label, reason)
+
+	suppressed, ok := srv.logDrop(reason, time.Now())
+	if !ok {
+		return
+	}
+	if srv.Logger == nil {
+		if reason == DropUnknownClient {
+			log.Printf("radius: dropping request from unknown client %v (%d more not logged)", addr, suppressed)
+		}
+		return
+	}
+	srv.Logger.LogAttrs(context.Background(), slog.LevelWarn, "request",
+		slog.String("client", label),
+		slog.String("remote", addr.String()),
+		slog.String("outcome", outcomeDropped),
+		slog.String("reason", reason),
+		slog.Int("suppressed", suppressed),
+	)
+}
+
+// logDrop reports whether a request dropped for reason at now is logged, along with the number of requests dropped
+// for the same reason without being logged since the last one that was.
+func (srv *Server) logDrop(reason string, now time.Time) (suppressed int, ok bool) {
+	srv.dropLogMu.Lock()
+	defer srv.dropLogMu.Unlock()
+
+	if srv.dropLogs == nil {
+		srv.dropLogs = make(map[string]*dropLog)
+	}
+	l := srv.dropLogs[reason]
+	if l == nil {
+		l = new(dropLog)
+		srv.dropLogs[reason] = l
+	}
+	if !l.time.IsZero() && now.Sub(l.time) < dropLogInterval {
+		l.suppressed++
+		return 0, false
+	}
+	suppressed = l.suppressed
+	l.time, l.suppressed = now, 0
+	return suppressed, true
+}
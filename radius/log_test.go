@@ -0,0 +1,137 @@
+package radius
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decodeLog returns the JSON entries written to b, one per line.
+func decodeLog(t *testing.T, b []byte) []map[string]interface{} {
+	var entries []map[string]interface{}
+	for _, line := range bytes.Split(bytes.TrimSpace(b), []byte("\n")) {
+		var entry map[string]interface{}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			t.Fatalf("log line %q: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestRequestLogging(t *testing.T) {
+	var logged bytes.Buffer
+	srv := &Server{Secret: secret, Users: Users{"alice": "{CLEARTEXT}wonderland"}}
+	srv.Logger = slog.New(slog.NewJSONHandler(&logged, nil))
+
+	accepted := buildAccessRequest("alice", "wonderland", "10.0.0.1")
+	accepted.Packet.AddAttribute(CallingStationID, []byte("00-11-22-33-44-55"))
+	rejected := buildAccessRequest("alice", "looking-glass", "10.0.0.1")
+	unknown := buildAccessRequest("bob", "builder", "10.0.0.2")
+	unsigned := &Request{Packet: *NewAccountingRequest(AcctStart, "s1"), Secret: secret}
+
+	for _, req := range []*Request{accepted, rejected, unknown, unsigned} {
+		req.RemoteAddr = client1
+		srv.respond(req)
+	}
+
+	want := []map[string]interface{}{
+		{"user": "alice", "outcome": "Access-Accept", "calling_station_id": "00-11-22-33-44-55", "nas_ip_address": "10.0.0.1"},
+		{"user": "alice", "outcome": "Access-Reject", "reason": ReasonInvalidPassword},
+		{"user": "bob", "outcome": "Access-Reject", "reason": ReasonUnknownUser, "nas_ip_address": "10.0.0.2"},
+		{"code": "Accounting-Request", "outcome": "dropped", "reason": DropBadAuthenticator, "level": "WARN"},
+	}
+	entries := decodeLog(t, logged.Bytes())
+	if len(entries) != len(want) {
+		t.Fatalf("logged %d entries, want %d:\n%s", len(entries), len(want), logged.String())
+	}
+	for i, entry := range entries {
+		for key, value := range want[i] {
+			if entry[key] != value {
+				t.Errorf("entry %d has %s == %v, want %v", i, key, entry[key], value)
+			}
+		}
+	}
+
+	for _, password := range []string{"wonderland", "looking-glass", "builder"} {
+		if strings.Contains(logged.String(), password) {
+			t.Errorf("log contains the password %q", password)
+		}
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.log")
+	audit := &AuditLog{Path: path, Rotation: RotateDaily}
+	defer audit.Close()
+	srv := &Server{Secret: secret, Users: Users{"alice": "{CLEARTEXT}wonderland"}, AuditLog: audit}
+
+	accounting := NewAccountingRequest(AcctStart, "s1")
+	SignAccountingRequest(accounting, secret)
+	for _, req := range []*Request{
+		buildAccessRequest("alice", "wonderland", "10.0.0.1"),
+		{Packet: *accounting, Secret: secret},
+		buildAccessRequest("alice", "looking-glass", "10.0.0.1"),
+	} {
+		req.RemoteAddr = client1
+		srv.respond(req)
+	}
+
+	contents, err := os.ReadFile(path + "-" + time.Now().Format("20060102"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := decodeLog(t, contents)
+	if len(entries) != 2 {
+		t.Fatalf("audit log has %d entries, want one per Access-Request:\n%s", len(entries), contents)
+	}
+	if entries[0]["msg"] != "authentication" || entries[0]["outcome"] != "Access-Accept" || entries[0]["time"] == nil {
+		t.Errorf("first audit entry == %v", entries[0])
+	}
+	if entries[1]["outcome"] != "Access-Reject" || entries[1]["reason"] != ReasonInvalidPassword {
+		t.Errorf("second audit entry == %v", entries[1])
+	}
+	if bytes.Contains(contents, []byte("wonderland")) || bytes.Contains(contents, []byte("looking-glass")) {
+		t.Errorf("audit log contains passwords:\n%s", contents)
+	}
+}
+
+func TestRotationFilename(t *testing.T) {
+	at := time.Date(2024, 1, 31, 13, 0, 0, 0, time.UTC)
+	for rotation, want := range map[DetailRotation]string{
+		RotateNever:  "auth.log",
+		RotateHourly: "auth.log-2024013113",
+		RotateDaily:  "auth.log-20240131",
+	} {
+		if name := rotation.filename("auth.log", at); name != want {
+			t.Errorf("filename() with rotation %d == %q, want %q", rotation, name, want)
+		}
+	}
+}
+
+func TestDroppedLogInterval(t *testing.T) {
+	var logged bytes.Buffer
+	srv := &Server{Logger: slog.New(slog.NewJSONHandler(&logged, nil))}
+	for i := 0; i < 3; i++ {
+		srv.dropped(client1, nil, DropUnknownClient)
+	}
+	srv.dropped(client1, nil, DropMalformed)
+
+	entries := decodeLog(t, logged.Bytes())
+	if len(entries) != 2 || entries[0]["reason"] != DropUnknownClient || entries[1]["reason"] != DropMalformed {
+		t.Fatalf("logged %v, want one entry per reason", entries)
+	}
+
+	// The next log after the interval counts the drops which were not logged.
+	srv.dropLogs[DropUnknownClient].time = time.Now().Add(-dropLogInterval)
+	logged.Reset()
+	srv.dropped(client1, nil, DropUnknownClient)
+	if entries := decodeLog(t, logged.Bytes()); len(entries) != 1 || entries[0]["suppressed"] != 2.0 {
+		t.Errorf("logged %v, want 2 suppressed", entries)
+	}
+}
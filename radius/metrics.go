@@ -0,0 +1,268 @@
+package radius
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reasons for which a Server drops a request, as reported by Metrics.
+const (
+	DropMalformed        = "malformed"
+	DropUnknownClient    = "unknown_client"
+	DropBadAuthenticator = "bad_authenticator"
+	DropDuplicate        = "duplicate"
+	DropQueueFull        = "queue_full"
+	DropClientLimit      = "client_limit"
+	// DropNoResponse is counted when the handler of a request returns no response.
+	DropNoResponse = "no_response"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the buckets of the handler latency histograms.
+var latencyBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics collects the metrics of the Servers using it and serves them in the Prometheus text exposition format.
+// Clients are labelled with their NASClient Name, or "unknown" for requests from none, such as those of servers
+// without Clients. The zero value is ready to use.
+type Metrics struct {
+	mu        sync.Mutex
+	requests  map[[2]string]uint64
+	responses map[[2]string]uint64
+	drops     map[[2]string]uint64
+	latencies map[string]*histogram
+	inFlight  int64
+
+	// handled and handlerLatencies are recorded by Middleware, by handler name.
+	handled          map[[2]string]uint64
+	handlerLatencies map[string]*histogram
+}
+
+// histogram counts observations in latencyBuckets.
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// request records a request of client with code, returning a function recording the response once it is sent.
+func (m *Metrics) request(client string, code Code) func(response *Packet) {
+	if m == nil {
+		return func(*Packet) {}
+	}
+
+	start := time.Now()
+	m.mu.Lock()
+	m.init()
+	m.requests[[2]string{client, codeLabel(code)}]++
+	m.inFlight++
+	m.mu.Unlock()
+
+	return func(response *Packet) {
+		elapsed := time.Since(start).Seconds()
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		m.inFlight--
+		m.latencies[codeLabel(code)] = m.latencies[codeLabel(code)].observe(elapsed)
+
+		if response == nil {
+			m.drops[[2]string{client, DropNoResponse}]++
+		} else {
+			m.responses[[2]string{client, codeLabel(response.Code)}]++
+		}
+	}
+}
+
+// observe records an observation of elapsed seconds in h, allocated if nil, and returns h.
+func (h *histogram) observe(elapsed float64) *histogram {
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+	}
+	for i, bound := range latencyBuckets {
+		if elapsed <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += elapsed
+	return h
+}
+
+// Middleware returns Middleware counting the requests of the handler called name, by outcome, and the time it takes
+// to answer them, apart from the requests and responses of the server. It passes requests on unchanged if m is nil.
+func (m *Metrics) Middleware(name string) Middleware {
+	return func(next Handler) Handler {
+		if m == nil {
+			return next
+		}
+		return HandlerFunc(func(req *Request) *Packet {
+			start := time.Now()
+			response := next.ServeRADIUS(req)
+			elapsed := time.Since(start).Seconds()
+
+			outcome := outcomeDropped
+			if response != nil {
+				outcome = codeLabel(response.Code)
+			}
+			m.mu.Lock()
+			m.init()
+			m.handled[[2]string{name, outcome}]++
+			m.handlerLatencies[name] = m.handlerLatencies[name].observe(elapsed)
+			m.mu.Unlock()
+			return response
+		})
+	}
+}
+
+// drop records a request of client dropped for reason.
+func (m *Metrics) drop(client string, reason string) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	m.init()
+	m.drops[[2]string{client, reason}]++
+	m.mu.Unlock()
+}
+
+// init allocates the maps of m. m.mu must be held.
+func (m *Metrics) init() {
+	if m.requests == nil {
+		m.requests = make(map[[2]string]uint64)
+		m.responses = make(map[[2]string]uint64)
+		m.drops = make(map[[2]string]uint64)
+		m.latencies = make(map[string]*histogram)
+		m.handled = make(map[[2]string]uint64)
+		m.handlerLatencies = make(map[string]*histogram)
+	}
+}
+
+// WriteTo writes the metrics to w in the Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	counted := &countingWriter{w: bw}
+
+	clientLabels := [2]string{"client", "code"}
+	writeCounters(counted, "radius_requests_total", "Requests handled, by client and code.", clientLabels, m.requests)
+	writeCounters(counted, "radius_responses_total", "Responses sent, by client and code.", clientLabels, m.responses)
+	writeCounters(counted, "radius_dropped_requests_total", "Requests dropped without response, by client and reason.", [2]string{"client", "reason"}, m.drops)
+
+	fmt.Fprintf(counted, "# HELP radius_requests_in_flight Requests being handled.\n")
+	fmt.Fprintf(counted, "# TYPE radius_requests_in_flight gauge\n")
+	fmt.Fprintf(counted, "radius_requests_in_flight %d\n", m.inFlight)
+
+	writeHistograms(counted, "radius_request_duration_seconds", "Time taken to handle requests, by code.", "code", m.latencies)
+
+	if len(m.handled) > 0 {
+		writeCounters(counted, "radius_handler_requests_total", "Requests passed to handlers, by handler and outcome.", [2]string{"handler", "outcome"}, m.handled)
+		writeHistograms(counted, "radius_handler_duration_seconds", "Time taken by handlers to answer requests, by handler.", "handler", m.handlerLatencies)
+	}
+
+	if err := bw.Flush(); err != nil {
+		return counted.n, err
+	}
+	return counted.n, nil
+}
+
+// writeCounters writes a counter family with two labels, in a stable order.
+func writeCounters(w io.Writer, name string, help string, labels [2]string, values map[[2]string]uint64) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+
+	keys := make([][2]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s{%s=%s,%s=%s} %d\n", name, labels[0], quoteLabel(key[0]), labels[1], quoteLabel(key[1]), values[key])
+	}
+}
+
+// writeHistograms writes a histogram family of latencyBuckets with one label, in a stable order.
+func writeHistograms(w io.Writer, name string, help string, label string, values map[string]*histogram) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		h := values[key]
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(w, "%s_bucket{%s=%s,le=\"%g\"} %d\n", name, label, quoteLabel(key), bound, h.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s=%s,le=\"+Inf\"} %d\n", name, label, quoteLabel(key), h.count)
+		fmt.Fprintf(w, "%s_sum{%s=%s} %g\n", name, label, quoteLabel(key), h.sum)
+		fmt.Fprintf(w, "%s_count{%s=%s} %d\n", name, label, quoteLabel(key), h.count)
+	}
+}
+
+// quoteLabel quotes a label value as the Prometheus text format requires.
+func quoteLabel(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// ListenAndServe serves the metrics over HTTP on addr at /metrics.
+func (m *Metrics) ListenAndServe(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	return http.ListenAndServe(addr, mux)
+}
+
+// codeLabel returns the label of code, its number if it has no name.
+func codeLabel(code Code) string {
+	if text := code.String(); text != "" {
+		return text
+	}
+	return strconv.Itoa(int(code))
+}
+
+// unknownClient is the label of requests from no NASClient, so that spoofed source addresses cannot add labels.
+const unknownClient = "unknown"
+
+// clientLabel returns the label of the client of a request.
+func clientLabel(client *NASClient) string {
+	if client != nil {
+		return client.Name
+	}
+	return unknownClient
+}
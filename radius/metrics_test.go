@@ -0,0 +1,101 @@
+package radius
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := new(Metrics)
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	srv := &Server{Secret: secret, Users: Users{"alice": "{CLEARTEXT}wonderland"}, Metrics: metrics}
+	srv.Handler = HandlerFunc(func(req *Request) *Packet {
+		if req.UserName() == "slow" {
+			started <- struct{}{}
+			<-release
+		}
+		return srv.authenticate(req)
+	})
+	addr := listenTestServer(t, srv)
+
+	client := &Client{Retry: 50 * time.Millisecond, MaxAttempts: 1}
+	defer client.Close()
+	for _, password := range []string{"wonderland", "looking-glass", "looking-glass"} {
+		request, err := NewAccessRequest("alice", password, secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.Exchange(context.Background(), addr, secret, request); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// An Accounting-Request with an invalid authenticator and a truncated packet.
+	unsigned := NewAccountingRequest(AcctStart, "s1")
+	conn.Write(unsigned.packetToBytes())
+	conn.Write([]byte{1, 2, 0, 30})
+
+	// A retransmission of a request being handled.
+	slow, err := NewAccessRequest("slow", "slow", secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write(slow.packetToBytes())
+	<-started
+	conn.Write(slow.packetToBytes())
+
+	want := []string{
+		`radius_requests_total{client="unknown",code="Access-Request"} 4`,
+		`radius_responses_total{client="unknown",code="Access-Accept"} 1`,
+		`radius_responses_total{client="unknown",code="Access-Reject"} 2`,
+		`radius_dropped_requests_total{client="unknown",reason="bad_authenticator"} 1`,
+		`radius_dropped_requests_total{client="unknown",reason="duplicate"} 1`,
+		`radius_dropped_requests_total{client="unknown",reason="malformed"} 1`,
+		`radius_requests_in_flight 1`,
+		`radius_request_duration_seconds_count{code="Access-Request"} 3`,
+		`# TYPE radius_request_duration_seconds histogram`,
+	}
+
+	var exposition string
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		recorder := httptest.NewRecorder()
+		metrics.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+		exposition = recorder.Body.String()
+
+		missing := false
+		for _, line := range want {
+			if !strings.Contains(exposition, line+"\n") {
+				missing = true
+			}
+		}
+		if !missing || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(release)
+
+	for _, line := range want {
+		if !strings.Contains(exposition, line+"\n") {
+			t.Errorf("metrics lack %s in:\n%s", line, exposition)
+		}
+	}
+}
+
+func TestQuoteLabel(t *testing.T) {
+	if quoted := quoteLabel("a\"b\\c\nd"); quoted != `"a\"b\\c\nd"` {
+		t.Errorf("quoteLabel() == %s", quoted)
+	}
+}
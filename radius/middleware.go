@@ -0,0 +1,258 @@
+package radius
+
+import (
+	"container/list"
+	"context"
+	"log"
+	"log/slog"
+	"math"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reasons for which middleware drops requests, as logged by a Server.
+const (
+	ReasonPanic       = "panic"
+	ReasonTimeout     = "timeout"
+	ReasonRateLimited = "rate_limited"
+)
+
+// Middleware wraps a Handler with behavior shared by several handlers, such as the Access-Request, Accounting-Request
+// and CoA-Request handlers of a ServeMux.
+type Middleware func(next Handler) Handler
+
+// Chain returns handler wrapped by middleware, the first of which sees requests first.
+func Chain(handler Handler, middleware ...Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// Recover returns Middleware answering the requests whose handler panics with no response, logging the panic and
+// its stack to logger, or the standard logger if nil. A Server recovers the panics of its Handler in the same way.
+func Recover(logger *slog.Logger) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(req *Request) *Packet {
+			return serveRecovered(next, req, logger)
+		})
+	}
+}
+
+// serveRecovered answers req with handler, or with no response if handler panics, logging the panic to logger, or
+// the standard logger if nil.
+func serveRecovered(handler Handler, req *Request, logger *slog.Logger) (response *Packet) {
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		response, req.Reason = nil, ReasonPanic
+
+		stack := debug.Stack()
+		if logger == nil {
+			log.Printf("radius: panic handling %s from %v: %v\n%s", codeLabel(req.Packet.Code), req.RemoteAddr, v, stack)
+			return
+		}
+		attrs := requestAttrs(req, clientLabel(req.Client))
+		attrs = append(attrs, slog.Any("panic", v), slog.String("stack", string(stack)))
+		logger.LogAttrs(context.Background(), slog.LevelError, "panic", attrs...)
+	}()
+
+	return handler.ServeRADIUS(req)
+}
+
+// Timeout returns Middleware dropping the requests which the handler does not answer within d, so that the client
+// retransmits them or fails over to another server. The handler keeps running with a copy of the request, whose
+// buffer is reused once it is dropped. Its panics are recovered, as by Recover, and logged to the standard logger.
+func Timeout(d time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(req *Request) *Packet {
+			r := *req
+			r.Packet.Attributes = append([]byte(nil), req.Packet.Attributes...)
+			r.attributes = nil
+
+			done := make(chan *Packet, 1)
+			go func() {
+				done <- serveRecovered(next, &r, nil)
+			}()
+
+			timer := time.NewTimer(d)
+			defer timer.Stop()
+			select {
+			case response := <-done:
+				req.Reason = r.Reason
+				return response
+			case <-timer.C:
+				req.Reason = ReasonTimeout
+				return nil
+			}
+		})
+	}
+}
+
+// maxRateBuckets is the number of clients RateLimit tracks. Further clients replace those which are within their
+// limit, swept at most every rateSweepInterval, or else the least recently seen.
+const (
+	maxRateBuckets    = 4096
+	rateSweepInterval = time.Second
+)
+
+// RateLimit returns Middleware letting each client send rate requests per second on average, in bursts of up to
+// burst requests. Clients are told apart by their IP address. Requests over the limit are dropped, so that the client
+// retransmits them later.
+func RateLimit(rate float64, burst int) Middleware {
+	return func(next Handler) Handler {
+		limiter := newRateLimiter(rate, float64(burst))
+		return HandlerFunc(func(req *Request) *Packet {
+			if !limiter.allow(hostIP(req.RemoteAddr).String(), time.Now()) {
+				req.Reason = ReasonRateLimited
+				return nil
+			}
+			return next.ServeRADIUS(req)
+		})
+	}
+}
+
+// rateLimiter holds a token bucket per client, at most maxRateBuckets.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*list.Element
+	// recent holds the *rateBucket of each client, the most recently seen first.
+	recent *list.List
+	swept  time.Time
+}
+
+// rateBucket holds the tokens of a client at a time.
+type rateBucket struct {
+	client string
+	tokens float64
+	time   time.Time
+}
+
+func newRateLimiter(rate float64, burst float64) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: burst, buckets: make(map[string]*list.Element), recent: list.New()}
+}
+
+// fill returns the tokens of b at now, at most burst.
+func (l *rateLimiter) fill(b *rateBucket, now time.Time) float64 {
+	return math.Min(l.burst, b.tokens+now.Sub(b.time).Seconds()*l.rate)
+}
+
+// allow takes a token from the bucket of client at now, reporting whether there was one.
+func (l *rateLimiter) allow(client string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e, ok := l.buckets[client]
+	if ok {
+		l.recent.MoveToFront(e)
+	} else {
+		if len(l.buckets) >= maxRateBuckets {
+			l.evict(now)
+		}
+		e = l.recent.PushFront(&rateBucket{client: client, tokens: l.burst, time: now})
+		l.buckets[client] = e
+	}
+
+	b := e.Value.(*rateBucket)
+	b.tokens, b.time = l.fill(b, now), now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// evict makes room for a new bucket. l.mu must be held.
+func (l *rateLimiter) evict(now time.Time) {
+	if now.Sub(l.swept) >= rateSweepInterval {
+		l.swept = now
+		// Buckets which have filled up again are the same as new ones.
+		for e := l.recent.Front(); e != nil; {
+			next := e.Next()
+			if l.fill(e.Value.(*rateBucket), now) >= l.burst {
+				l.remove(e)
+			}
+			e = next
+		}
+	}
+	if len(l.buckets) >= maxRateBuckets {
+		l.remove(l.recent.Back())
+	}
+}
+
+// remove forgets the bucket e. l.mu must be held.
+func (l *rateLimiter) remove(e *list.Element) {
+	delete(l.buckets, l.recent.Remove(e).(*rateBucket).client)
+}
+
+// Rewrite returns Middleware replacing every value of the attribute key of requests with rewrite(value) before
+// passing them on.
+func Rewrite(key Attribute, rewrite func(value string) string) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(req *Request) *Packet {
+			values := req.Packet.Values(key)
+			rewritten := make([]string, len(values))
+			changed := false
+			for i, v := range values {
+				rewritten[i] = rewrite(string(v))
+				changed = changed || rewritten[i] != string(v)
+			}
+
+			if changed {
+				req.Packet.removeAttribute(0, key)
+				for _, v := range rewritten {
+					req.Packet.AddAttribute(key, []byte(v))
+				}
+				req.attributes = nil
+			}
+			return next.ServeRADIUS(req)
+		})
+	}
+}
+
+// LowercaseUserName returns Middleware converting the User-Name of requests to lower case.
+func LowercaseUserName() Middleware {
+	return Rewrite(UserName, strings.ToLower)
+}
+
+// StripRealm returns Middleware removing the realm from the User-Name of requests, as split by SplitRealm.
+func StripRealm() Middleware {
+	return Rewrite(UserName, func(userName string) string {
+		user, _ := SplitRealm(userName)
+		return user
+	})
+}
+
+// Log returns Middleware logging to logger, at the debug level, the outcome of every request passed to the handler
+// called name, with the reason it was rejected or dropped and the time taken.
+func Log(logger *slog.Logger, name string) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(req *Request) *Packet {
+			start := time.Now()
+			response := next.ServeRADIUS(req)
+			if !logger.Enabled(context.Background(), slog.LevelDebug) {
+				return response
+			}
+
+			outcome := outcomeDropped
+			if response != nil {
+				outcome = codeLabel(response.Code)
+			}
+			attrs := requestAttrs(req, clientLabel(req.Client))
+			attrs = append(attrs, slog.String("handler", name), slog.String("outcome", outcome))
+			if req.Reason != "" {
+				attrs = append(attrs, slog.String("reason", req.Reason))
+			}
+			attrs = append(attrs, slog.Duration("duration", time.Since(start)))
+			logger.LogAttrs(context.Background(), slog.LevelDebug, "handled", attrs...)
+			return response
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package radius
+
+import (
+	"bytes"
+	"log/slog"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// acceptAll answers every request with an Access-Accept.
+var acceptAll = HandlerFunc(func(req *Request) *Packet {
+	return req.Response(AccessAccept)
+})
+
+func TestChain(t *testing.T) {
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return HandlerFunc(func(req *Request) *Packet {
+				order = append(order, name)
+				return next.ServeRADIUS(req)
+			})
+		}
+	}
+
+	req := buildAccessRequest("alice", "wonderland", "10.0.0.1")
+	if response := Chain(acceptAll, trace("a"), trace("b"), trace("c")).ServeRADIUS(req); response == nil {
+		t.Fatal("no response")
+	}
+	if strings.Join(order, ",") != "a,b,c" {
+		t.Errorf("order = %v, want a,b,c", order)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	panicking := HandlerFunc(func(req *Request) *Packet {
+		panic("boom")
+	})
+
+	var logged bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logged, nil))
+	req := buildAccessRequest("alice", "wonderland", "10.0.0.1")
+	req.RemoteAddr = client1
+	if response := Chain(panicking, Recover(logger)).ServeRADIUS(req); response != nil {
+		t.Errorf("response = %v, want none", response)
+	}
+	if req.Reason != ReasonPanic {
+		t.Errorf("Reason = %q, want %q", req.Reason, ReasonPanic)
+	}
+	entries := decodeLog(t, logged.Bytes())
+	if len(entries) != 1 || entries[0]["msg"] != "panic" || entries[0]["panic"] != "boom" || entries[0]["user"] != "alice" ||
+		!strings.Contains(entries[0]["stack"].(string), "TestRecover") {
+		t.Errorf("logged %v", entries)
+	}
+
+	// A Server recovers the panics of its Handler, leaving the request unanswered.
+	logged.Reset()
+	metrics := new(Metrics)
+	srv := &Server{Secret: secret, Handler: panicking, Logger: logger, Metrics: metrics}
+	req = buildAccessRequest("alice", "wonderland", "10.0.0.1")
+	req.RemoteAddr = client1
+	if response := srv.respond(req); response != nil {
+		t.Errorf("server response = %v, want none", response)
+	}
+	entries = decodeLog(t, logged.Bytes())
+	if len(entries) != 2 || entries[1]["outcome"] != outcomeDropped || entries[1]["reason"] != ReasonPanic {
+		t.Errorf("server logged %v", entries)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	handler := Chain(HandlerFunc(func(req *Request) *Packet {
+		if req.UserName() == "slow" {
+			<-release
+		}
+		req.Reason = "handled"
+		return req.Response(AccessAccept)
+	}), Timeout(50*time.Millisecond))
+
+	fast := buildAccessRequest("fast", "pw", "10.0.0.1")
+	if response := handler.ServeRADIUS(fast); response == nil || response.Code != AccessAccept || fast.Reason != "handled" {
+		t.Errorf("fast request: response %v, Reason %q", response, fast.Reason)
+	}
+
+	slow := buildAccessRequest("slow", "pw", "10.0.0.1")
+	start := time.Now()
+	if response := handler.ServeRADIUS(slow); response != nil || slow.Reason != ReasonTimeout {
+		t.Errorf("slow request: response %v, Reason %q", response, slow.Reason)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("slow request dropped after %v", elapsed)
+	}
+	// The handler still running must not see changes to the dropped request.
+	for i := range slow.Packet.Attributes {
+		slow.Packet.Attributes[i] = 0
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	limiter := newRateLimiter(1, 2)
+	now := time.Now()
+
+	cases := []struct {
+		client  string
+		elapsed time.Duration
+		allowed bool
+	}{
+		{"nas1", 0, true},
+		{"nas1", 0, true},
+		{"nas1", 0, false},
+		{"nas2", 0, true},
+		{"nas1", 500 * time.Millisecond, false},
+		{"nas1", time.Second, true},
+		{"nas1", time.Second, false},
+		{"nas1", 10 * time.Second, true},
+		{"nas1", 10 * time.Second, true},
+		{"nas1", 10 * time.Second, false},
+	}
+	for i, c := range cases {
+		if allowed := limiter.allow(c.client, now.Add(c.elapsed)); allowed != c.allowed {
+			t.Errorf("%d: allow(%s, +%v) = %v, want %v", i, c.client, c.elapsed, allowed, c.allowed)
+		}
+	}
+
+	// Without clients within their limit, the least recently seen one is forgotten.
+	limiter = newRateLimiter(0, 2)
+	for i := 0; i < maxRateBuckets; i++ {
+		limiter.allow(strconv.Itoa(i), now)
+	}
+	limiter.allow("0", now)
+	limiter.allow("new", now.Add(time.Millisecond))
+	if _, ok := limiter.buckets["1"]; ok || len(limiter.buckets) != maxRateBuckets {
+		t.Errorf("%d buckets, client 1 kept: %v, want %d without it", len(limiter.buckets), ok, maxRateBuckets)
+	}
+	if _, ok := limiter.buckets["0"]; !ok {
+		t.Error("recently seen client 0 forgotten")
+	}
+
+	// Clients within their limit are forgotten first, swept at most every rateSweepInterval.
+	limiter = newRateLimiter(1, 2)
+	for i := 0; i < maxRateBuckets; i++ {
+		limiter.allow(strconv.Itoa(i), now)
+	}
+	limiter.allow("new", now.Add(time.Second))
+	if len(limiter.buckets) != 1 || limiter.swept != now.Add(time.Second) {
+		t.Errorf("%d buckets after sweeping at %v, want 1", len(limiter.buckets), limiter.swept)
+	}
+	for i := 0; i < maxRateBuckets; i++ {
+		limiter.allow(strconv.Itoa(i), now.Add(time.Second))
+	}
+	limiter.allow("newer", now.Add(3*time.Second/2))
+	if len(limiter.buckets) != maxRateBuckets || limiter.swept != now.Add(time.Second) {
+		t.Errorf("%d buckets, swept at %v, want %d without a second sweep", len(limiter.buckets), limiter.swept, maxRateBuckets)
+	}
+
+	handler := Chain(acceptAll, RateLimit(0, 1))
+	req := buildAccessRequest("alice", "wonderland", "10.0.0.1")
+	req.RemoteAddr = client1
+	if response := handler.ServeRADIUS(req); response == nil {
+		t.Error("first request dropped")
+	}
+	if response := handler.ServeRADIUS(req); response != nil || req.Reason != ReasonRateLimited {
+		t.Errorf("second request: response %v, Reason %q", response, req.Reason)
+	}
+	req.RemoteAddr = client2
+	if response := handler.ServeRADIUS(req); response == nil {
+		t.Error("request of another client dropped")
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	var user string
+	handler := Chain(HandlerFunc(func(req *Request) *Packet {
+		user = req.UserName()
+		return req.Response(AccessAccept)
+	}), StripRealm(), LowercaseUserName())
+
+	cases := map[string]string{
+		"Alice@EXAMPLE.com": "alice",
+		`CORP\Bob`:          "bob",
+		"carol":             "carol",
+	}
+	for userName, expected := range cases {
+		req := buildAccessRequest(userName, "pw", "10.0.0.1")
+		req.Attributes()
+		handler.ServeRADIUS(req)
+		if user != expected {
+			t.Errorf("%s: User-Name = %q, want %q", userName, user, expected)
+		}
+		if nas, ok := req.Packet.Lookup(NASIPAddress); !ok || !bytes.Equal(nas, []byte{10, 0, 0, 1}) {
+			t.Errorf("%s: NAS-IP-Address = %v", userName, nas)
+		}
+		if req.Packet.Length != 20+len(req.Packet.Attributes) {
+			t.Errorf("%s: Length = %d, want %d", userName, req.Packet.Length, 20+len(req.Packet.Attributes))
+		}
+	}
+}
+
+func TestMiddlewareLogAndMetrics(t *testing.T) {
+	var logged bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logged, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	metrics := new(Metrics)
+	handler := Chain(HandlerFunc(func(req *Request) *Packet {
+		if req.UserName() == "bob" {
+			return nil
+		}
+		return req.Response(AccessAccept)
+	}), Log(logger, "auth"), metrics.Middleware("auth"))
+
+	for _, user := range []string{"alice", "bob", "alice"} {
+		req := buildAccessRequest(user, "pw", "10.0.0.1")
+		req.RemoteAddr = client1
+		handler.ServeRADIUS(req)
+	}
+
+	entries := decodeLog(t, logged.Bytes())
+	if len(entries) != 3 || entries[0]["handler"] != "auth" || entries[0]["outcome"] != "Access-Accept" ||
+		entries[1]["user"] != "bob" || entries[1]["outcome"] != outcomeDropped {
+		t.Errorf("logged %v", entries)
+	}
+
+	var b bytes.Buffer
+	metrics.WriteTo(&b)
+	for _, want := range []string{
+		`radius_handler_requests_total{handler="auth",outcome="Access-Accept"} 2`,
+		`radius_handler_requests_total{handler="auth",outcome="dropped"} 1`,
+		`radius_handler_duration_seconds_count{handler="auth"} 3`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("metrics lack %s:\n%s", want, b.String())
+		}
+	}
+
+	// A nil Metrics passes requests on.
+	var none *Metrics
+	if response := Chain(acceptAll, none.Middleware("auth")).ServeRADIUS(buildAccessRequest("alice", "pw", "10.0.0.1")); response == nil {
+		t.Error("no response with nil Metrics")
+	}
+}
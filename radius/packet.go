@@ -2,8 +2,11 @@ package radius
 
 import (
 	"bytes"
+	"crypto/hmac"
 	"crypto/md5"
+	"crypto/rand"
 	"encoding/binary"
+	"errors"
 	"strings"
 )
 
@@ -30,44 +33,223 @@ func (packet *Packet) Equal(other Packet) bool {
 	if packet.Authenticator != other.Authenticator {
 		return false
 	}
-	if packet.DecodedAttributes().Equal(other.DecodedAttributes()) != true {
-		return false
+	// Compare like DecodedAttributes, where the last value of an attribute wins, without building the maps.
+	for it := packet.Iterate(); it.Next(); {
+		value, _ := packet.Lookup(it.Attribute())
+		otherValue, ok := other.Lookup(it.Attribute())
+		if !ok || !bytes.Equal(value, otherValue) {
+			return false
+		}
 	}
 
 	return true
 }
 
-// DecodedAttributes returns the decoded set of Attributes.
+// DecodedAttributes returns the decoded set of Attributes, where the last value of an attribute wins. Attributes
+// from the first malformed one on are left out, as by Iterate.
 func (packet *Packet) DecodedAttributes() Attributes {
-	offset := 0
-
 	var attr = make(Attributes, len(packet.Attributes)/3)
 
-	for offset < len(packet.Attributes) {
-		AttrType := Attribute(packet.Attributes[0+offset])
-		AttrLen := uint8(packet.Attributes[1+offset])
-		RawAttrVal := packet.Attributes[2+offset : int(AttrLen)+offset]
+	for it := packet.Iterate(); it.Next(); {
+		attr[it.Attribute()] = it.Value()
+	}
 
-		attr[AttrType] = RawAttrVal
+	return attr
+}
 
-		offset += int(AttrLen)
+// wellFormed reports whether the attributes of the packet fill it exactly, each with a valid length (RFC 2865
+// section 5).
+func (packet *Packet) wellFormed() bool {
+	it := packet.Iterate()
+	for it.Next() {
 	}
+	// Iteration stops on the remaining octets of a malformed attribute.
+	return len(it.b) == 0
+}
 
-	return attr
+// maxAttributeValue is the largest value that fits in a single attribute.
+const maxAttributeValue = 253
+
+// AddAttribute appends an attribute to the packet. Values longer than 253 bytes are split over consecutive attributes of the same type.
+func (packet *Packet) AddAttribute(key Attribute, value []byte) {
+	for {
+		chunk := value
+		if len(chunk) > maxAttributeValue {
+			chunk = chunk[:maxAttributeValue]
+		}
+
+		packet.Attributes = append(packet.Attributes, uint8(key), uint8(len(chunk)+2))
+		packet.Attributes = append(packet.Attributes, chunk...)
+
+		value = value[len(chunk):]
+		if len(value) == 0 {
+			break
+		}
+	}
+	packet.updateLength()
+}
+
+// maxVendorValue is the largest value that fits in a vendor-specific attribute, after the Vendor-Id and the type and
+// length of the attribute.
+const maxVendorValue = maxAttributeValue - 6
+
+// AddVendorAttribute appends a Vendor-Specific attribute carrying a single attribute of vendor. Values longer than
+// 247 bytes are truncated.
+func (packet *Packet) AddVendorAttribute(vendor uint32, key Attribute, value []byte) {
+	if len(value) > maxVendorValue {
+		value = value[:maxVendorValue]
+	}
+	vsa := make([]byte, 6, 6+len(value))
+	binary.BigEndian.PutUint32(vsa, vendor)
+	vsa[4] = uint8(key)
+	vsa[5] = uint8(len(value) + 2)
+	packet.AddAttribute(VendorSpecific, append(vsa, value...))
+}
+
+// removeAttribute removes every attribute key of vendor, or every standard attribute key if vendor is 0, from the
+// packet. Vendor-Specific attributes left empty are removed too.
+func (packet *Packet) removeAttribute(vendor uint32, key Attribute) {
+	var kept []byte
+	walkAttributes(packet.Attributes, func(t Attribute, value []byte) {
+		if vendor == 0 && t == key {
+			return
+		}
+		if vendor != 0 && t == VendorSpecific && len(value) >= 4 && binary.BigEndian.Uint32(value) == vendor {
+			vsa := append([]byte(nil), value[:4]...)
+			walkAttributes(value[4:], func(t Attribute, value []byte) {
+				if t != key {
+					vsa = append(vsa, uint8(t), uint8(len(value)+2))
+					vsa = append(vsa, value...)
+				}
+			})
+			if len(vsa) == 4 {
+				return
+			}
+			value = vsa
+		}
+		kept = append(kept, uint8(t), uint8(len(value)+2))
+		kept = append(kept, value...)
+	})
+	packet.Attributes = kept
+	packet.updateLength()
+}
+
+// AttributeIterator iterates over the attributes of a packet, parsing them as it goes, without allocating.
+type AttributeIterator struct {
+	b     []byte
+	key   Attribute
+	value []byte
+}
+
+// Iterate returns an iterator over the well-formed attributes of the packet, in order.
+func (packet *Packet) Iterate() AttributeIterator {
+	return AttributeIterator{b: packet.Attributes}
+}
+
+// Next advances the iterator to the next attribute and reports whether there is one. Iteration stops at the first
+// malformed attribute.
+func (it *AttributeIterator) Next() bool {
+	if len(it.b) < 2 {
+		return false
+	}
+	attrLen := int(it.b[1])
+	if attrLen < 2 || attrLen > len(it.b) {
+		return false
+	}
+
+	it.key, it.value, it.b = Attribute(it.b[0]), it.b[2:attrLen], it.b[attrLen:]
+	return true
+}
+
+// Attribute returns the type of the current attribute.
+func (it *AttributeIterator) Attribute() Attribute {
+	return it.key
+}
+
+// Value returns the value of the current attribute. It refers to the packet and is not copied.
+func (it *AttributeIterator) Value() []byte {
+	return it.value
+}
+
+// Lookup returns the last value of the attribute key, as DecodedAttributes would, without allocating.
+func (packet *Packet) Lookup(key Attribute) (value []byte, ok bool) {
+	for it := packet.Iterate(); it.Next(); {
+		if it.Attribute() == key {
+			value, ok = it.Value(), true
+		}
+	}
+	return value, ok
+}
+
+// walkAttributes calls fn with the type and value of every well-formed attribute in b, in order.
+func walkAttributes(b []byte, fn func(key Attribute, value []byte)) {
+	for it := (AttributeIterator{b: b}); it.Next(); {
+		fn(it.Attribute(), it.Value())
+	}
+}
+
+// Values returns every value of the attribute key in the order they appear in the packet.
+func (packet *Packet) Values(key Attribute) [][]byte {
+	var values [][]byte
+
+	walkAttributes(packet.Attributes, func(t Attribute, value []byte) {
+		if t == key {
+			values = append(values, value)
+		}
+	})
+
+	return values
+}
+
+// VendorValues returns every value of the vendor-specific attribute key of vendor in the order they appear in the packet.
+func (packet *Packet) VendorValues(vendor uint32, key Attribute) [][]byte {
+	var values [][]byte
+
+	for _, vsa := range packet.Values(VendorSpecific) {
+		if len(vsa) < 4 || binary.BigEndian.Uint32(vsa) != vendor {
+			continue
+		}
+		walkAttributes(vsa[4:], func(t Attribute, value []byte) {
+			if t == key {
+				values = append(values, value)
+			}
+		})
+	}
+
+	return values
 }
 
 // DecodePacket takes a received packet, packetIn, and ReceiveLength and returns a decoded version of the packet.
+// The attributes of the packet refer to packetIn, which must not be reused while the packet is in use.
 func DecodePacket(packetIn []byte, ReceiveLength int) (packet Packet) {
 
 	packet.Code = Code(packetIn[0])
-	packet.Identifier = int(binary.BigEndian.Uint16([]byte{0, packetIn[1]}))
-	packet.Length = int(binary.BigEndian.Uint16([]byte{packetIn[2], packetIn[3]}))
+	packet.Identifier = int(packetIn[1])
+	packet.Length = int(binary.BigEndian.Uint16(packetIn[2:4]))
 	copy(packet.Authenticator[:], packetIn[4:20])
 	packet.Attributes = packetIn[20:ReceiveLength]
 
 	return
 }
 
+// decodeDatagram decodes the packet received in datagram, ignoring the octets beyond its Length as padding (RFC
+// 2865 section 3). ok is false if datagram does not hold a whole packet or its attributes are malformed, in which
+// case it is silently discarded (RFC 2865 section 5).
+func decodeDatagram(datagram []byte) (packet Packet, ok bool) {
+	if len(datagram) < minPacketLength {
+		return Packet{}, false
+	}
+	length := int(binary.BigEndian.Uint16(datagram[2:4]))
+	if length < minPacketLength || length > len(datagram) {
+		return Packet{}, false
+	}
+	packet = DecodePacket(datagram, length)
+	if !packet.wellFormed() {
+		return Packet{}, false
+	}
+	return packet, true
+}
+
 // updateLength updates the length field in the packet based off the fixed lengths from RFC and the length of the packet attributes.
 func (packet *Packet) updateLength() {
 	packet.Length = 1 + 1 + 2 + 16 + len(packet.Attributes)
@@ -90,42 +272,109 @@ func (packet *Packet) packetToBytes() []byte {
 
 // CalculateResponseAuthenticator takes the received packet, response length, and format of response to create a byte array
 func CalculateResponseAuthenticator(rxPacket Packet, length int, format int, secret string) [16]byte {
-	md5Buff := new(bytes.Buffer)
+	// Packets with secrets of up to 64 octets fit in the buffer, so the hash is computed without allocating.
+	var buffer [maxPacketLength + 64]byte
+	md5Buff := append(buffer[:0], uint8(format), uint8(rxPacket.Identifier), uint8(length>>8), uint8(length))
+	md5Buff = append(md5Buff, rxPacket.Authenticator[:]...)
+	md5Buff = append(md5Buff, rxPacket.Attributes...)
+	md5Buff = append(md5Buff, secret...)
+
+	return md5.Sum(md5Buff)
+}
+
+// PrepareResponse takes a ReceivedPacket and a response built for it, fills in the Identifier and Response Authenticator
+// of the response and returns it ready to pass to a UDP connection. Unless the response already carries Proxy-State
+// attributes, those of ReceivedPacket are copied to it in order, as RFC 2865 section 5.33 requires.
+func PrepareResponse(ReceivedPacket Packet, response *Packet, secret string) []byte {
+	response.Identifier = ReceivedPacket.Identifier
+	if len(response.Values(ProxyState)) == 0 {
+		for _, state := range ReceivedPacket.Values(ProxyState) {
+			response.AddAttribute(ProxyState, state)
+		}
+	}
+	response.updateLength()
 
-	md5Buff.WriteByte(uint8(format))
-	md5Buff.WriteByte(uint8(rxPacket.Identifier))
-	binary.Write(md5Buff, binary.BigEndian, uint16(length))
-	binary.Write(md5Buff, binary.BigEndian, rxPacket.Authenticator)
-	binary.Write(md5Buff, binary.BigEndian, rxPacket.Attributes)
-	md5Buff.WriteString(secret)
+	// A Message-Authenticator in the response is computed over the Request Authenticator (RFC 3579 section 3.2).
+	response.Authenticator = ReceivedPacket.Authenticator
+	signMessageAuthenticator(response, secret)
 
-	ReversePassword(rxPacket.DecodedAttributes()[UserPassword], rxPacket.Authenticator, secret)
+	// The Response Authenticator covers the attributes of the response, not those of the request.
+	signed := Packet{
+		Identifier:    response.Identifier,
+		Authenticator: ReceivedPacket.Authenticator,
+		Attributes:    response.Attributes,
+	}
+	response.Authenticator = CalculateResponseAuthenticator(signed, response.Length, int(response.Code), secret)
 
-	return md5.Sum(md5Buff.Bytes())
+	return response.packetToBytes()
 }
 
-// PrepareAccessAccept takes a ReceivedPacket and builds an Access-Accept resp ready to pass to a UDP connection.
-func PrepareAccessAccept(ReceivedPacket Packet, secret string) []byte {
-	packet := new(Packet)
+// VerifyResponse checks the Response Authenticator of a response received for request.
+func VerifyResponse(request Packet, response Packet, secret string) bool {
+	signed := Packet{
+		Identifier:    response.Identifier,
+		Authenticator: request.Authenticator,
+		Attributes:    response.Attributes,
+	}
+	return CalculateResponseAuthenticator(signed, response.Length, int(response.Code), secret) == response.Authenticator
+}
 
-	packet.Code = AccessAccept
-	packet.Identifier = ReceivedPacket.Identifier
-	packet.updateLength()
-	packet.Authenticator = CalculateResponseAuthenticator(ReceivedPacket, packet.Length, AccessAccept, secret)
+// signMessageAuthenticator fills in the Message-Authenticator of packet, if it has one, as described in RFC 3579
+// section 3.2. The Authenticator of packet must already hold the value the HMAC is computed over.
+func signMessageAuthenticator(packet *Packet, secret string) {
+	var value []byte
+	walkAttributes(packet.Attributes, func(key Attribute, v []byte) {
+		if key == MessageAuthenticator && len(v) == 16 {
+			value = v
+		}
+	})
+	if value == nil {
+		return
+	}
 
-	return packet.packetToBytes()
+	copy(value, make([]byte, 16))
+	mac := hmac.New(md5.New, []byte(secret))
+	mac.Write(packet.packetToBytes())
+	copy(value, mac.Sum(nil))
 }
 
-// PrepareAccessReject takes a ReceivedPacket and builds an Access-Reject resp ready to pass to a UDP connection.
-func PrepareAccessReject(ReceivedPacket Packet, secret string) []byte {
-	packet := new(Packet)
+// verifyMessageAuthenticator checks the Message-Authenticator of a request, as described in RFC 3579 section 3.2.
+// Requests without one fail.
+func verifyMessageAuthenticator(packet Packet, secret string) bool {
+	var received []byte
+	walkAttributes(packet.Attributes, func(key Attribute, value []byte) {
+		if key == MessageAuthenticator && len(value) == 16 && received == nil {
+			received = value
+		}
+	})
+	if received == nil {
+		return false
+	}
 
-	packet.Code = AccessReject
-	packet.Identifier = ReceivedPacket.Identifier
-	packet.updateLength()
-	packet.Authenticator = CalculateResponseAuthenticator(ReceivedPacket, packet.Length, AccessReject, secret)
+	signed := packet
+	signed.Attributes = append([]byte(nil), packet.Attributes...)
+	if packet.Code != AccessRequest && packet.Code != StatusServer {
+		signed.Authenticator = [16]byte{}
+	}
+	signMessageAuthenticator(&signed, secret)
+
+	var computed []byte
+	walkAttributes(signed.Attributes, func(key Attribute, value []byte) {
+		if key == MessageAuthenticator && len(value) == 16 && computed == nil {
+			computed = value
+		}
+	})
+	return hmac.Equal(received, computed)
+}
 
-	return packet.packetToBytes()
+// PrepareAccessAccept takes a ReceivedPacket and builds an Access-Accept resp ready to pass to a UDP connection.
+func PrepareAccessAccept(ReceivedPacket Packet, secret string) []byte {
+	return PrepareResponse(ReceivedPacket, &Packet{Code: AccessAccept}, secret)
+}
+
+// PrepareAccessReject takes a ReceivedPacket and builds an Access-Reject resp ready to pass to a UDP connection.
+func PrepareAccessReject(ReceivedPacket Packet, secret string) []byte {
+	return PrepareResponse(ReceivedPacket, &Packet{Code: AccessReject}, secret)
 }
 
 func ReversePassword(hiddenPassword []byte, authenticator [16]byte, secret string) string {
@@ -165,3 +414,103 @@ func ReversePassword(hiddenPassword []byte, authenticator [16]byte, secret strin
 
 	return strings.Trim(password.String(), "\x00")
 }
+
+// HidePassword obfuscates a User-Password as described in RFC 2865 section 5.2, the inverse of ReversePassword.
+func HidePassword(password string, authenticator [16]byte, secret string) []byte {
+	padded := []byte(password)
+	if len(padded) == 0 || len(padded)%16 != 0 {
+		padded = append(padded, make([]byte, 16-len(padded)%16)...)
+	}
+
+	hidden := make([]byte, len(padded))
+	previous := authenticator[:]
+
+	for offset := 0; offset < len(padded); offset += 16 {
+		bN := md5.Sum(append([]byte(secret), previous...))
+		for i := 0; i < 16; i++ {
+			hidden[offset+i] = padded[offset+i] ^ bN[i]
+		}
+		previous = hidden[offset : offset+16]
+	}
+
+	return hidden
+}
+
+// ErrMalformedTunnelPassword is returned when a Tunnel-Password cannot be decrypted.
+var ErrMalformedTunnelPassword = errors.New("radius: malformed Tunnel-Password")
+
+// HideTunnelPassword encrypts password with a random salt as described in RFC 2868 section 3.5 and returns the
+// value of the Tunnel-Password attribute carrying it. The authenticator is the Request Authenticator of the
+// request, also when the attribute is sent in its response.
+func HideTunnelPassword(password string, tag byte, authenticator [16]byte, secret string) ([]byte, error) {
+	plain := append([]byte{byte(len(password))}, password...)
+	if len(plain)%16 != 0 {
+		plain = append(plain, make([]byte, 16-len(plain)%16)...)
+	}
+
+	value := make([]byte, 3, 3+len(plain))
+	value[0] = tag
+	if _, err := rand.Read(value[1:3]); err != nil {
+		return nil, err
+	}
+	value[1] |= 0x80
+
+	previous := append(authenticator[:], value[1:3]...)
+	for offset := 0; offset < len(plain); offset += 16 {
+		bN := md5.Sum(append([]byte(secret), previous...))
+		for i := 0; i < 16; i++ {
+			value = append(value, plain[offset+i]^bN[i])
+		}
+		previous = value[len(value)-16:]
+	}
+
+	return value, nil
+}
+
+// RevealTunnelPassword decrypts the value of a Tunnel-Password attribute, the inverse of HideTunnelPassword.
+func RevealTunnelPassword(value []byte, authenticator [16]byte, secret string) (password string, tag byte, err error) {
+	if len(value) < 3+16 || (len(value)-3)%16 != 0 {
+		return "", 0, ErrMalformedTunnelPassword
+	}
+
+	var plain []byte
+	previous := append(authenticator[:], value[1:3]...)
+	for offset := 3; offset < len(value); offset += 16 {
+		bN := md5.Sum(append([]byte(secret), previous...))
+		for i := 0; i < 16; i++ {
+			plain = append(plain, value[offset+i]^bN[i])
+		}
+		previous = value[offset : offset+16]
+	}
+
+	if int(plain[0]) > len(plain)-1 {
+		return "", 0, ErrMalformedTunnelPassword
+	}
+	return string(plain[1 : 1+plain[0]]), value[0], nil
+}
+
+// reencryptAttributes returns a copy of attributes where the User-Password and Tunnel-Password values encrypted
+// with fromAuthenticator and fromSecret are encrypted again with toAuthenticator and toSecret. Message-Authenticator
+// values are cleared so that they can be computed again.
+func reencryptAttributes(attributes []byte, fromAuthenticator [16]byte, fromSecret string, toAuthenticator [16]byte, toSecret string) []byte {
+	var packet Packet
+
+	walkAttributes(attributes, func(key Attribute, value []byte) {
+		switch key {
+		case UserPassword:
+			password := ReversePassword(value, fromAuthenticator, fromSecret)
+			value = HidePassword(password, toAuthenticator, toSecret)
+		case TunnelPassword:
+			if password, tag, err := RevealTunnelPassword(value, fromAuthenticator, fromSecret); err == nil {
+				if hidden, err := HideTunnelPassword(password, tag, toAuthenticator, toSecret); err == nil {
+					value = hidden
+				}
+			}
+		case MessageAuthenticator:
+			value = make([]byte, len(value))
+		}
+		packet.AddAttribute(key, value)
+	})
+
+	return packet.Attributes
+}
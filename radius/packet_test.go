@@ -1,9 +1,12 @@
 package radius
 
 import (
+	"bytes"
 	"crypto/md5"
 	"encoding/hex"
+	"errors"
 	"math/rand"
+	"strings"
 	"testing"
 	"time"
 )
@@ -120,6 +123,28 @@ func TestDecodePacket(t *testing.T) {
 	}
 }
 
+func TestMalformedAttributes(t *testing.T) {
+	for _, trailer := range []string{"2c", "2c00", "2c01", "2c0901", "2c02"} {
+		b, _ := hex.DecodeString(trailer)
+		datagram := append([]byte(packet), b...)
+		datagram[2], datagram[3] = byte(len(datagram)>>8), byte(len(datagram))
+
+		if _, ok := decodeDatagram(datagram); ok != (trailer == "2c02") {
+			t.Errorf("%s: decodeDatagram() ok = %v", trailer, ok)
+		}
+
+		// Packets decoded without checking keep the attributes before the malformed one.
+		decoded := DecodePacket(datagram, len(datagram))
+		attributes, want := decoded.DecodedAttributes(), 5
+		if trailer == "2c02" {
+			want = 6
+		}
+		if string(attributes[UserName]) != "example" || len(attributes) != want {
+			t.Errorf("%s: DecodedAttributes() = %v", trailer, attributes)
+		}
+	}
+}
+
 // TODO: Build test for updateLength
 
 // TODO: Build test for packetToBytes
@@ -158,7 +183,40 @@ func TestCalculateResponseAuthenticator(t *testing.T) {
 
 // TODO: Add test for PrepareAccessAccept
 
-// TODO: Add test for PrepareAccessReject
+func TestPrepareAccessRejectProxyState(t *testing.T) {
+	received := buildTestPacket(AccessRequest, identifier, RA2, attr)
+	received.AddAttribute(ProxyState, []byte("first"))
+	received.AddAttribute(UserName, []byte("example"))
+	received.AddAttribute(ProxyState, []byte("second"))
+
+	got := PrepareAccessReject(received, secret)
+
+	// Proxy-State attributes are copied unmodified and in order.
+	responseAttr := "\x21\x07first" + "\x21\x08second"
+	expected := md5.Sum([]byte("\x03\xac" + "\x00\x23" + RA2 + responseAttr + secret))
+
+	if string(got) != "\x03\xac\x00\x23"+string(expected[:])+responseAttr {
+		t.Errorf("PrepareAccessReject == %X, want the Proxy-State attributes of the request", got)
+	}
+}
+
+func TestPrepareResponse(t *testing.T) {
+	received := buildTestPacket(AccessRequest, identifier, RA2, attr)
+
+	response := &Packet{Code: AccessAccept}
+	response.AddAttribute(ReplyMessage, []byte("welcome"))
+	response.AddAttribute(SessionTimeout, []byte("\x00\x00\x0e\x10"))
+
+	got := PrepareResponse(received, response, secret)
+
+	//RA=MD5(Code+ID+Length+RequestAuth+ResponseAttributes+Secret)
+	responseAttr := "\x12\x09welcome" + "\x1b\x06\x00\x00\x0e\x10"
+	expected := md5.Sum([]byte("\x02\xac" + "\x00\x23" + RA2 + responseAttr + secret))
+
+	if string(got) != "\x02\xac\x00\x23"+string(expected[:])+responseAttr {
+		t.Errorf("PrepareResponse == %X, want authenticator %X over the response attributes", got, expected)
+	}
+}
 
 func TestReversePassword(t *testing.T) {
 
@@ -183,3 +241,114 @@ func TestReversePassword(t *testing.T) {
 		}
 	}
 }
+
+func TestAttributeIterator(t *testing.T) {
+	p := DecodePacket([]byte(packet), len(packet))
+	decoded := p.DecodedAttributes()
+
+	count := 0
+	for it := p.Iterate(); it.Next(); count++ {
+		if !bytes.Equal(it.Value(), decoded[it.Attribute()]) {
+			t.Errorf("attribute %v == %X, want %X", it.Attribute(), it.Value(), decoded[it.Attribute()])
+		}
+	}
+	if count != len(decoded) {
+		t.Errorf("iterated over %d attributes, want %d", count, len(decoded))
+	}
+
+	if value, ok := p.Lookup(UserName); !ok || string(value) != "example" {
+		t.Errorf("Lookup(UserName) == %q, %t, want \"example\", true", value, ok)
+	}
+	if value, ok := p.Lookup(ReplyMessage); ok {
+		t.Errorf("Lookup(ReplyMessage) == %q, %t, want not found", value, ok)
+	}
+
+	// Iteration stops at a malformed attribute.
+	p.Attributes = append(p.Attributes[:len(p.Attributes):len(p.Attributes)], uint8(ReplyMessage), 1)
+	if value, ok := p.Lookup(ReplyMessage); ok {
+		t.Errorf("Lookup(ReplyMessage) of malformed attribute == %q, want not found", value)
+	}
+}
+
+func TestDecodeAllocations(t *testing.T) {
+	message := []byte(packet)
+	received := DecodePacket(message, len(message))
+
+	allocations := map[string]func(){
+		"decodeDatagram": func() { decodeDatagram(message) },
+		"Lookup":         func() { received.Lookup(NASIPAddress) },
+		"Iterate": func() {
+			for it := received.Iterate(); it.Next(); {
+			}
+		},
+		"Equal":                          func() { received.Equal(received) },
+		"CalculateResponseAuthenticator": func() { CalculateResponseAuthenticator(received, 20, int(AccessAccept), secret) },
+		"Request.UserName and AuthType":  func() { req := Request{Packet: received}; req.AuthType(); _ = req.UserName() == "" },
+	}
+	for name, f := range allocations {
+		if n := testing.AllocsPerRun(100, f); n != 0 {
+			t.Errorf("%s allocates %v times, want none", name, n)
+		}
+	}
+}
+
+func BenchmarkDecodePacket(b *testing.B) {
+	message := []byte(packet)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p, _ := decodeDatagram(message)
+		p.Lookup(UserName)
+	}
+}
+
+func BenchmarkDecodedAttributes(b *testing.B) {
+	p := DecodePacket([]byte(packet), len(packet))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = p.DecodedAttributes()[UserName]
+	}
+}
+
+func BenchmarkPacketEqual(b *testing.B) {
+	p := DecodePacket([]byte(packet), len(packet))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p.Equal(p)
+	}
+}
+
+func BenchmarkCalculateResponseAuthenticator(b *testing.B) {
+	p := DecodePacket([]byte(packet), len(packet))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		CalculateResponseAuthenticator(p, 20, int(AccessAccept), secret)
+	}
+}
+
+func TestVendorAttributeLength(t *testing.T) {
+	var p Packet
+	p.AddVendorAttribute(9, 1, bytes.Repeat([]byte{'a'}, 300))
+	values := p.VendorValues(9, 1)
+	if len(values) != 1 || len(values[0]) != maxVendorValue {
+		t.Fatalf("vendor values %q, want one of %d bytes", values, maxVendorValue)
+	}
+	if p.Length != 20+len(p.Attributes) || len(p.Attributes) != 255 {
+		t.Errorf("Length = %d with %d bytes of attributes", p.Length, len(p.Attributes))
+	}
+
+	long := strings.Repeat("a", maxVendorValue+1)
+	if err := DefaultDictionary.AddAttribute(&p, "Vendor-9-Attr-1", "0x"+hex.EncodeToString([]byte(long))); err == nil {
+		t.Error("AddAttribute accepted a vendor value of 248 bytes")
+	} else if !strings.Contains(err.Error(), "longer than 247 bytes") {
+		t.Errorf("AddAttribute: err = %v", err)
+	}
+}
+
+func TestUnknownAttributeError(t *testing.T) {
+	if _, _, err := DefaultDictionary.Encode("No-Such-Attribute", "1"); !errors.Is(err, ErrUnknownAttribute) {
+		t.Errorf("Encode: err = %v, want ErrUnknownAttribute", err)
+	}
+	if _, err := DefaultDictionary.Matches(new(Packet), Pair{"No-Such-Attribute", OpCmpEqual, "1"}); !errors.Is(err, ErrUnknownAttribute) {
+		t.Errorf("Matches: err = %v, want ErrUnknownAttribute", err)
+	}
+}
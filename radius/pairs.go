@@ -0,0 +1,251 @@
+package radius
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Operator relates the attribute and value of a check or reply item, as in FreeRADIUS users files and SQL tables.
+type Operator string
+
+// Operators of check and reply items.
+const (
+	OpSet       Operator = ":="
+	OpAdd       Operator = "+="
+	OpEqual     Operator = "="
+	OpCmpEqual  Operator = "=="
+	OpNotEqual  Operator = "!="
+	OpGreater   Operator = ">"
+	OpGreaterEq Operator = ">="
+	OpLess      Operator = "<"
+	OpLessEq    Operator = "<="
+	OpRegex     Operator = "=~"
+	OpNotRegex  Operator = "!~"
+	OpPresent   Operator = "=*"
+	OpAbsent    Operator = "!*"
+)
+
+// Pair is an attribute name, operator and textual value. Tagged attributes are named "Name:tag".
+type Pair struct {
+	Attribute string
+	Op        Operator
+	Value     string
+}
+
+func (p Pair) String() string {
+	return fmt.Sprintf("%s %s %q", p.Attribute, p.Op, p.Value)
+}
+
+// Pairs is an ordered list of check or reply items.
+type Pairs []Pair
+
+// controlCredentials maps the FreeRADIUS control attributes holding a password to the Credential prefix of their value.
+var controlCredentials = map[string]string{
+	"cleartext-password":   "{CLEARTEXT}",
+	"user-password":        "{CLEARTEXT}",
+	"crypt-password":       "{CRYPT}",
+	"nt-password":          "{NT}",
+	"sha-password":         "{SHA}",
+	"sha1-password":        "{SHA}",
+	"ssha-password":        "{SSHA}",
+	"ssha1-password":       "{SSHA}",
+	"sha2-256-password":    "{SHA256}",
+	"ssha2-256-password":   "{SSHA256}",
+	"sha2-512-password":    "{SHA512}",
+	"ssha2-512-password":   "{SSHA512}",
+	"password-with-header": "",
+}
+
+// AuthTypeAttribute is the control attribute forcing the outcome of authentication to Accept or Reject.
+const AuthTypeAttribute = "Auth-Type"
+
+// IsControl reports whether p sets server-side control information, such as the stored password,
+// rather than comparing against the request. Check items using an assignment operator are control items.
+func (p Pair) IsControl() bool {
+	switch p.Op {
+	case OpSet, OpEqual, OpAdd:
+		return true
+	}
+
+	name := strings.ToLower(p.Attribute)
+	if _, ok := controlCredentials[name]; ok {
+		return true
+	}
+	return strings.EqualFold(name, AuthTypeAttribute)
+}
+
+// Merge adds item to the list following its operator: "=" adds the attribute unless it is already present,
+// ":=" replaces any existing value and "+=" always adds it.
+func (p Pairs) Merge(item Pair) Pairs {
+	switch item.Op {
+	case OpSet:
+		kept := p[:0]
+		for _, existing := range p {
+			if !strings.EqualFold(existing.Attribute, item.Attribute) {
+				kept = append(kept, existing)
+			}
+		}
+		return append(kept, item)
+
+	case OpEqual:
+		for _, existing := range p {
+			if strings.EqualFold(existing.Attribute, item.Attribute) {
+				return p
+			}
+		}
+	}
+
+	return append(p, item)
+}
+
+// Lookup returns the value of the first item for attribute name.
+func (p Pairs) Lookup(name string) (value string, ok bool) {
+	for _, item := range p {
+		if strings.EqualFold(item.Attribute, name) {
+			return item.Value, true
+		}
+	}
+	return "", false
+}
+
+// Credential returns the stored password held by the control items of the list.
+func (p Pairs) Credential() (Credential, bool) {
+	for _, item := range p {
+		if prefix, ok := controlCredentials[strings.ToLower(item.Attribute)]; ok {
+			return Credential(prefix + item.Value), true
+		}
+	}
+	return "", false
+}
+
+// AddPairs encodes every item of pairs and appends it to packet.
+func (d *Dictionary) AddPairs(packet *Packet, pairs Pairs) error {
+	for _, item := range pairs {
+		if err := d.AddAttribute(packet, item.Attribute, item.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Matches reports whether packet satisfies the check item p.
+func (d *Dictionary) Matches(packet *Packet, p Pair) (bool, error) {
+	c, err := d.compileCheck(p)
+	if err != nil {
+		return false, err
+	}
+	return c.matches(packet), nil
+}
+
+// check is a check item prepared for matching packets, with its value encoded and its regular expression compiled.
+type check struct {
+	def *AttributeDefinition
+	tag byte
+	op  Operator
+
+	value    string
+	re       *regexp.Regexp
+	expected []byte
+}
+
+// compileCheck prepares the check item p for matching packets.
+func (d *Dictionary) compileCheck(p Pair) (*check, error) {
+	name, tag, err := splitTag(p.Attribute)
+	if err != nil {
+		return nil, err
+	}
+	def, ok := d.Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAttribute, name)
+	}
+
+	c := &check{def: def, tag: tag, op: p.Op, value: p.Value}
+	switch p.Op {
+	case OpPresent, OpAbsent:
+		return c, nil
+	case OpRegex, OpNotRegex:
+		if c.re, err = regexp.Compile(p.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	if def.Type != TypeString && c.re == nil {
+		if c.expected, err = def.Encode(p.Value, 0); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// matches reports whether packet satisfies the check.
+func (c *check) matches(packet *Packet) bool {
+	def := c.def
+
+	var values [][]byte
+	if def.Vendor != 0 {
+		values = packet.VendorValues(def.Vendor, def.Attribute)
+	} else {
+		values = packet.Values(def.Attribute)
+	}
+
+	switch c.op {
+	case OpPresent:
+		return len(values) > 0
+	case OpAbsent:
+		return len(values) == 0
+	}
+
+	matched := false
+	for _, v := range values {
+		text, vTag := def.Format(v)
+		if def.Tagged && c.tag != 0 && vTag != c.tag {
+			continue
+		}
+
+		if c.re != nil {
+			matched = c.re.MatchString(text)
+		} else if c.expected != nil {
+			// Compare wire formats with any tag removed, so that enumerated names and numbers are equivalent.
+			wire, _ := def.Encode(text, 0)
+			matched = compareOrdered(bytes.Compare(wire, c.expected), c.op)
+		} else {
+			matched = compareOrdered(strings.Compare(text, c.value), c.op)
+		}
+
+		if c.op == OpNotEqual || c.op == OpNotRegex {
+			if c.re != nil {
+				matched = !matched
+			}
+			if !matched {
+				return false
+			}
+			continue
+		}
+		if matched {
+			return true
+		}
+	}
+
+	return c.op == OpNotEqual || c.op == OpNotRegex
+}
+
+// compareOrdered applies a comparison operator to the result of a three-way comparison.
+func compareOrdered(cmp int, op Operator) bool {
+	switch op {
+	case OpCmpEqual, OpEqual, OpSet:
+		return cmp == 0
+	case OpNotEqual:
+		return cmp != 0
+	case OpGreater:
+		return cmp > 0
+	case OpGreaterEq:
+		return cmp >= 0
+	case OpLess:
+		return cmp < 0
+	case OpLessEq:
+		return cmp <= 0
+	}
+	return false
+}
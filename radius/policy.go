@@ -0,0 +1,692 @@
+package radius
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy holds rules evaluated for every request before it is answered, written in a small language:
+//
+//	# Comments run to the end of the line.
+//	if (Client == "office-ap" && User-Name =~ "^guest-") {
+//		reply Session-Timeout := 3600
+//		reply Reply-Message = "Welcome"
+//	} elsif (Hour < 7 || Weekday == Sun) {
+//		reject "Access is closed"
+//	} else {
+//		use ldap
+//	}
+//
+// Conditions compare request attributes with the operators of check items, ==, !=, <, <=, >, >=, =~ and !~, or test
+// their presence when an attribute is written alone. They may also compare the name of the NASClient (Client), empty
+// without one, and the local hour (Hour, 0 to 23) and day of the week (Weekday, Sun to Sat) at which the request is
+// handled. Conditions are combined with &&, || and !, and grouped with parentheses.
+//
+// Statements run in order:
+//   - "reply Attribute op value" adds a reply item to Access-Accepts, with the operators =, := and += of Pairs.Merge.
+//   - "reject" answers Access-Requests with an Access-Reject, carrying the optional message that follows as
+//     Reply-Message. Evaluation stops. Other requests, such as Accounting-Requests, are passed to the next handler.
+//   - "use backend" answers Access-Requests with the named backend rather than the next handler.
+//
+// Values are words or double-quoted strings, in which \" and \\ are the only escapes so that regular expressions
+// keep their backslashes. A Policy is compiled once by ParsePolicy and may be used by several goroutines.
+type Policy struct {
+	name       string
+	statements []policyStatement
+	backends   []string
+
+	// now returns the time conditions on Hour and Weekday are evaluated at.
+	now func() time.Time
+}
+
+// ParsePolicy compiles the policy src, named name in errors, checking its attributes and values against dictionary,
+// or DefaultDictionary if nil.
+func ParsePolicy(name string, src []byte, dictionary *Dictionary) (*Policy, error) {
+	if dictionary == nil {
+		dictionary = DefaultDictionary
+	}
+	tokens, err := lexPolicy(name, src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &policyParser{name: name, tokens: tokens, dictionary: dictionary, backends: make(map[string]bool)}
+	statements, err := p.statements(false)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &Policy{name: name, statements: statements, now: time.Now}
+	for backend := range p.backends {
+		policy.backends = append(policy.backends, backend)
+	}
+	sort.Strings(policy.backends)
+	return policy, nil
+}
+
+// LoadPolicy compiles the policy in the file called name.
+func LoadPolicy(name string, dictionary *Dictionary) (*Policy, error) {
+	src, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePolicy(name, src, dictionary)
+}
+
+// Backends returns the sorted names of the backends the policy uses.
+func (p *Policy) Backends() []string {
+	return p.backends
+}
+
+// Handler returns a Handler evaluating the policy for every request, then passing the requests it does not reject
+// to next, or Access-Requests to the backend selected with "use". Its reply items are added to the Access-Accepts
+// returned. It fails if the policy uses a backend missing from backends.
+func (p *Policy) Handler(next Handler, backends map[string]Handler) (Handler, error) {
+	for _, name := range p.backends {
+		if backends[name] == nil {
+			return nil, fmt.Errorf("radius: %s: unknown backend %q", p.name, name)
+		}
+	}
+
+	return HandlerFunc(func(req *Request) *Packet {
+		state := p.evaluate(req)
+		if state.reject != nil && req.Packet.Code == AccessRequest {
+			req.Reason = ReasonPolicyReject
+			response := req.Response(AccessReject)
+			if state.reject.message != "" {
+				response.AddAttribute(ReplyMessage, []byte(state.reject.message))
+			}
+			return response
+		}
+
+		handler := next
+		if state.backend != "" && req.Packet.Code == AccessRequest {
+			handler = backends[state.backend]
+		}
+		response := handler.ServeRADIUS(req)
+		if response != nil && response.Code == AccessAccept {
+			for _, reply := range state.reply {
+				reply.apply(response)
+			}
+		}
+		return response
+	}), nil
+}
+
+// evaluate runs the policy for req.
+func (p *Policy) evaluate(req *Request) *policyState {
+	state := &policyState{req: req, now: p.now()}
+	if req.Client != nil {
+		state.client = req.Client.Name
+	}
+	runPolicy(p.statements, state)
+	return state
+}
+
+// policyState is the outcome of evaluating a policy for a request.
+type policyState struct {
+	req    *Request
+	client string
+	now    time.Time
+
+	reply   []*policyReply
+	backend string
+	reject  *policyReject
+}
+
+// policyStatement is a compiled statement of a policy.
+type policyStatement interface {
+	// run applies the statement to state, returning false if evaluation stops.
+	run(state *policyState) bool
+}
+
+// runPolicy runs statements in order, returning false if one of them stops evaluation.
+func runPolicy(statements []policyStatement, state *policyState) bool {
+	for _, s := range statements {
+		if !s.run(state) {
+			return false
+		}
+	}
+	return true
+}
+
+// policyIf runs the statements of the first branch whose condition holds, or otherwise if none does.
+type policyIf struct {
+	branches []policyBranch
+	// otherwise holds the statements of the else branch.
+	otherwise []policyStatement
+}
+
+type policyBranch struct {
+	condition  policyCondition
+	statements []policyStatement
+}
+
+func (s *policyIf) run(state *policyState) bool {
+	for _, branch := range s.branches {
+		if branch.condition.eval(state) {
+			return runPolicy(branch.statements, state)
+		}
+	}
+	return runPolicy(s.otherwise, state)
+}
+
+// policyReply is a reply item, encoded when the policy is compiled.
+type policyReply struct {
+	def   *AttributeDefinition
+	op    Operator
+	value []byte
+}
+
+func (s *policyReply) run(state *policyState) bool {
+	state.reply = append(state.reply, s)
+	return true
+}
+
+// apply merges the reply item into response.
+func (s *policyReply) apply(response *Packet) {
+	switch s.op {
+	case OpSet:
+		response.removeAttribute(s.def.Vendor, s.def.Attribute)
+	case OpEqual:
+		if s.def.Vendor != 0 && len(response.VendorValues(s.def.Vendor, s.def.Attribute)) > 0 ||
+			s.def.Vendor == 0 && len(response.Values(s.def.Attribute)) > 0 {
+			return
+		}
+	}
+
+	if s.def.Vendor != 0 {
+		response.AddVendorAttribute(s.def.Vendor, s.def.Attribute, s.value)
+	} else {
+		response.AddAttribute(s.def.Attribute, s.value)
+	}
+}
+
+type policyReject struct {
+	message string
+}
+
+func (s *policyReject) run(state *policyState) bool {
+	state.reject = s
+	return false
+}
+
+type policyUse struct {
+	backend string
+}
+
+func (s *policyUse) run(state *policyState) bool {
+	state.backend = s.backend
+	return true
+}
+
+// policyCondition is a compiled condition of a policy.
+type policyCondition interface {
+	eval(state *policyState) bool
+}
+
+type policyNot struct {
+	condition policyCondition
+}
+
+func (c policyNot) eval(state *policyState) bool {
+	return !c.condition.eval(state)
+}
+
+type policyAnd struct {
+	left, right policyCondition
+}
+
+func (c policyAnd) eval(state *policyState) bool {
+	return c.left.eval(state) && c.right.eval(state)
+}
+
+type policyOr struct {
+	left, right policyCondition
+}
+
+func (c policyOr) eval(state *policyState) bool {
+	return c.left.eval(state) || c.right.eval(state)
+}
+
+// policyCheck compares a request attribute.
+type policyCheck struct {
+	check *check
+}
+
+func (c policyCheck) eval(state *policyState) bool {
+	return c.check.matches(&state.req.Packet)
+}
+
+// Variables of policy conditions.
+const (
+	policyClient  = "Client"
+	policyHour    = "Hour"
+	policyWeekday = "Weekday"
+)
+
+// policyVariable compares the client or the time of a request.
+type policyVariable struct {
+	name  string
+	op    Operator
+	value string
+	re    *regexp.Regexp
+	// number is the value of Hour and Weekday comparisons.
+	number int
+}
+
+// compileVariable compiles the comparison of the variable name with value, or returns nil if name is not a variable.
+func compileVariable(name string, op Operator, value string) (*policyVariable, error) {
+	v := &policyVariable{op: op, value: value}
+	for _, variable := range []string{policyClient, policyHour, policyWeekday} {
+		if strings.EqualFold(name, variable) {
+			v.name = variable
+		}
+	}
+
+	var err error
+	switch v.name {
+	case "":
+		return nil, nil
+	case policyClient:
+		if op == OpRegex || op == OpNotRegex {
+			v.re, err = regexp.Compile(value)
+		}
+		return v, err
+	}
+
+	if op == OpRegex || op == OpNotRegex {
+		return nil, fmt.Errorf("%s cannot be compared with %s", v.name, op)
+	}
+	if v.name == policyHour {
+		if v.number, err = strconv.Atoi(value); err != nil || v.number < 0 || v.number > 23 {
+			return nil, fmt.Errorf("invalid hour %q", value)
+		}
+		return v, nil
+	}
+
+	if v.number, err = strconv.Atoi(value); err == nil && v.number >= 0 && v.number <= 6 {
+		return v, nil
+	}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(value, day.String()) || strings.EqualFold(value, day.String()[:3]) {
+			v.number = int(day)
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid weekday %q", value)
+}
+
+func (v *policyVariable) eval(state *policyState) bool {
+	switch v.name {
+	case policyHour:
+		return compareOrdered(cmp.Compare(state.now.Hour(), v.number), v.op)
+	case policyWeekday:
+		return compareOrdered(cmp.Compare(int(state.now.Weekday()), v.number), v.op)
+	}
+
+	if v.re != nil {
+		return v.re.MatchString(state.client) == (v.op == OpRegex)
+	}
+	return compareOrdered(strings.Compare(state.client, v.value), v.op)
+}
+
+// Kinds of policy tokens.
+const (
+	policyWord = iota
+	policyString
+	policyPunct
+	policyEnd
+)
+
+type policyToken struct {
+	kind int
+	text string
+	line int
+}
+
+// policyPuncts are the operators and punctuation of policies, longest first.
+var policyPuncts = []string{"==", "!=", "<=", ">=", "=~", "!~", ":=", "+=", "&&", "||", "<", ">", "=", "!", "(", ")", "{", "}"}
+
+// policyComparisons are the operators of conditions.
+var policyComparisons = map[string]Operator{
+	"==": OpCmpEqual, "!=": OpNotEqual, "<": OpLess, "<=": OpLessEq, ">": OpGreater, ">=": OpGreaterEq,
+	"=~": OpRegex, "!~": OpNotRegex,
+}
+
+// punctAt returns the operator or punctuation starting s, if any.
+func punctAt(s string) string {
+	for _, punct := range policyPuncts {
+		if strings.HasPrefix(s, punct) {
+			return punct
+		}
+	}
+	return ""
+}
+
+// lexPolicy splits src into tokens. Words run until a space, a quote, a comment or punctuation, so that names
+// such as "Tunnel-Type:1" and addresses are single words.
+func lexPolicy(name string, src []byte) ([]policyToken, error) {
+	var tokens []policyToken
+	s, line := string(src), 1
+
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == '\n':
+			line++
+			i++
+
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+
+		case c == '#':
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+
+		case c == '"':
+			var b strings.Builder
+			for i++; ; i++ {
+				if i == len(s) || s[i] == '\n' {
+					return nil, fmt.Errorf("radius: %s:%d: unterminated string", name, line)
+				}
+				if s[i] == '"' {
+					i++
+					break
+				}
+				if s[i] == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\') {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			tokens = append(tokens, policyToken{policyString, b.String(), line})
+
+		default:
+			if punct := punctAt(s[i:]); punct != "" {
+				tokens = append(tokens, policyToken{policyPunct, punct, line})
+				i += len(punct)
+				continue
+			}
+
+			start := i
+			for ; i < len(s) && !strings.ContainsRune(" \t\r\n\"#(){}<>=!&|", rune(s[i])); i++ {
+				if (s[i] == ':' || s[i] == '+') && i+1 < len(s) && s[i+1] == '=' {
+					break
+				}
+			}
+			if i == start {
+				return nil, fmt.Errorf("radius: %s:%d: unexpected %q", name, line, s[i])
+			}
+			tokens = append(tokens, policyToken{policyWord, s[start:i], line})
+		}
+	}
+
+	return append(tokens, policyToken{policyEnd, "", line}), nil
+}
+
+// policyParser compiles the tokens of a policy.
+type policyParser struct {
+	name       string
+	tokens     []policyToken
+	pos        int
+	dictionary *Dictionary
+
+	// backends records the backends used.
+	backends map[string]bool
+}
+
+func (p *policyParser) peek() policyToken {
+	return p.tokens[p.pos]
+}
+
+func (p *policyParser) next() policyToken {
+	t := p.tokens[p.pos]
+	if t.kind != policyEnd {
+		p.pos++
+	}
+	return t
+}
+
+// at reports whether the next token is the punctuation or keyword text.
+func (p *policyParser) at(text string) bool {
+	t := p.peek()
+	return (t.kind == policyPunct || t.kind == policyWord) && t.text == text
+}
+
+func (p *policyParser) errorf(t policyToken, format string, args ...interface{}) error {
+	return fmt.Errorf("radius: %s:%d: %s", p.name, t.line, fmt.Sprintf(format, args...))
+}
+
+// wrap returns err, found compiling the token t, with the line of t.
+func (p *policyParser) wrap(t policyToken, err error) error {
+	return p.errorf(t, "%s", strings.TrimPrefix(err.Error(), "radius: "))
+}
+
+// unexpected returns the error for the token t found in place of what was wanted.
+func (p *policyParser) unexpected(t policyToken, want string) error {
+	switch t.kind {
+	case policyEnd:
+		return p.errorf(t, "unexpected end of policy, want %s", want)
+	case policyString:
+		return p.errorf(t, "unexpected string %q, want %s", t.text, want)
+	}
+	return p.errorf(t, "unexpected %q, want %s", t.text, want)
+}
+
+func (p *policyParser) expect(text string) error {
+	if !p.at(text) {
+		return p.unexpected(p.peek(), strconv.Quote(text))
+	}
+	p.pos++
+	return nil
+}
+
+// word returns the next token, which must be a word.
+func (p *policyParser) word(want string) (policyToken, error) {
+	t := p.next()
+	if t.kind != policyWord {
+		return t, p.unexpected(t, want)
+	}
+	return t, nil
+}
+
+// value returns the next token, which must be a word or a string.
+func (p *policyParser) value() (policyToken, error) {
+	t := p.next()
+	if t.kind != policyWord && t.kind != policyString {
+		return t, p.unexpected(t, "value")
+	}
+	return t, nil
+}
+
+// statements compiles statements until the end of the policy, or the closing brace of a block.
+func (p *policyParser) statements(block bool) ([]policyStatement, error) {
+	var statements []policyStatement
+	for {
+		switch {
+		case p.peek().kind == policyEnd && block:
+			return nil, p.unexpected(p.peek(), `"}"`)
+		case p.peek().kind == policyEnd:
+			return statements, nil
+		case block && p.at("}"):
+			p.pos++
+			return statements, nil
+		}
+
+		s, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, s)
+	}
+}
+
+func (p *policyParser) statement() (policyStatement, error) {
+	t, err := p.word("statement")
+	if err != nil {
+		return nil, err
+	}
+
+	switch t.text {
+	case "if":
+		return p.ifStatement()
+
+	case "reply":
+		attribute, err := p.word("attribute")
+		if err != nil {
+			return nil, err
+		}
+		op := p.next()
+		if o := Operator(op.text); op.kind != policyPunct || o != OpEqual && o != OpSet && o != OpAdd {
+			return nil, p.unexpected(op, "=, := or +=")
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		def, b, err := p.dictionary.Encode(attribute.text, value.text)
+		if err != nil {
+			return nil, p.wrap(attribute, err)
+		}
+		return &policyReply{def: def, op: Operator(op.text), value: b}, nil
+
+	case "reject":
+		s := new(policyReject)
+		if p.peek().kind == policyString {
+			s.message = p.next().text
+		}
+		return s, nil
+
+	case "use":
+		backend, err := p.word("backend")
+		if err != nil {
+			return nil, err
+		}
+		p.backends[backend.text] = true
+		return &policyUse{backend: backend.text}, nil
+	}
+
+	return nil, p.errorf(t, "unknown statement %q", t.text)
+}
+
+func (p *policyParser) ifStatement() (policyStatement, error) {
+	s := new(policyIf)
+	for {
+		condition, err := p.condition()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("{"); err != nil {
+			return nil, err
+		}
+		statements, err := p.statements(true)
+		if err != nil {
+			return nil, err
+		}
+		s.branches = append(s.branches, policyBranch{condition, statements})
+
+		if !p.at("elsif") {
+			break
+		}
+		p.pos++
+	}
+
+	if p.at("else") {
+		p.pos++
+		if err := p.expect("{"); err != nil {
+			return nil, err
+		}
+		var err error
+		if s.otherwise, err = p.statements(true); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// condition compiles conditions joined by ||, which binds less tightly than &&.
+func (p *policyParser) condition() (policyCondition, error) {
+	left, err := p.and()
+	for err == nil && p.at("||") {
+		p.pos++
+		var right policyCondition
+		right, err = p.and()
+		left = policyOr{left, right}
+	}
+	return left, err
+}
+
+func (p *policyParser) and() (policyCondition, error) {
+	left, err := p.unary()
+	for err == nil && p.at("&&") {
+		p.pos++
+		var right policyCondition
+		right, err = p.unary()
+		left = policyAnd{left, right}
+	}
+	return left, err
+}
+
+func (p *policyParser) unary() (policyCondition, error) {
+	switch {
+	case p.at("!"):
+		p.pos++
+		condition, err := p.unary()
+		return policyNot{condition}, err
+
+	case p.at("("):
+		p.pos++
+		condition, err := p.condition()
+		if err != nil {
+			return nil, err
+		}
+		return condition, p.expect(")")
+	}
+
+	return p.comparison()
+}
+
+// comparison compiles the comparison of an attribute or variable with a value, or the presence of an attribute.
+func (p *policyParser) comparison() (policyCondition, error) {
+	name, err := p.word("condition")
+	if err != nil {
+		return nil, err
+	}
+
+	op, ok := policyComparisons[p.peek().text]
+	if !ok || p.peek().kind != policyPunct {
+		if v, _ := compileVariable(name.text, OpCmpEqual, "0"); v != nil {
+			return nil, p.errorf(name, "%s must be compared with a value", v.name)
+		}
+		c, err := p.dictionary.compileCheck(Pair{Attribute: name.text, Op: OpPresent})
+		if err != nil {
+			return nil, p.wrap(name, err)
+		}
+		return policyCheck{c}, nil
+	}
+	p.pos++
+
+	value, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	v, err := compileVariable(name.text, op, value.text)
+	if err != nil {
+		return nil, p.wrap(name, err)
+	}
+	if v != nil {
+		return v, nil
+	}
+
+	c, err := p.dictionary.compileCheck(Pair{Attribute: name.text, Op: op, Value: value.text})
+	if err != nil {
+		return nil, p.wrap(name, err)
+	}
+	return policyCheck{c}, nil
+}
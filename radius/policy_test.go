@@ -0,0 +1,205 @@
+package radius
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPolicy = `
+# Guests are limited, and only let in during office hours.
+if (User-Name =~ "^guest-\d+$") {
+	if (Hour < 8 || Hour >= 18 || Weekday == Sat || Weekday == sunday) {
+		reject "Guest access is closed"
+	}
+	reply Session-Timeout := 600
+	reply Reply-Message += "Welcome, guest"
+} elsif (Client == "branch" && !NAS-IP-Address) {
+	reject
+} elsif (NAS-IP-Address == 192.0.2.1) {
+	use ldap
+}
+reply Filter-Id = "default"
+`
+
+func TestPolicy(t *testing.T) {
+	policy, err := ParsePolicy("policy", []byte(testPolicy), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backends := policy.Backends(); len(backends) != 1 || backends[0] != "ldap" {
+		t.Fatalf("Backends() = %v, want [ldap]", backends)
+	}
+
+	accept := func(name string) Handler {
+		return HandlerFunc(func(req *Request) *Packet {
+			response := req.Response(AccessAccept)
+			response.AddAttribute(ReplyMessage, []byte(name))
+			return response
+		})
+	}
+	if _, err := policy.Handler(accept("next"), nil); err == nil || !strings.Contains(err.Error(), `unknown backend "ldap"`) {
+		t.Fatalf("Handler without backends: err = %v", err)
+	}
+	handler, err := policy.Handler(accept("next"), map[string]Handler{"ldap": accept("ldap")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	monday := time.Date(2024, 6, 3, 10, 0, 0, 0, time.UTC)
+	sunday := time.Date(2024, 6, 2, 10, 0, 0, 0, time.UTC)
+	evening := time.Date(2024, 6, 3, 19, 0, 0, 0, time.UTC)
+
+	withoutNAS := buildAccessRequest("bob", "builder", "10.0.0.1")
+	withoutNAS.Packet = Packet{Code: AccessRequest, Identifier: withoutNAS.Packet.Identifier}
+	withoutNAS.Packet.AddAttribute(UserName, []byte("bob"))
+
+	cases := []struct {
+		req    *Request
+		client string
+		now    time.Time
+
+		code     Code
+		reason   string
+		messages []string
+		filterID string
+		timeout  bool
+	}{
+		{buildAccessRequest("guest-1", "pw", "10.0.0.1"), "office", monday, AccessAccept, "",
+			[]string{"next", "Welcome, guest"}, "default", true},
+		{buildAccessRequest("guest-1", "pw", "10.0.0.1"), "office", sunday, AccessReject, ReasonPolicyReject,
+			[]string{"Guest access is closed"}, "", false},
+		{buildAccessRequest("guest-1", "pw", "10.0.0.1"), "office", evening, AccessReject, ReasonPolicyReject,
+			[]string{"Guest access is closed"}, "", false},
+		{buildAccessRequest("guest-x", "pw", "192.0.2.1"), "office", evening, AccessAccept, "",
+			[]string{"ldap"}, "default", false},
+		{withoutNAS, "branch", monday, AccessReject, ReasonPolicyReject, nil, "", false},
+		{buildAccessRequest("bob", "builder", "10.0.0.1"), "branch", monday, AccessAccept, "",
+			[]string{"next"}, "default", false},
+	}
+
+	for i, c := range cases {
+		policy.now = func() time.Time { return c.now }
+		c.req.RemoteAddr = client1
+		c.req.Client = &NASClient{Name: c.client}
+
+		response := handler.ServeRADIUS(c.req)
+		if response == nil || response.Code != c.code {
+			t.Errorf("%d: response %v, want code %v", i, response, c.code)
+			continue
+		}
+		if c.req.Reason != c.reason {
+			t.Errorf("%d: Reason = %q, want %q", i, c.req.Reason, c.reason)
+		}
+
+		var messages []string
+		for _, v := range response.Values(ReplyMessage) {
+			messages = append(messages, string(v))
+		}
+		if strings.Join(messages, "|") != strings.Join(c.messages, "|") {
+			t.Errorf("%d: Reply-Message = %q, want %q", i, messages, c.messages)
+		}
+		if filterID, _ := response.Lookup(FilterID); string(filterID) != c.filterID {
+			t.Errorf("%d: Filter-Id = %q, want %q", i, filterID, c.filterID)
+		}
+		if _, ok := response.Lookup(SessionTimeout); ok != c.timeout {
+			t.Errorf("%d: Session-Timeout present = %v, want %v", i, ok, c.timeout)
+		}
+	}
+
+	// Requests other than Access-Requests are passed on even if the policy rejects them.
+	policy.now = func() time.Time { return sunday }
+	accounting := &Request{Packet: *NewAccountingRequest(AcctStart, "s1"), Secret: secret, RemoteAddr: client1}
+	accounting.Packet.AddAttribute(UserName, []byte("guest-2"))
+	if response := handler.ServeRADIUS(accounting); response == nil || accounting.Reason != "" {
+		t.Errorf("rejected Accounting-Request answered with %v, Reason %q, want it passed on", response, accounting.Reason)
+	} else if messages := response.Values(ReplyMessage); len(messages) != 1 || string(messages[0]) != "next" {
+		t.Errorf("rejected Accounting-Request answered with Reply-Message %q, want next", messages)
+	}
+}
+
+func TestPolicyReplyOperators(t *testing.T) {
+	policy, err := ParsePolicy("policy", []byte(`
+		reply Session-Timeout := 60
+		reply Filter-Id = "ignored"
+		reply Class += second
+		reply Tunnel-Private-Group-Id:1 := 42
+	`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler, err := policy.Handler(HandlerFunc(func(req *Request) *Packet {
+		response := req.Response(AccessAccept)
+		for _, pair := range (Pairs{
+			{"Session-Timeout", OpAdd, "3600"},
+			{"Session-Timeout", OpAdd, "7200"},
+			{"Filter-Id", OpAdd, "staff"},
+			{"Class", OpAdd, "first"},
+			{"Tunnel-Private-Group-Id:1", OpAdd, "10"},
+			{"Reply-Message", OpAdd, "kept"},
+		}) {
+			if err := DefaultDictionary.AddAttribute(response, pair.Attribute, pair.Value); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return response
+	}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := buildAccessRequest("alice", "wonderland", "10.0.0.1")
+	req.RemoteAddr = client1
+	response := handler.ServeRADIUS(req)
+
+	expected := map[string][]string{
+		"Session-Timeout":         {"60"},
+		"Filter-Id":               {"staff"},
+		"Class":                   {"0x6669727374", "0x7365636f6e64"},
+		"Tunnel-Private-Group-Id": {"42"},
+		"Reply-Message":           {"kept"},
+	}
+	for name, values := range expected {
+		def, _ := DefaultDictionary.Lookup(name)
+		var got []string
+		for _, v := range response.Values(def.Attribute) {
+			text, _ := def.Format(v)
+			got = append(got, text)
+		}
+		if strings.Join(got, "|") != strings.Join(values, "|") {
+			t.Errorf("%s = %q, want %q", name, got, values)
+		}
+	}
+	if int(response.Length) != 20+len(response.Attributes) {
+		t.Errorf("Length = %d, want %d", response.Length, 20+len(response.Attributes))
+	}
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+	cases := []struct {
+		src string
+		err string
+	}{
+		{`reply Session-Timeout := "x"`, "policy:1:"},
+		{"\nreply No-Such-Attribute = 1", "policy:2: unknown attribute"},
+		{`if (User-Name == "a" { reject }`, `policy:1: unexpected "{", want ")"`},
+		{"if (User-Name) {\n reject\n", `policy:3: unexpected end of policy, want "}"`},
+		{`if (User-Name =~ "(") { reject }`, "policy:1: error parsing regexp"},
+		{`if (Hour > 24) { reject }`, `policy:1: invalid hour "24"`},
+		{`if (Weekday == Someday) { reject }`, `policy:1: invalid weekday "Someday"`},
+		{`if (Hour =~ "1") { reject }`, "policy:1: Hour cannot be compared with =~"},
+		{`if (Client) { reject }`, "policy:1: Client must be compared with a value"},
+		{`reply Reply-Message = "unterminated`, "policy:1: unterminated string"},
+		{`accept`, `policy:1: unknown statement "accept"`},
+		{`use "ldap"`, `policy:1: unexpected string "ldap", want backend`},
+		{`if (User-Name & NAS-Port) { reject }`, `policy:1: unexpected '&'`},
+		{`reply Filter-Id == staff`, `policy:1: unexpected "==", want =, := or +=`},
+	}
+
+	for _, c := range cases {
+		_, err := ParsePolicy("policy", []byte(c.src), nil)
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("ParsePolicy(%q): err = %v, want %q", c.src, err, c.err)
+		}
+	}
+}
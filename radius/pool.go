@@ -0,0 +1,243 @@
+package radius
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNoLiveServer is returned by a Pool when every server is dead or already failed the request.
+var ErrNoLiveServer = errors.New("radius: no live server in pool")
+
+// PoolMode selects how a Pool spreads requests over its servers.
+type PoolMode int
+
+// Pool modes.
+const (
+	// PoolFailover sends every request to the first live server, so that later servers are only secondaries.
+	PoolFailover PoolMode = iota
+	// PoolRoundRobin sends requests to the live servers in turn.
+	PoolRoundRobin
+	// PoolLoadBalance sends requests to the live server with the fewest requests in progress.
+	PoolLoadBalance
+)
+
+// PoolServer is an upstream server of a Pool.
+type PoolServer struct {
+	Addr string
+	// Secret is the shared secret of the server. If empty, the Secret of the Pool is used.
+	Secret string
+}
+
+// Pool sends requests to a group of redundant servers. A request that times out is retried on another server, and
+// a server that timed out MaxTimeouts times in a row is marked dead until it answers a Status-Server probe. Pools
+// are created with NewPool.
+type Pool struct {
+	// Client sends the requests. If nil, a Client with default settings is used.
+	Client *Client
+	Mode   PoolMode
+
+	// Secret is the shared secret of servers that have none, and the one User-Passwords of Access-Requests given to
+	// Exchange are hidden with. They are hidden again for servers with another secret.
+	Secret string
+
+	// MaxTimeouts is how many consecutive timeouts mark a server dead, 3 if zero.
+	MaxTimeouts int
+
+	// ProbeInterval is how often dead servers are sent Status-Server, 30 seconds if zero.
+	ProbeInterval time.Duration
+
+	mu      sync.Mutex
+	servers []*poolServer
+	next    int
+	closed  chan struct{}
+}
+
+// poolServer is the state of a server of a Pool.
+type poolServer struct {
+	PoolServer
+
+	timeouts    int
+	dead        bool
+	outstanding int
+}
+
+// NewPool returns a Pool of servers sharing secret, used in the given mode.
+func NewPool(mode PoolMode, secret string, servers ...PoolServer) *Pool {
+	p := &Pool{Mode: mode, Secret: secret, closed: make(chan struct{})}
+	for _, server := range servers {
+		if server.Secret == "" {
+			server.Secret = secret
+		}
+		p.servers = append(p.servers, &poolServer{PoolServer: server})
+	}
+	return p
+}
+
+// Exchange sends packet to a live server of the pool and returns its response, trying the other live servers in
+// turn while requests time out.
+func (p *Pool) Exchange(ctx context.Context, packet *Packet) (*Packet, error) {
+	_, response, _, err := p.exchange(ctx, packet)
+	return response, err
+}
+
+// exchange implements Exchange, also returning the request as sent and the server that answered it.
+func (p *Pool) exchange(ctx context.Context, packet *Packet) (*Packet, *Packet, *poolServer, error) {
+	tried := make(map[*poolServer]bool)
+
+	for {
+		server := p.pick(tried)
+		if server == nil {
+			return nil, nil, nil, ErrNoLiveServer
+		}
+		tried[server] = true
+
+		request := p.requestFor(packet, server)
+		response, err := p.client().Exchange(ctx, server.Addr, server.Secret, request)
+		p.record(server, err)
+		if err == ErrTimeout {
+			continue
+		}
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		return request, response, server, nil
+	}
+}
+
+// Servers returns the servers of the pool and whether each is alive.
+func (p *Pool) Servers() map[string]bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	servers := make(map[string]bool, len(p.servers))
+	for _, server := range p.servers {
+		servers[server.Addr] = !server.dead
+	}
+	return servers
+}
+
+// Close stops probing dead servers.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	select {
+	case <-p.closed:
+	default:
+		close(p.closed)
+	}
+	return nil
+}
+
+func (p *Pool) client() *Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.Client == nil {
+		p.Client = &Client{}
+	}
+	return p.Client
+}
+
+func (p *Pool) maxTimeouts() int {
+	if p.MaxTimeouts <= 0 {
+		return 3
+	}
+	return p.MaxTimeouts
+}
+
+func (p *Pool) probeInterval() time.Duration {
+	if p.ProbeInterval <= 0 {
+		return 30 * time.Second
+	}
+	return p.ProbeInterval
+}
+
+// pick chooses a live server not in tried following the mode of the pool and counts the request as in progress.
+func (p *Pool) pick(tried map[*poolServer]bool) *poolServer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var chosen *poolServer
+	for i := range p.servers {
+		index := i
+		if p.Mode != PoolFailover {
+			index = (p.next + i) % len(p.servers)
+		}
+		server := p.servers[index]
+		if server.dead || tried[server] {
+			continue
+		}
+		if chosen == nil || (p.Mode == PoolLoadBalance && server.outstanding < chosen.outstanding) {
+			chosen = server
+		}
+		if p.Mode != PoolLoadBalance {
+			break
+		}
+	}
+
+	if chosen != nil {
+		chosen.outstanding++
+		p.next = (p.next + 1) % len(p.servers)
+	}
+	return chosen
+}
+
+// record records the outcome of a request sent to server, marking it dead after too many timeouts.
+func (p *Pool) record(server *poolServer, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	server.outstanding--
+	switch err {
+	case nil:
+		server.timeouts = 0
+	case ErrTimeout:
+		server.timeouts++
+		if server.timeouts >= p.maxTimeouts() && !server.dead {
+			server.dead = true
+			go p.probe(server)
+		}
+	}
+}
+
+// probe sends Status-Server to a dead server until it answers, then marks it alive.
+func (p *Pool) probe(server *poolServer) {
+	ticker := time.NewTicker(p.probeInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.closed:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), p.probeInterval())
+		_, err := p.client().Exchange(ctx, server.Addr, server.Secret, NewStatusServer())
+		cancel()
+		if err != nil {
+			continue
+		}
+
+		p.mu.Lock()
+		server.dead = false
+		server.timeouts = 0
+		p.mu.Unlock()
+		return
+	}
+}
+
+// requestFor returns a copy of packet to send to server, with its passwords hidden with the secret of server.
+func (p *Pool) requestFor(packet *Packet, server *poolServer) *Packet {
+	request := *packet
+	if server.Secret == p.Secret {
+		request.Attributes = append([]byte(nil), packet.Attributes...)
+	} else {
+		request.Attributes = reencryptAttributes(packet.Attributes, packet.Authenticator, p.Secret, packet.Authenticator, server.Secret)
+	}
+	return &request
+}
@@ -0,0 +1,118 @@
+package radius
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// upClients knows the clients of a test server only while up is set, so that it drops every request otherwise.
+type upClients struct {
+	up     *atomic.Bool
+	secret string
+}
+
+func (c upClients) ClientByAddr(ip net.IP) *NASClient {
+	if !c.up.Load() {
+		return nil
+	}
+	return &NASClient{Name: "pool", Secret: c.secret}
+}
+
+func (c upClients) ClientByCertificate(cert *x509.Certificate) *NASClient {
+	return nil
+}
+
+// poolTestServer starts a server authenticating alice, answering only while up is set, and counts its requests.
+func poolTestServer(t *testing.T, secret string, up *atomic.Bool, requests *atomic.Int32) string {
+	srv := &Server{Clients: upClients{up, secret}, Users: Users{"alice": "{CLEARTEXT}wonderland"}}
+	mux := NewServeMux()
+	mux.HandleFunc(AccessRequest, func(req *Request) *Packet {
+		requests.Add(1)
+		return srv.authenticate(req)
+	})
+	srv.Handler = mux
+
+	return listenTestServer(t, srv)
+}
+
+func TestPoolFailover(t *testing.T) {
+	var primaryUp, secondaryUp atomic.Bool
+	var primaryRequests, secondaryRequests atomic.Int32
+	secondaryUp.Store(true)
+	primary := poolTestServer(t, "primary", &primaryUp, &primaryRequests)
+	secondary := poolTestServer(t, "secondary", &secondaryUp, &secondaryRequests)
+
+	pool := NewPool(PoolFailover, "primary", PoolServer{Addr: primary}, PoolServer{Addr: secondary, Secret: "secondary"})
+	pool.Client = &Client{Retry: 10 * time.Millisecond, MaxAttempts: 1}
+	pool.MaxTimeouts = 1
+	pool.ProbeInterval = 10 * time.Millisecond
+	defer pool.Close()
+	defer pool.Client.Close()
+
+	exchange := func() Code {
+		request, err := NewAccessRequest("alice", "wonderland", "primary")
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := pool.Exchange(context.Background(), request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response.Code
+	}
+
+	if code := exchange(); code != AccessAccept || secondaryRequests.Load() != 1 {
+		t.Fatalf("request with primary down answered with %v by %d secondary requests, want Access-Accept from the secondary", code, secondaryRequests.Load())
+	}
+	if alive := pool.Servers(); alive[primary] || !alive[secondary] {
+		t.Errorf("Servers() == %v, want the primary dead", alive)
+	}
+
+	primaryUp.Store(true)
+	for deadline := time.Now().Add(2 * time.Second); !pool.Servers()[primary]; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("primary not revived by Status-Server probes")
+		}
+	}
+
+	if code := exchange(); code != AccessAccept || primaryRequests.Load() != 1 {
+		t.Errorf("request with primary revived answered with %v by %d primary requests, want Access-Accept from the primary", code, primaryRequests.Load())
+	}
+
+	secondaryUp.Store(false)
+	primaryUp.Store(false)
+	request, _ := NewAccessRequest("alice", "wonderland", "primary")
+	if _, err := pool.Exchange(context.Background(), request); err != ErrNoLiveServer {
+		t.Errorf("Exchange with every server down returned %v, want %v", err, ErrNoLiveServer)
+	}
+}
+
+func TestPoolRoundRobin(t *testing.T) {
+	var up atomic.Bool
+	var first, second atomic.Int32
+	up.Store(true)
+
+	pool := NewPool(PoolRoundRobin, secret, PoolServer{Addr: poolTestServer(t, secret, &up, &first)},
+		PoolServer{Addr: poolTestServer(t, secret, &up, &second)})
+	pool.Client = &Client{}
+	defer pool.Close()
+	defer pool.Client.Close()
+
+	for i := 0; i < 4; i++ {
+		request, err := NewAccessRequest("alice", "wonderland", secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pool.Exchange(context.Background(), request); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if first.Load() != 2 || second.Load() != 2 {
+		t.Errorf("servers received %d and %d requests, want 2 each", first.Load(), second.Load())
+	}
+}
@@ -0,0 +1,170 @@
+package radius
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Realm names with a special meaning in Proxy.Realms, as in FreeRADIUS.
+const (
+	// RealmDefault matches requests whose realm is not listed.
+	RealmDefault = "DEFAULT"
+	// RealmNull matches requests whose User-Name has no realm.
+	RealmNull = "NULL"
+)
+
+// SplitRealm separates the realm from a User-Name written as "user@realm" or "REALM\user". The realm is empty
+// if there is none.
+func SplitRealm(userName string) (user string, realm string) {
+	if i := strings.IndexByte(userName, '\\'); i >= 0 {
+		return userName[i+1:], userName[:i]
+	}
+	if i := strings.LastIndexByte(userName, '@'); i >= 0 {
+		return userName[:i], userName[i+1:]
+	}
+	return userName, ""
+}
+
+// Realm is the group of home servers the requests of a realm are proxied to.
+type Realm struct {
+	// Pool holds the home servers of the realm. If nil, the requests of the realm are handled locally.
+	Pool *Pool
+
+	// Strip removes the realm from the User-Name sent to the home servers.
+	Strip bool
+}
+
+// Proxy is a Handler forwarding Access-Requests and Accounting-Requests to the home servers of the realm of their
+// User-Name. Passwords are encrypted again with the secret of the home server, and the reply is relayed with the
+// passwords it carries encrypted for the client. Other requests are passed to Local.
+type Proxy struct {
+	// Realms maps realm names, compared without case, to their home servers. See RealmDefault and RealmNull.
+	Realms map[string]*Realm
+
+	// Local handles requests that are not proxied. If nil, they are not answered.
+	Local Handler
+
+	// Timeout bounds the time spent waiting for the home servers, 30 seconds if zero.
+	Timeout time.Duration
+
+	// state numbers the Proxy-State attributes added to proxied requests.
+	state uint32
+}
+
+// ServeRADIUS proxies req if its realm has home servers, or passes it to Local.
+func (p *Proxy) ServeRADIUS(req *Request) *Packet {
+	realm := p.realm(req)
+	if realm == nil || realm.Pool == nil {
+		if p.Local == nil {
+			return nil
+		}
+		return p.Local.ServeRADIUS(req)
+	}
+
+	if req.Packet.Code == AccountingRequest && !VerifyAccountingRequest(req.Packet, req.Secret) {
+		log.Printf("radius: dropping Accounting-Request from %v with invalid authenticator", req.RemoteAddr)
+		return nil
+	}
+
+	request, state, err := p.proxyRequest(req, realm)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout())
+	defer cancel()
+
+	sent, response, server, err := realm.Pool.exchange(ctx, request)
+	if err != nil {
+		log.Printf("radius: proxying %s of %q: %v", req.Packet.Code, req.UserName(), err)
+		return nil
+	}
+
+	return proxyReply(req, sent, response, server.Secret, state)
+}
+
+func (p *Proxy) timeout() time.Duration {
+	if p.Timeout <= 0 {
+		return 30 * time.Second
+	}
+	return p.Timeout
+}
+
+// realm returns the realm req is proxied to, or nil if it is handled locally.
+func (p *Proxy) realm(req *Request) *Realm {
+	if req.Packet.Code != AccessRequest && req.Packet.Code != AccountingRequest {
+		return nil
+	}
+
+	_, name := SplitRealm(req.UserName())
+	if name == "" {
+		name = RealmNull
+	}
+	for _, candidate := range []string{name, RealmDefault} {
+		for realmName, realm := range p.Realms {
+			if strings.EqualFold(realmName, candidate) {
+				return realm
+			}
+		}
+		if name == RealmNull {
+			break
+		}
+	}
+
+	return nil
+}
+
+// proxyRequest builds the request sent to the home servers of realm for req, ending with a Proxy-State of ours.
+func (p *Proxy) proxyRequest(req *Request, realm *Realm) (*Packet, []byte, error) {
+	request := &Packet{Code: req.Packet.Code}
+	if request.Code == AccessRequest {
+		if _, err := rand.Read(request.Authenticator[:]); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	attributes := reencryptAttributes(req.Packet.Attributes, req.Packet.Authenticator, req.Secret, request.Authenticator, realm.Pool.Secret)
+	walkAttributes(attributes, func(key Attribute, value []byte) {
+		if key == UserName && realm.Strip {
+			user, _ := SplitRealm(string(value))
+			value = []byte(user)
+		}
+		request.AddAttribute(key, value)
+	})
+
+	// Without CHAP-Challenge, the Request Authenticator is the challenge of CHAP-Password (RFC 2865 section 2.2),
+	// which the home server needs once the authenticator is replaced.
+	if request.Code == AccessRequest && len(req.Packet.Values(CHAPPassword)) > 0 && len(req.Packet.Values(CHAPChallenge)) == 0 {
+		request.AddAttribute(CHAPChallenge, req.Packet.Authenticator[:])
+	}
+
+	state := make([]byte, 4)
+	binary.BigEndian.PutUint32(state, atomic.AddUint32(&p.state, 1))
+	request.AddAttribute(ProxyState, state)
+
+	return request, state, nil
+}
+
+// proxyReply builds the reply to req from the response of a home server to sent, whose secret is homeSecret,
+// removing the Proxy-State added by proxyRequest.
+func proxyReply(req *Request, sent *Packet, response *Packet, homeSecret string, state []byte) *Packet {
+	reply := req.Response(response.Code)
+
+	stripped := false
+	attributes := reencryptAttributes(response.Attributes, sent.Authenticator, homeSecret, req.Packet.Authenticator, req.Secret)
+	walkAttributes(attributes, func(key Attribute, value []byte) {
+		if key == ProxyState && !stripped && string(value) == string(state) {
+			stripped = true
+			return
+		}
+		reply.AddAttribute(key, value)
+	})
+
+	return reply
+}
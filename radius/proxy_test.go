@@ -0,0 +1,140 @@
+package radius
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"testing"
+)
+
+func TestSplitRealm(t *testing.T) {
+	cases := []struct {
+		userName, user, realm string
+	}{
+		{"alice", "alice", ""},
+		{"alice@example.com", "alice", "example.com"},
+		{"alice@home@example.com", "alice@home", "example.com"},
+		{`EXAMPLE\alice`, "alice", "EXAMPLE"},
+	}
+
+	for _, c := range cases {
+		if user, realm := SplitRealm(c.userName); user != c.user || realm != c.realm {
+			t.Errorf("SplitRealm(%q) == %q, %q, want %q, %q", c.userName, user, realm, c.user, c.realm)
+		}
+	}
+}
+
+func TestProxy(t *testing.T) {
+	// The home server authenticates users without realm.
+	home := &Server{Secret: "home", Users: Users{"alice": "{CLEARTEXT}wonderland"}}
+	homeMux := NewServeMux()
+	homeMux.HandleFunc(AccessRequest, func(req *Request) *Packet {
+		response := home.authenticate(req)
+		if response.Code == AccessAccept {
+			tunnelPassword, err := HideTunnelPassword("tunnel", 1, req.Packet.Authenticator, req.Secret)
+			if err != nil {
+				t.Error(err)
+			}
+			response.AddAttribute(TunnelPassword, tunnelPassword)
+			response.AddAttribute(MessageAuthenticator, make([]byte, 16))
+		}
+		return response
+	})
+	accounted := make(chan string, 1)
+	homeMux.HandleFunc(AccountingRequest, func(req *Request) *Packet {
+		if !VerifyAccountingRequest(req.Packet, req.Secret) {
+			return nil
+		}
+		accounted <- req.UserName()
+		return req.Response(AccountingResponse)
+	})
+	home.Handler = homeMux
+	homeAddr := listenTestServer(t, home)
+
+	pool := NewPool(PoolFailover, "home", PoolServer{Addr: homeAddr})
+	pool.Client = &Client{}
+	defer pool.Close()
+	defer pool.Client.Close()
+
+	proxy := &Proxy{
+		Realms: map[string]*Realm{"example.com": {Pool: pool, Strip: true}},
+		Local: HandlerFunc(func(req *Request) *Packet {
+			return req.Response(AccessReject)
+		}),
+	}
+	proxyAddr := listenTestServer(t, &Server{Secret: secret, Handler: proxy})
+
+	client := &Client{}
+	defer client.Close()
+
+	cases := []struct {
+		user, password string
+		want           Code
+	}{
+		{"alice@EXAMPLE.com", "wonderland", AccessAccept},
+		{"alice@example.com", "looking-glass", AccessReject},
+		// Handled locally.
+		{"alice", "wonderland", AccessReject},
+	}
+
+	for _, c := range cases {
+		request, err := NewAccessRequest(c.user, c.password, secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.AddAttribute(ProxyState, []byte("downstream"))
+		response, err := client.Exchange(context.Background(), proxyAddr, secret, request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.Code != c.want {
+			t.Errorf("%s with password %q answered with %v, want %v", c.user, c.password, response.Code, c.want)
+		}
+		if response.Code != AccessAccept {
+			continue
+		}
+
+		if states := response.Values(ProxyState); len(states) != 1 || string(states[0]) != "downstream" {
+			t.Errorf("reply Proxy-State == %q, want only the one of the request", states)
+		}
+		password, tag, err := RevealTunnelPassword(response.Values(TunnelPassword)[0], request.Authenticator, secret)
+		if password != "tunnel" || tag != 1 || err != nil {
+			t.Errorf("reply Tunnel-Password == %q:%d, %v, want \"tunnel\" encrypted with the client secret", password, tag, err)
+		}
+		signed := Packet{Code: response.Code, Identifier: response.Identifier, Authenticator: request.Authenticator}
+		signed.Attributes = append(signed.Attributes, response.Attributes...)
+		signMessageAuthenticator(&signed, secret)
+		if !bytes.Equal(signed.Attributes, response.Attributes) {
+			t.Errorf("reply Message-Authenticator not computed with the client secret")
+		}
+	}
+
+	// CHAP, whose challenge is the Request Authenticator the proxy replaces.
+	for _, password := range []string{"wonderland", "looking-glass"} {
+		request := &Packet{Code: AccessRequest}
+		if _, err := rand.Read(request.Authenticator[:]); err != nil {
+			t.Fatal(err)
+		}
+		chapResponse := md5.Sum(append(append([]byte{7}, password...), request.Authenticator[:]...))
+		request.AddAttribute(UserName, []byte("alice@example.com"))
+		request.AddAttribute(CHAPPassword, append([]byte{7}, chapResponse[:]...))
+		response, err := client.Exchange(context.Background(), proxyAddr, secret, request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := map[bool]Code{true: AccessAccept, false: AccessReject}[password == "wonderland"]; response.Code != want {
+			t.Errorf("CHAP with password %q answered with %v, want %v", password, response.Code, want)
+		}
+	}
+
+	request := NewAccountingRequest(AcctStart, "s1")
+	request.AddAttribute(UserName, []byte(`alice@example.com`))
+	response, err := client.Exchange(context.Background(), proxyAddr, secret, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user := <-accounted; response.Code != AccountingResponse || user != "alice" {
+		t.Errorf("Accounting-Request answered with %v after home server accounted %q, want %v for alice", response.Code, user, AccountingResponse)
+	}
+}
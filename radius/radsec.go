@@ -0,0 +1,113 @@
+package radius
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"strings"
+	"time"
+)
+
+// RadSecPort is the port of RADIUS over TLS (RFC 6614 section 2.1).
+const RadSecPort = "2083"
+
+// RadSecSecret is the shared secret of every request and response sent over TLS (RFC 6614 section 2.3).
+const RadSecSecret = "radsec"
+
+// ErrUnknownCertificate is returned when a TLS client presents a certificate matching none of the Clients of a
+// Server.
+var ErrUnknownCertificate = errors.New("radius: certificate of unknown client")
+
+// ErrNoClientCAs is returned when a Server is started over TLS or DTLS without the certificates client
+// certificates are verified against.
+var ErrNoClientCAs = errors.New("radius: TLSConfig.ClientCAs not set")
+
+// ListenAndServeTLS listens for RADIUS over TLS connections, as described in RFC 6614, on srv.Addr or
+// ":2083" if empty, and serves their requests with RadSecSecret. The certificate of the server is loaded from
+// certFile and keyFile unless TLSConfig already has one.
+//
+// Clients must present a certificate verified against TLSConfig.ClientCAs, without which ErrNoClientCAs is returned.
+// If the server has Clients, the certificate must also match the Identity of one of them.
+func (srv *Server) ListenAndServeTLS(certFile, keyFile string) error {
+	config, err := srv.serverTLSConfig(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+
+	network := "tcp"
+	if strings.HasPrefix(srv.Net, "tcp") {
+		network = srv.Net
+	}
+	addr := srv.Addr
+	if addr == "" {
+		addr = ":" + RadSecPort
+	}
+
+	srv.Listener, err = tls.Listen(network, addr, config)
+	if err != nil {
+		return err
+	}
+
+	defer srv.Listener.Close()
+
+	return srv.serveTCP()
+}
+
+// serverTLSConfig returns a copy of TLSConfig completed with the certificate in certFile and keyFile and the
+// settings required by RFC 6614.
+func (srv *Server) serverTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	// Any certificate issued by a public authority would be accepted with the system roots.
+	if srv.TLSConfig == nil || srv.TLSConfig.ClientCAs == nil {
+		return nil, ErrNoClientCAs
+	}
+	config := srv.TLSConfig.Clone()
+	if len(config.Certificates) == 0 && config.GetCertificate == nil {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if config.ClientAuth == tls.NoClientCert {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	// RFC 6614 section 2.3 requires TLS 1.1 or later; older versions than 1.2 are not offered.
+	if config.MinVersion == 0 {
+		config.MinVersion = tls.VersionTLS12
+	}
+	return config, nil
+}
+
+// tlsClient completes the handshake of conn within IdleTimeout and returns the client presenting the peer
+// certificate, or nil if the server has no Clients.
+func (srv *Server) tlsClient(conn *tls.Conn) (*NASClient, error) {
+	conn.SetDeadline(time.Now().Add(srv.idleTimeout()))
+	defer conn.SetDeadline(time.Time{})
+
+	if err := conn.Handshake(); err != nil {
+		return nil, err
+	}
+
+	var cert *x509.Certificate
+	if certificates := conn.ConnectionState().PeerCertificates; len(certificates) > 0 {
+		cert = certificates[0]
+	}
+	return srv.certificateClient(cert)
+}
+
+// certificateClient returns the client presenting cert, which is nil if the peer sent none, or nil if the server
+// has no Clients.
+func (srv *Server) certificateClient(cert *x509.Certificate) (*NASClient, error) {
+	if srv.Clients == nil {
+		return nil, nil
+	}
+	if cert == nil {
+		return nil, ErrUnknownCertificate
+	}
+
+	client := srv.Clients.ClientByCertificate(cert)
+	if client == nil {
+		return nil, ErrUnknownCertificate
+	}
+	return client, nil
+}
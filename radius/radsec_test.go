@@ -0,0 +1,162 @@
+package radius
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCA issues certificates for tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue returns a certificate for name, valid for servers and clients, with name as Common Name and DNS name.
+func (ca *testCA) issue(t *testing.T, name string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// listenTestTLSServer starts srv over TLS on a random local port, with a certificate from ca, and returns its
+// address.
+func listenTestTLSServer(t *testing.T, srv *Server, ca *testCA) string {
+	config := &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, "radius.example.com")},
+		ClientCAs:    ca.pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	srv.Listener = listener
+	go srv.serveTCP()
+
+	return listener.Addr().String()
+}
+
+func TestRadSec(t *testing.T) {
+	ca := newTestCA(t)
+	nas := &NASClient{Name: "nas1", Identity: "nas1.example.com"}
+	clients := make(chan *NASClient, 1)
+	srv := &Server{Clients: NASClients{nas}, Users: Users{"alice": "{CLEARTEXT}wonderland"}, Metrics: new(Metrics)}
+	srv.Handler = HandlerFunc(func(req *Request) *Packet {
+		clients <- req.Client
+		return srv.authenticate(req)
+	})
+	addr := listenTestTLSServer(t, srv, ca)
+
+	radsec := func(cert string) (*Packet, error) {
+		c := &Client{Net: "tls", MaxAttempts: 1, Retry: time.Second, TLSConfig: &tls.Config{
+			RootCAs:    ca.pool,
+			ServerName: "radius.example.com",
+		}}
+		if cert != "" {
+			c.TLSConfig.Certificates = []tls.Certificate{ca.issue(t, cert)}
+		}
+		defer c.Close()
+
+		request, err := NewAccessRequest("alice", "wonderland", RadSecSecret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c.Exchange(context.Background(), addr, RadSecSecret, request)
+	}
+
+	response, err := radsec("nas1.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Code != AccessAccept {
+		t.Errorf("Access-Request over TLS answered with %v, want %v", response.Code, AccessAccept)
+	}
+	if client := <-clients; client != nas {
+		t.Errorf("request over TLS from %v, want %v", client, nas)
+	}
+
+	for _, cert := range []string{"", "nas2.example.com"} {
+		if response, err := radsec(cert); err == nil {
+			t.Errorf("Access-Request over TLS with certificate %q answered with %v, want connection closed", cert, response.Code)
+		}
+	}
+
+	// Only the client whose certificate was verified but matched no NASClient is counted as unknown.
+	var b bytes.Buffer
+	for deadline := time.Now().Add(2 * time.Second); !strings.Contains(b.String(), `reason="unknown_client"} 1`); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("metrics lack exactly one unknown client:\n%s", b.String())
+		}
+		b.Reset()
+		srv.Metrics.WriteTo(&b)
+	}
+}
+
+func TestRadSecWithoutClientCAs(t *testing.T) {
+	ca := newTestCA(t)
+	srv := &Server{Addr: "127.0.0.1:0", TLSConfig: &tls.Config{Certificates: []tls.Certificate{ca.issue(t, "radius.example.com")}}}
+	if err := srv.ListenAndServeTLS("", ""); err != ErrNoClientCAs {
+		t.Errorf("ListenAndServeTLS without ClientCAs returned %v, want %v", err, ErrNoClientCAs)
+	}
+	if err := srv.ListenAndServeDTLS("", ""); err != ErrNoClientCAs {
+		t.Errorf("ListenAndServeDTLS without ClientCAs returned %v, want %v", err, ErrNoClientCAs)
+	}
+}
@@ -0,0 +1,130 @@
+package radius
+
+import "net"
+
+// Request is a RADIUS packet received by a Server, along with where it came from. The attributes of the packet
+// refer to the buffer it was received in, which is reused once the request is answered: handlers must copy the
+// values they keep.
+type Request struct {
+	Packet     Packet
+	RemoteAddr net.Addr
+	// LocalAddr is the address of the server the request was received on.
+	LocalAddr net.Addr
+
+	// Secret is the shared secret of the client that sent the request.
+	Secret string
+	// Client is the NAS that sent the request, or nil if the server has no Clients.
+	Client *NASClient
+
+	// Reason explains the outcome of the request in the logs of the server, such as why it was rejected. Handlers
+	// may set it.
+	Reason string
+
+	attributes Attributes
+}
+
+// Handler responds to a RADIUS request by returning the response to send, or nil to send nothing.
+// The Identifier and Authenticator of the response are filled in by the Server.
+type Handler interface {
+	ServeRADIUS(req *Request) *Packet
+}
+
+// HandlerFunc adapts an ordinary function to a Handler.
+type HandlerFunc func(req *Request) *Packet
+
+// ServeRADIUS calls f(req).
+func (f HandlerFunc) ServeRADIUS(req *Request) *Packet {
+	return f(req)
+}
+
+// ServeMux dispatches requests to the Handler registered for their Code. Requests with no handler get no response.
+type ServeMux struct {
+	handlers map[Code]Handler
+}
+
+// NewServeMux returns an empty ServeMux.
+func NewServeMux() *ServeMux {
+	return &ServeMux{handlers: make(map[Code]Handler)}
+}
+
+// Handle registers handler for requests with the given code.
+func (mux *ServeMux) Handle(code Code, handler Handler) {
+	mux.handlers[code] = handler
+}
+
+// HandleFunc registers a handler function for requests with the given code.
+func (mux *ServeMux) HandleFunc(code Code, handler func(req *Request) *Packet) {
+	mux.Handle(code, HandlerFunc(handler))
+}
+
+// ServeRADIUS dispatches req to the handler registered for its code.
+func (mux *ServeMux) ServeRADIUS(req *Request) *Packet {
+	handler, ok := mux.handlers[req.Packet.Code]
+	if !ok {
+		return nil
+	}
+	return handler.ServeRADIUS(req)
+}
+
+// Attributes returns the decoded attributes of the request.
+func (req *Request) Attributes() Attributes {
+	if req.attributes == nil {
+		req.attributes = req.Packet.DecodedAttributes()
+	}
+	return req.attributes
+}
+
+// attribute returns the value of key in the request, looked up in the packet unless Attributes was already called.
+func (req *Request) attribute(key Attribute) ([]byte, bool) {
+	if req.attributes != nil {
+		value, ok := req.attributes[key]
+		return value, ok
+	}
+	return req.Packet.Lookup(key)
+}
+
+// UserName returns the User-Name of the request.
+func (req *Request) UserName() string {
+	userName, _ := req.attribute(UserName)
+	return string(userName)
+}
+
+// Password returns the cleartext User-Password of the request.
+func (req *Request) Password() string {
+	password, _ := req.attribute(UserPassword)
+	return ReversePassword(password, req.Packet.Authenticator, req.Secret)
+}
+
+// AuthType returns the authentication method used by the request, or 0 if it carries no known password attribute.
+func (req *Request) AuthType() AuthType {
+	if _, ok := req.attribute(UserPassword); ok {
+		return PAP
+	}
+	if _, ok := req.attribute(CHAPPassword); ok {
+		return CHAP
+	}
+
+	return 0
+}
+
+// Verify checks the password carried by the request against a stored credential.
+func (req *Request) Verify(credential Credential) (bool, error) {
+	switch req.AuthType() {
+	case PAP:
+		return credential.Verify(req.Password())
+	case CHAP:
+		challenge, ok := req.attribute(CHAPChallenge)
+		if !ok {
+			challenge = req.Packet.Authenticator[:]
+		}
+		chapPassword, _ := req.attribute(CHAPPassword)
+		return credential.VerifyCHAP(chapPassword, challenge)
+	}
+
+	return false, ErrUnsupportedAuthType
+}
+
+// Response returns an empty response of the given code to the request.
+func (req *Request) Response(code Code) *Packet {
+	return &Packet{Code: code, Identifier: req.Packet.Identifier}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package radius
+
+import (
+	"errors"
+	"syscall"
+)
+
+// reusePort fails: SO_REUSEPORT is only supported on Linux.
+func reusePort(network, address string, c syscall.RawConn) error {
+	return errors.New("radius: SO_REUSEPORT is not supported on this platform")
+}
@@ -1,49 +1,174 @@
 package radius
 
 import (
+	"crypto/tls"
 	"log"
+	"log/slog"
 	"net"
+	"strings"
+	"sync"
+	"time"
 )
 
 // Server based off RFC 2865 (RADIUS).
 type Server struct {
 	Net  string
 	Addr string
+	// Addrs lists the UDP addresses to listen on, such as the authentication ports of several interfaces. If empty,
+	// the server listens on Addr.
+	Addrs []string
+	// Role is the service provided on the addresses of the server, authentication if zero. Accounting and
+	// authentication ports are served by separate servers.
+	Role Role
+
+	// Readers is the number of goroutines reading the requests received on each UDP address, 1 if zero. With
+	// ReusePort, each of them reads its own socket bound with SO_REUSEPORT, letting the kernel spread the requests
+	// over them. ReusePort is only supported on Linux.
+	Readers   int
+	ReusePort bool
 
 	Conn  *net.UDPConn
 	SAddr *net.UDPAddr
 
+	// Listener accepts the connections of RADIUS over TCP clients, as described in RFC 6613. It is set by
+	// ListenAndServe when Net is "tcp", "tcp4" or "tcp6".
+	Listener net.Listener
+
+	// IdleTimeout is how long a TCP connection may stay without receiving a request before it is closed, 30
+	// seconds if zero.
+	IdleTimeout time.Duration
+
 	// Secret is the shared secret used by the RADIUS server and clients.
 	Secret string
+
+	// Clients holds the NASes allowed to send requests, along with their secret. If nil, requests from any
+	// address are answered using Secret.
+	Clients ClientStore
+
+	// TLSConfig configures the RadSec listener started by ListenAndServeTLS.
+	TLSConfig *tls.Config
+
+	// Handler responds to received requests. If nil, Access-Requests are authenticated against Users and
+	// Accounting-Requests are stored in Accounting. Requests whose Handler panics are not answered.
+	Handler Handler
+
+	// Users holds the credentials requests are verified against when Handler is nil. If nil, Authenticate is used.
+	Users UserStore
+
+	// Accounting stores Accounting-Requests when Handler is nil. If nil, Accounting-Requests are not answered.
+	Accounting AccountingStore
+
+	// Statistics adds the server statistics to responses to Status-Server requests asking for them.
+	Statistics bool
+
+	// Metrics collects the metrics of the server if set.
+	Metrics *Metrics
+
+	// Logger logs the outcome of every request if set, with its client, User-Name, Calling-Station-Id,
+	// NAS-IP-Address and the reason it was rejected or dropped. Passwords are never logged. Requests dropped before
+	// being handled, such as those of unknown clients or received while the queue is full, are logged at most once
+	// a second for each reason, with the number of those which were not.
+	Logger *slog.Logger
+	// AuditLog records the outcome of Access-Requests if set.
+	AuditLog *AuditLog
+
+	// Workers is the number of requests handled at once. Requests received while all workers are busy wait in a
+	// queue of QueueSize, 16 per worker if zero. If Workers is zero, each request is handled as soon as it is
+	// received. The workers exit once the server stops serving, after handling the queued requests.
+	Workers   int
+	QueueSize int
+	// DropPolicy selects the request dropped when the queue is full.
+	DropPolicy DropPolicy
+	// MaxInFlight limits the requests of a client queued or being handled. Further requests are dropped. There is
+	// no limit if zero.
+	MaxInFlight int
+
+	// dispatchMu guards jobs, started on first use, and the number of sockets and connections serving requests.
+	dispatchMu sync.Mutex
+	jobs       *dispatcher
+	sockets    int
+
+	pendingMu sync.Mutex
+	pending   map[pendingRequest]struct{}
+
+	dropLogMu sync.Mutex
+	dropLogs  map[string]*dropLog
+
+	statsMu sync.Mutex
+	stats   ServerStats
 }
 
+// packetBuffers holds the buffers packets are received in, reused once their request is answered.
+var packetBuffers = sync.Pool{New: func() interface{} { return new([maxPacketLength]byte) }}
+
 type connection struct {
-	message    []byte
-	length     int
+	buffer     *[maxPacketLength]byte
+	packet     Packet
 	server     *Server
+	socket     *udpSocket
 	remoteAddr *net.UDPAddr
+	client     *NASClient
+	secret     string
+	// localAddr is the address the packet was sent to, and ifIndex the interface it arrived on, if known.
+	localAddr *net.UDPAddr
+	ifIndex   int
 }
 
-// HandlePacket takes a received UDP client and h
+// HandlePacket answers a packet received from a UDP client and releases its buffer.
 func (conn *connection) HandlePacket() {
-	conn.Response(DecodePacket(conn.message, conn.length))
+	defer conn.release()
+	conn.Response(conn.packet)
+}
+
+// release returns the buffer of the connection to packetBuffers.
+func (conn *connection) release() {
+	packetBuffers.Put(conn.buffer)
 }
 
 func (srv *Server) serve() (err error) {
+	srv.recordStart()
+
+	return srv.serveUDP(newUDPSocket(srv.Conn))
+}
+
+// serveUDP reads the requests received on socket and hands them to the workers until socket is closed.
+func (srv *Server) serveUDP(socket *udpSocket) error {
+	defer srv.serving()()
 
 	packetCount := 0
 
 	for {
 		clientConn := new(connection)
 		clientConn.server = srv
-		clientConn.message = make([]byte, 1024)
+		clientConn.socket = socket
+		clientConn.buffer = packetBuffers.Get().(*[maxPacketLength]byte)
 
-		// Wait for connection and then handle it in a new go routine.
-		clientConn.length, clientConn.remoteAddr, err = srv.Conn.ReadFromUDP(clientConn.message[:])
+		// Wait for a packet and then hand it to the workers.
+		length, remoteAddr, localAddr, ifIndex, err := socket.readFrom(clientConn.buffer[:])
 		if err != nil {
+			clientConn.release()
 			return err
 		}
-		go clientConn.HandlePacket()
+		if remoteAddr == nil {
+			clientConn.release()
+			continue
+		}
+		packet, ok := decodeDatagram(clientConn.buffer[:length])
+		if !ok {
+			srv.dropped(remoteAddr, nil, DropMalformed)
+			clientConn.release()
+			continue
+		}
+		client, secret, ok := srv.clientFor(remoteAddr)
+		if !ok {
+			srv.dropped(remoteAddr, nil, DropUnknownClient)
+			clientConn.release()
+			continue
+		}
+		clientConn.packet, clientConn.remoteAddr = packet, remoteAddr
+		clientConn.client, clientConn.secret = client, secret
+		clientConn.localAddr, clientConn.ifIndex = localAddr, ifIndex
+		srv.dispatcher().submit(remoteAddr, client, clientConn.HandlePacket, clientConn.release)
 		packetCount++
 	}
 }
@@ -59,35 +184,206 @@ func (srv *Server) ListenAndServe() (err error) {
 		addr = ":1812"
 	}
 
-	srv.SAddr, err = net.ResolveUDPAddr(network, addr)
-	if err != nil {
-		return
+	if strings.HasPrefix(network, "tcp") {
+		srv.Listener, err = net.Listen(network, addr)
+		if err != nil {
+			return
+		}
+
+		defer srv.Listener.Close()
+
+		return srv.serveTCP()
 	}
 
-	srv.Conn, err = net.ListenUDP(network, srv.SAddr)
+	addrs := srv.Addrs
+	if len(addrs) == 0 {
+		addrs = []string{addr}
+	}
+	conns, err := srv.listenAddrs(network, addrs)
 	if err != nil {
 		return
 	}
 
-	defer srv.Conn.Close()
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+
+	srv.Conn = conns[0]
+	srv.SAddr = srv.Conn.LocalAddr().(*net.UDPAddr)
+
+	return srv.serveConns(conns)
+
+}
+
+// listenAddrs opens the UDP sockets of the server on every address of addrs.
+func (srv *Server) listenAddrs(network string, addrs []string) ([]*net.UDPConn, error) {
+	var conns []*net.UDPConn
+	for _, addr := range addrs {
+		addrConns, err := srv.listenUDP(network, addr)
+		if err != nil {
+			for _, conn := range conns {
+				conn.Close()
+			}
+			return nil, err
+		}
+		conns = append(conns, addrConns...)
+	}
+	return conns, nil
+}
+
+// serveConns serves the requests received on conns, read by Readers goroutines per address, until one of them
+// fails. The sockets are left open.
+func (srv *Server) serveConns(conns []*net.UDPConn) error {
+	srv.recordStart()
 
-	return srv.serve()
+	readers := srv.readers()
+	if srv.ReusePort {
+		// Each socket has its own reader.
+		readers = 1
+	}
 
+	errs := make(chan error, len(conns)*readers)
+	for _, conn := range conns {
+		socket := newUDPSocket(conn)
+		for i := 0; i < readers; i++ {
+			go func() {
+				errs <- srv.serveUDP(socket)
+			}()
+		}
+	}
+	return <-errs
 }
 
-// Response sends a UDP response using the ReceivedPacket to addr over the established UDP conn.
+// Response sends a UDP response using the ReceivedPacket to addr over the established UDP conn, from the local
+// address the request was sent to.
 func (conn *connection) Response(ReceivedPacket Packet) {
-	var err error
+	req := &Request{Packet: ReceivedPacket, RemoteAddr: conn.remoteAddr, LocalAddr: conn.localAddr, Secret: conn.secret, Client: conn.client}
 
-	var DecodedAttributes = ReceivedPacket.DecodedAttributes()
+	response := conn.server.respond(req)
+	if response == nil {
+		return
+	}
 
-	if Authenticate(string(DecodedAttributes[UserName]), string(DecodedAttributes[UserPassword])) {
-		_, err = conn.server.Conn.WriteToUDP(PrepareAccessAccept(ReceivedPacket, conn.server.Secret), conn.remoteAddr)
+	err := conn.socket.writeTo(response, conn.remoteAddr, conn.localAddr, conn.ifIndex)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// respond returns the encoded response to req, or nil if it gets none. Requests with an invalid authenticator and
+// retransmissions of a request being handled are dropped. Status-Server requests are answered by the server itself,
+// other requests by its Handler, whose panics are logged and leave the request unanswered. The outcome of every
+// request is logged.
+func (srv *Server) respond(req *Request) []byte {
+	start := time.Now()
+	client := clientLabel(req.Client)
+	if !authenticRequest(req) {
+		srv.Metrics.drop(client, DropBadAuthenticator)
+		srv.logRequest(req, client, nil, DropBadAuthenticator, time.Since(start))
+		return nil
+	}
+	if !srv.begin(req) {
+		srv.Metrics.drop(client, DropDuplicate)
+		srv.logRequest(req, client, nil, DropDuplicate, time.Since(start))
+		return nil
+	}
+	defer srv.end(req)
+
+	handler := srv.Handler
+	if handler == nil {
+		handler = HandlerFunc(srv.serveDefault)
+	}
+
+	handled := srv.Metrics.request(client, req.Packet.Code)
+	var response *Packet
+	if req.Packet.Code == StatusServer {
+		response = srv.serveStatus(req)
 	} else {
-		_, err = conn.server.Conn.WriteToUDP(PrepareAccessReject(ReceivedPacket, conn.server.Secret), conn.remoteAddr)
+		response = serveRecovered(handler, req, srv.Logger)
+		srv.count(req, response)
+	}
+	handled(response)
+	srv.logRequest(req, client, response, "", time.Since(start))
+	if response == nil {
+		return nil
 	}
 
-	if err != nil {
-		log.Fatalln(err)
+	return PrepareResponse(req.Packet, response, req.Secret)
+}
+
+// authenticRequest reports whether the authenticators of req are valid: the Request Authenticator of requests
+// signed with the shared secret, and the Message-Authenticator that Status-Server requires and other requests may
+// carry.
+func authenticRequest(req *Request) bool {
+	switch req.Packet.Code {
+	case AccountingRequest, CoARequest, DisconnectRequest:
+		if !VerifyAccountingRequest(req.Packet, req.Secret) {
+			return false
+		}
+	}
+
+	if _, ok := req.Packet.Lookup(MessageAuthenticator); ok || req.Packet.Code == StatusServer {
+		return verifyMessageAuthenticator(req.Packet, req.Secret)
+	}
+	return true
+}
+
+// pendingRequest identifies a request being handled, to recognize its retransmissions.
+type pendingRequest struct {
+	remoteAddr    string
+	identifier    int
+	authenticator [16]byte
+}
+
+// begin records that req is being handled. It returns false if it is a retransmission of a request being handled.
+func (srv *Server) begin(req *Request) bool {
+	key := pendingRequest{req.RemoteAddr.String(), req.Packet.Identifier, req.Packet.Authenticator}
+
+	srv.pendingMu.Lock()
+	defer srv.pendingMu.Unlock()
+
+	if _, ok := srv.pending[key]; ok {
+		return false
+	}
+	if srv.pending == nil {
+		srv.pending = make(map[pendingRequest]struct{})
+	}
+	srv.pending[key] = struct{}{}
+	return true
+}
+
+// end records that req was handled.
+func (srv *Server) end(req *Request) {
+	srv.pendingMu.Lock()
+	delete(srv.pending, pendingRequest{req.RemoteAddr.String(), req.Packet.Identifier, req.Packet.Authenticator})
+	srv.pendingMu.Unlock()
+}
+
+// serveDefault is the handler used when no Handler is set.
+func (srv *Server) serveDefault(req *Request) *Packet {
+	switch req.Packet.Code {
+	case AccessRequest:
+		return srv.authenticate(req)
+	case AccountingRequest:
+		if srv.Accounting != nil {
+			return AccountingHandler{Store: srv.Accounting}.ServeRADIUS(req)
+		}
+	}
+
+	return nil
+}
+
+// authenticate checks passwords against the server's user store, falling back to Authenticate.
+func (srv *Server) authenticate(req *Request) *Packet {
+	if srv.Users != nil {
+		return AuthenticationHandler{Users: srv.Users}.ServeRADIUS(req)
+	}
+
+	if Authenticate(req.UserName(), req.Password()) {
+		return req.Response(AccessAccept)
 	}
+	req.Reason = ReasonInvalidPassword
+	return req.Response(AccessReject)
 }
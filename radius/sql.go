@@ -0,0 +1,212 @@
+package radius
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+)
+
+// SQLQueries are the queries run by SQLBackend, modelled on the FreeRADIUS rlm_sql schema. Each query takes a
+// single argument, the user name or the group name, written with the placeholder syntax of the database driver.
+// The check and reply queries return rows of attribute, op and value. An empty query is skipped.
+type SQLQueries struct {
+	UserCheck string
+	UserReply string
+	// UserGroups returns the names of the groups of a user in priority order.
+	UserGroups string
+	GroupCheck string
+	GroupReply string
+}
+
+// DefaultSQLQueries read the radcheck, radreply, radusergroup, radgroupcheck and radgroupreply tables using "?" placeholders.
+var DefaultSQLQueries = SQLQueries{
+	UserCheck:  "SELECT attribute, op, value FROM radcheck WHERE username = ? ORDER BY id",
+	UserReply:  "SELECT attribute, op, value FROM radreply WHERE username = ? ORDER BY id",
+	UserGroups: "SELECT groupname FROM radusergroup WHERE username = ? ORDER BY priority",
+	GroupCheck: "SELECT attribute, op, value FROM radgroupcheck WHERE groupname = ? ORDER BY id",
+	GroupReply: "SELECT attribute, op, value FROM radgroupreply WHERE groupname = ? ORDER BY id",
+}
+
+// SQLBackend authenticates and authorizes Access-Requests against users and groups held in a database.
+// It is a Handler and a UserStore.
+type SQLBackend struct {
+	DB      *sql.DB
+	Queries SQLQueries
+
+	// Dictionary is used to compare check items and encode reply items. If nil, DefaultDictionary is used.
+	Dictionary *Dictionary
+}
+
+// NewSQLBackend returns an SQLBackend reading db with DefaultSQLQueries.
+func NewSQLBackend(db *sql.DB) *SQLBackend {
+	return &SQLBackend{DB: db, Queries: DefaultSQLQueries}
+}
+
+func (b *SQLBackend) dictionary() *Dictionary {
+	if b.Dictionary == nil {
+		return DefaultDictionary
+	}
+	return b.Dictionary
+}
+
+// pairs runs query with arg and returns the resulting attribute, op and value rows.
+func (b *SQLBackend) pairs(query string, arg string) (Pairs, error) {
+	if query == "" {
+		return nil, nil
+	}
+
+	rows, err := b.DB.Query(query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pairs Pairs
+	for rows.Next() {
+		var p Pair
+		var op string
+		if err := rows.Scan(&p.Attribute, &op, &p.Value); err != nil {
+			return nil, err
+		}
+		p.Op = Operator(strings.TrimSpace(op))
+		pairs = append(pairs, p)
+	}
+
+	return pairs, rows.Err()
+}
+
+// groups returns the groups of user.
+func (b *SQLBackend) groups(user string) ([]string, error) {
+	if b.Queries.UserGroups == "" {
+		return nil, nil
+	}
+
+	rows, err := b.DB.Query(b.Queries.UserGroups, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []string
+	for rows.Next() {
+		var group string
+		if err := rows.Scan(&group); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, rows.Err()
+}
+
+// Credential returns the stored password of user from its check items.
+func (b *SQLBackend) Credential(user string) (Credential, error) {
+	check, err := b.pairs(b.Queries.UserCheck, user)
+	if err != nil {
+		return "", err
+	}
+
+	credential, ok := check.Credential()
+	if !ok {
+		return "", ErrUnknownUser
+	}
+
+	return credential, nil
+}
+
+// check splits items into control items and comparisons and returns the control items if every comparison matches req.
+func (b *SQLBackend) check(req *Request, items Pairs) (control Pairs, matched bool, err error) {
+	for _, item := range items {
+		if item.IsControl() {
+			control = control.Merge(item)
+			continue
+		}
+
+		ok, err := b.dictionary().Matches(&req.Packet, item)
+		if err != nil || !ok {
+			return nil, false, err
+		}
+	}
+
+	return control, true, nil
+}
+
+// Authorize gathers the control and reply items of the user of req from the user and group tables.
+// found is false if the database has no entry for the user or the user's check items do not match req.
+func (b *SQLBackend) Authorize(req *Request) (control Pairs, reply Pairs, found bool, err error) {
+	user := req.UserName()
+
+	userCheck, err := b.pairs(b.Queries.UserCheck, user)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	control, found, err = b.check(req, userCheck)
+	if err != nil || !found {
+		return nil, nil, false, err
+	}
+	found = len(userCheck) > 0
+
+	userReply, err := b.pairs(b.Queries.UserReply, user)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	for _, item := range userReply {
+		reply = reply.Merge(item)
+	}
+	found = found || len(userReply) > 0
+
+	groups, err := b.groups(user)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	for _, group := range groups {
+		groupCheck, err := b.pairs(b.Queries.GroupCheck, group)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		groupControl, matched, err := b.check(req, groupCheck)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if !matched {
+			continue
+		}
+		found = true
+
+		for _, item := range groupControl {
+			control = control.Merge(item)
+		}
+
+		groupReply, err := b.pairs(b.Queries.GroupReply, group)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		for _, item := range groupReply {
+			reply = reply.Merge(item)
+		}
+	}
+
+	return control, reply, found, nil
+}
+
+// ServeRADIUS answers an Access-Request with an Access-Accept carrying the user's reply items if the user is
+// found and the password matches the stored credential, and with an Access-Reject otherwise. Other requests get no
+// response.
+func (b *SQLBackend) ServeRADIUS(req *Request) *Packet {
+	if req.Packet.Code != AccessRequest {
+		return nil
+	}
+
+	control, reply, found, err := b.Authorize(req)
+	if err != nil {
+		log.Println(err)
+		req.Reason = err.Error()
+		return req.Response(AccessReject)
+	}
+	if !found {
+		req.Reason = ReasonUnknownUser
+		return req.Response(AccessReject)
+	}
+
+	return AcceptWithPairs(req, control, reply, b.dictionary())
+}
@@ -0,0 +1,123 @@
+package radius
+
+import (
+	"database/sql"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const sqlSchema = `
+CREATE TABLE radcheck (id INTEGER PRIMARY KEY, username TEXT, attribute TEXT, op TEXT, value TEXT);
+CREATE TABLE radreply (id INTEGER PRIMARY KEY, username TEXT, attribute TEXT, op TEXT, value TEXT);
+CREATE TABLE radusergroup (username TEXT, groupname TEXT, priority INTEGER);
+CREATE TABLE radgroupcheck (id INTEGER PRIMARY KEY, groupname TEXT, attribute TEXT, op TEXT, value TEXT);
+CREATE TABLE radgroupreply (id INTEGER PRIMARY KEY, groupname TEXT, attribute TEXT, op TEXT, value TEXT);
+
+INSERT INTO radcheck (username, attribute, op, value) VALUES
+	('alice', 'Cleartext-Password', ':=', 'wonderland'),
+	('bob', 'Crypt-Password', ':=', '$1$saltsalt$9xy1btjgzLYfb7hivXtC//'),
+	('carol', 'Cleartext-Password', ':=', 'secret'),
+	('carol', 'NAS-IP-Address', '==', '10.0.0.1'),
+	('dave', 'Auth-Type', ':=', 'Reject');
+INSERT INTO radreply (username, attribute, op, value) VALUES
+	('alice', 'Session-Timeout', ':=', '3600'),
+	('alice', 'Reply-Message', '+=', 'Hello alice');
+INSERT INTO radusergroup (username, groupname, priority) VALUES
+	('alice', 'staff', 1),
+	('alice', 'local', 2),
+	('bob', 'staff', 1);
+INSERT INTO radgroupcheck (groupname, attribute, op, value) VALUES
+	('local', 'NAS-IP-Address', '==', '127.0.0.1');
+INSERT INTO radgroupreply (groupname, attribute, op, value) VALUES
+	('staff', 'Filter-Id', '=', 'staff'),
+	('staff', 'Session-Timeout', '=', '600'),
+	('local', 'Framed-IP-Address', ':=', '192.0.2.10');
+`
+
+func openTestSQLBackend(t *testing.T) *SQLBackend {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqlSchema); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewSQLBackend(db)
+}
+
+func buildAccessRequest(user string, password string, nasIP string) *Request {
+	var auth [16]byte
+	copy(auth[:], []byte(RA1))
+
+	p := Packet{Code: AccessRequest, Identifier: identifier, Authenticator: auth}
+	p.AddAttribute(UserName, []byte(user))
+	p.AddAttribute(UserPassword, HidePassword(password, auth, secret))
+	DefaultDictionary.AddAttribute(&p, "NAS-IP-Address", nasIP)
+
+	return &Request{Packet: p, Secret: secret}
+}
+
+func TestSQLBackend(t *testing.T) {
+	backend := openTestSQLBackend(t)
+	defer backend.DB.Close()
+
+	cases := []struct {
+		req      *Request
+		code     Code
+		expected Pairs
+	}{
+		// User reply items win over group items using "=", and groups are filtered by their check items.
+		{buildAccessRequest("alice", "wonderland", "127.0.0.1"), AccessAccept,
+			Pairs{{"Session-Timeout", OpSet, "3600"}, {"Reply-Message", OpAdd, "Hello alice"}, {"Filter-Id", OpEqual, "staff"}, {"Framed-IP-Address", OpSet, "192.0.2.10"}}},
+		{buildAccessRequest("alice", "wonderland", "10.0.0.2"), AccessAccept,
+			Pairs{{"Session-Timeout", OpSet, "3600"}, {"Reply-Message", OpAdd, "Hello alice"}, {"Filter-Id", OpEqual, "staff"}}},
+		{buildAccessRequest("alice", "wrong", "127.0.0.1"), AccessReject, nil},
+		// Hashed password with reply items only from a group.
+		{buildAccessRequest("bob", "secret", "127.0.0.1"), AccessAccept,
+			Pairs{{"Filter-Id", OpEqual, "staff"}, {"Session-Timeout", OpEqual, "600"}}},
+		// User check items must match the request.
+		{buildAccessRequest("carol", "secret", "10.0.0.1"), AccessAccept, nil},
+		{buildAccessRequest("carol", "secret", "10.0.0.2"), AccessReject, nil},
+		// Forced reject and unknown user.
+		{buildAccessRequest("dave", "", "127.0.0.1"), AccessReject, nil},
+		{buildAccessRequest("mallory", "secret", "127.0.0.1"), AccessReject, nil},
+	}
+
+	for test, c := range cases {
+		got := backend.ServeRADIUS(c.req)
+
+		if got.Code != c.code {
+			t.Errorf("Test %d: ServeRADIUS(%s).Code == %s, want %s", test, c.req.UserName(), got.Code, c.code)
+			continue
+		}
+
+		expected := &Packet{}
+		if err := DefaultDictionary.AddPairs(expected, c.expected); err != nil {
+			t.Fatal(err)
+		}
+		if string(got.Attributes) != string(expected.Attributes) {
+			t.Errorf("Test %d: ServeRADIUS(%s).Attributes == %X, want %X", test, c.req.UserName(), got.Attributes, expected.Attributes)
+		}
+	}
+
+	accounting := buildAccountingRequest(1, Pairs{{"Acct-Status-Type", OpSet, "Start"}, {"User-Name", OpSet, "alice"}})
+	if got := backend.ServeRADIUS(accounting); got != nil {
+		t.Errorf("ServeRADIUS(Accounting-Request) == %v, want no response", got)
+	}
+}
+
+func TestSQLBackendCredential(t *testing.T) {
+	backend := openTestSQLBackend(t)
+	defer backend.DB.Close()
+
+	got, err := backend.Credential("bob")
+	if err != nil || got.Scheme() != SchemeMD5Crypt {
+		t.Errorf("Credential(bob) == %q, %v, want an MD5-crypt credential", got, err)
+	}
+	if _, err := backend.Credential("mallory"); err != ErrUnknownUser {
+		t.Errorf("Credential(mallory) returned %v, want %v", err, ErrUnknownUser)
+	}
+}
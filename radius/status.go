@@ -0,0 +1,207 @@
+package radius
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// VendorFreeRADIUS is the Private Enterprise Code of the FreeRADIUS vendor-specific attributes.
+const VendorFreeRADIUS = 11344
+
+// FreeRADIUS vendor-specific attributes reporting server statistics in responses to Status-Server.
+const (
+	FreeRADIUSStatisticsType Attribute = 127
+
+	FreeRADIUSTotalAccessRequests     = 128
+	FreeRADIUSTotalAccessAccepts      = 129
+	FreeRADIUSTotalAccessRejects      = 130
+	FreeRADIUSTotalAccessChallenges   = 131
+	FreeRADIUSTotalAuthResponses      = 132
+	FreeRADIUSTotalAuthDroppedReqs    = 136
+	FreeRADIUSTotalAuthUnknownTypes   = 137
+	FreeRADIUSTotalAccountingRequests = 138
+	FreeRADIUSTotalAccountingResps    = 139
+	FreeRADIUSTotalAcctDroppedReqs    = 143
+	FreeRADIUSTotalAcctUnknownTypes   = 144
+
+	FreeRADIUSStatsStartTime = 176
+)
+
+var freeRADIUSText = map[Attribute]string{
+	FreeRADIUSStatisticsType: "FreeRADIUS-Statistics-Type",
+
+	FreeRADIUSTotalAccessRequests:     "FreeRADIUS-Total-Access-Requests",
+	FreeRADIUSTotalAccessAccepts:      "FreeRADIUS-Total-Access-Accepts",
+	FreeRADIUSTotalAccessRejects:      "FreeRADIUS-Total-Access-Rejects",
+	FreeRADIUSTotalAccessChallenges:   "FreeRADIUS-Total-Access-Challenges",
+	FreeRADIUSTotalAuthResponses:      "FreeRADIUS-Total-Auth-Responses",
+	FreeRADIUSTotalAuthDroppedReqs:    "FreeRADIUS-Total-Auth-Dropped-Requests",
+	FreeRADIUSTotalAuthUnknownTypes:   "FreeRADIUS-Total-Auth-Unknown-Types",
+	FreeRADIUSTotalAccountingRequests: "FreeRADIUS-Total-Accounting-Requests",
+	FreeRADIUSTotalAccountingResps:    "FreeRADIUS-Total-Accounting-Responses",
+	FreeRADIUSTotalAcctDroppedReqs:    "FreeRADIUS-Total-Acct-Dropped-Requests",
+	FreeRADIUSTotalAcctUnknownTypes:   "FreeRADIUS-Total-Acct-Unknown-Types",
+
+	FreeRADIUSStatsStartTime: "FreeRADIUS-Stats-Start-Time",
+}
+
+// Bits of FreeRADIUS-Statistics-Type selecting the statistics to return.
+const (
+	statisticsAuthentication = 1
+	statisticsAccounting     = 2
+)
+
+// Role is the service a Server provides on its addresses, telling how it answers Status-Server requests (RFC 5997
+// section 3).
+type Role int
+
+const (
+	// RoleAuth servers answer Status-Server with an Access-Accept.
+	RoleAuth Role = iota
+	// RoleAccounting servers answer Status-Server with an Accounting-Response.
+	RoleAccounting
+)
+
+// ServerStats counts the requests handled by a Server.
+type ServerStats struct {
+	// Start is when the server started serving.
+	Start time.Time
+
+	AccessRequests   uint64
+	AccessAccepts    uint64
+	AccessRejects    uint64
+	AccessChallenges uint64
+	// AuthDropped counts the Access-Requests that got no response.
+	AuthDropped uint64
+
+	AccountingRequests  uint64
+	AccountingResponses uint64
+	// AcctDropped counts the Accounting-Requests that got no response.
+	AcctDropped uint64
+
+	// UnknownTypes counts the requests of other codes.
+	UnknownTypes uint64
+
+	// QueueDropped counts the requests dropped because the queue of the workers was full.
+	QueueDropped uint64
+	// ClientDropped counts the requests dropped because their client had MaxInFlight requests in flight.
+	ClientDropped uint64
+}
+
+// Stats returns the request counters of the server.
+func (srv *Server) Stats() ServerStats {
+	srv.statsMu.Lock()
+	defer srv.statsMu.Unlock()
+
+	return srv.stats
+}
+
+// recordStart records that the server started serving.
+func (srv *Server) recordStart() {
+	srv.statsMu.Lock()
+	defer srv.statsMu.Unlock()
+
+	srv.stats.Start = time.Now()
+}
+
+// count records the outcome of a request in the statistics of the server.
+func (srv *Server) count(req *Request, response *Packet) {
+	srv.statsMu.Lock()
+	defer srv.statsMu.Unlock()
+
+	stats := &srv.stats
+	switch req.Packet.Code {
+	case AccessRequest:
+		stats.AccessRequests++
+		if response == nil {
+			stats.AuthDropped++
+			break
+		}
+		switch response.Code {
+		case AccessAccept:
+			stats.AccessAccepts++
+		case AccessReject:
+			stats.AccessRejects++
+		case AccessChallenge:
+			stats.AccessChallenges++
+		}
+	case AccountingRequest:
+		stats.AccountingRequests++
+		if response == nil {
+			stats.AcctDropped++
+		} else {
+			stats.AccountingResponses++
+		}
+	default:
+		stats.UnknownTypes++
+	}
+}
+
+// serveStatus answers a Status-Server request, whose Message-Authenticator respond has verified, as described in
+// RFC 5997, with an Access-Accept or, on servers with RoleAccounting, an Accounting-Response. If the server has Statistics set,
+// the response carries the statistics selected by the FreeRADIUS-Statistics-Type of the request.
+func (srv *Server) serveStatus(req *Request) *Packet {
+	code := Code(AccessAccept)
+	if srv.Role == RoleAccounting {
+		code = AccountingResponse
+	}
+	response := req.Response(code)
+
+	if values := req.Packet.VendorValues(VendorFreeRADIUS, FreeRADIUSStatisticsType); srv.Statistics && len(values) > 0 && len(values[0]) == 4 {
+		srv.addStatistics(response, binary.BigEndian.Uint32(values[0]))
+	}
+
+	response.AddAttribute(MessageAuthenticator, make([]byte, 16))
+	return response
+}
+
+// addStatistics appends the FreeRADIUS statistics selected by the bits of statisticsType to response.
+func (srv *Server) addStatistics(response *Packet, statisticsType uint32) {
+	stats := srv.Stats()
+
+	add := func(key Attribute, value uint64) {
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, uint32(value))
+		response.AddVendorAttribute(VendorFreeRADIUS, key, b)
+	}
+
+	if statisticsType&statisticsAuthentication != 0 {
+		add(FreeRADIUSTotalAccessRequests, stats.AccessRequests)
+		add(FreeRADIUSTotalAccessAccepts, stats.AccessAccepts)
+		add(FreeRADIUSTotalAccessRejects, stats.AccessRejects)
+		add(FreeRADIUSTotalAccessChallenges, stats.AccessChallenges)
+		add(FreeRADIUSTotalAuthResponses, stats.AccessAccepts+stats.AccessRejects+stats.AccessChallenges)
+		add(FreeRADIUSTotalAuthDroppedReqs, stats.AuthDropped)
+		add(FreeRADIUSTotalAuthUnknownTypes, stats.UnknownTypes)
+	}
+	if statisticsType&statisticsAccounting != 0 {
+		add(FreeRADIUSTotalAccountingRequests, stats.AccountingRequests)
+		add(FreeRADIUSTotalAccountingResps, stats.AccountingResponses)
+		add(FreeRADIUSTotalAcctDroppedReqs, stats.AcctDropped)
+		add(FreeRADIUSTotalAcctUnknownTypes, stats.UnknownTypes)
+	}
+	if statisticsType&(statisticsAuthentication|statisticsAccounting) != 0 {
+		add(FreeRADIUSStatsStartTime, uint64(stats.Start.Unix()))
+	}
+}
+
+// freeRADIUSDefinitions returns the definitions of the FreeRADIUS vendor-specific attributes.
+func freeRADIUSDefinitions() []AttributeDefinition {
+	var defs []AttributeDefinition
+	for a, name := range freeRADIUSText {
+		def := AttributeDefinition{Name: name, Attribute: a, Vendor: VendorFreeRADIUS, Type: TypeInteger}
+		switch a {
+		case FreeRADIUSStatsStartTime:
+			def.Type = TypeDate
+		case FreeRADIUSStatisticsType:
+			def.Values = map[string]uint32{
+				"None":           0,
+				"Authentication": statisticsAuthentication,
+				"Accounting":     statisticsAccounting,
+				"Auth-Acct":      statisticsAuthentication | statisticsAccounting,
+			}
+		}
+		defs = append(defs, def)
+	}
+	return defs
+}
@@ -0,0 +1,75 @@
+package radius
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestStatusServer(t *testing.T) {
+	srv := &Server{Secret: secret, Users: Users{"alice": "{CLEARTEXT}wonderland"}, Statistics: true}
+	addr := listenTestServer(t, srv)
+
+	client := &Client{Retry: 20 * time.Millisecond, MaxAttempts: 2}
+	defer client.Close()
+	ctx := context.Background()
+
+	request, err := NewAccessRequest("alice", "wonderland", secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Exchange(ctx, addr, secret, request); err != nil {
+		t.Fatal(err)
+	}
+
+	status := NewStatusServer()
+	DefaultDictionary.AddAttribute(status, "FreeRADIUS-Statistics-Type", "Authentication")
+	response, err := client.Exchange(ctx, addr, secret, status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Code != AccessAccept {
+		t.Errorf("Status-Server answered with %v, want %v", response.Code, AccessAccept)
+	}
+	signed := Packet{Code: response.Code, Identifier: response.Identifier, Authenticator: status.Authenticator}
+	signed.Attributes = append(signed.Attributes, response.Attributes...)
+	signMessageAuthenticator(&signed, secret)
+	if len(response.Values(MessageAuthenticator)) != 1 || !bytes.Equal(signed.Attributes, response.Attributes) {
+		t.Errorf("response to Status-Server has no valid Message-Authenticator")
+	}
+	pairs := DefaultDictionary.Pairs(response)
+	if requests, _ := pairs.Lookup("FreeRADIUS-Total-Access-Requests"); requests != "1" {
+		t.Errorf("FreeRADIUS-Total-Access-Requests == %q, want 1 in %v", requests, pairs)
+	}
+	if accepts, _ := pairs.Lookup("FreeRADIUS-Total-Access-Accepts"); accepts != "1" {
+		t.Errorf("FreeRADIUS-Total-Access-Accepts == %q, want 1", accepts)
+	}
+
+	// Status-Server without Message-Authenticator is ignored.
+	if _, err := client.Exchange(ctx, addr, secret, &Packet{Code: StatusServer}); err != ErrTimeout {
+		t.Errorf("Status-Server without Message-Authenticator returned %v, want %v", err, ErrTimeout)
+	}
+	if stats := srv.Stats(); stats.AccessRequests != 1 || stats.UnknownTypes != 0 {
+		t.Errorf("Stats() == %+v, want one Access-Request and Status-Server not counted", stats)
+	}
+}
+
+func TestStatusServerRole(t *testing.T) {
+	status := NewStatusServer()
+	status.Authenticator[0] = 1
+	signMessageAuthenticator(status, secret)
+
+	// The role of the server, not the port, selects the response.
+	srv := &Server{Secret: secret}
+	req := &Request{Packet: *status, Secret: secret, LocalAddr: &net.UDPAddr{Port: 1813}}
+	if response := srv.serveStatus(req); response == nil || response.Code != AccessAccept {
+		t.Errorf("Status-Server to an authentication server answered with %v, want %v", response, AccessAccept)
+	}
+	srv.Role = RoleAccounting
+	req = &Request{Packet: *status, Secret: secret, LocalAddr: &net.UDPAddr{Port: 1812}}
+	if response := srv.serveStatus(req); response == nil || response.Code != AccountingResponse {
+		t.Errorf("Status-Server to an accounting server answered with %v, want %v", response, AccountingResponse)
+	}
+}
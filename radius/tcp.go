@@ -0,0 +1,170 @@
+package radius
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/dtls/v2"
+)
+
+// ErrMalformedPacket is returned when a stream carries a packet whose Length is outside the range allowed by RFC
+// 2865 section 3. The stream cannot be resynchronized and must be closed (RFC 6613 section 2.6.3).
+var ErrMalformedPacket = errors.New("radius: malformed packet length")
+
+// errUnknownClient closes the TCP connections of addresses matching none of the Clients of a Server.
+var errUnknownClient = errors.New("radius: unknown client")
+
+// Bounds of the Length field of a packet (RFC 2865 section 3).
+const (
+	minPacketLength = 20
+	maxPacketLength = 4096
+)
+
+// readPacket reads the next packet of a stream, framed by its Length field, into buffer, which must hold
+// maxPacketLength octets.
+func readPacket(r io.Reader, buffer []byte) (Packet, error) {
+	if _, err := io.ReadFull(r, buffer[:4]); err != nil {
+		return Packet{}, err
+	}
+
+	length := int(binary.BigEndian.Uint16(buffer[2:4]))
+	if length < minPacketLength || length > maxPacketLength {
+		return Packet{}, ErrMalformedPacket
+	}
+
+	if _, err := io.ReadFull(r, buffer[4:length]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Packet{}, err
+	}
+
+	return DecodePacket(buffer, length), nil
+}
+
+// readDatagram reads the next packet of a datagram connection into buffer, which must hold maxPacketLength octets,
+// skipping datagrams that are not a packet.
+func readDatagram(r io.Reader, buffer []byte) (Packet, error) {
+	for {
+		n, err := r.Read(buffer)
+		if err != nil {
+			return Packet{}, err
+		}
+		if packet, ok := decodeDatagram(buffer[:n]); ok {
+			return packet, nil
+		}
+	}
+}
+
+// serveTCP accepts connections on srv.Listener and serves the requests received on each until the listener is
+// closed.
+func (srv *Server) serveTCP() error {
+	srv.recordStart()
+	defer srv.serving()()
+
+	for {
+		conn, err := srv.Listener.Accept()
+		if err != nil {
+			return err
+		}
+		go srv.serveStream(conn)
+	}
+}
+
+// serveStream serves the requests received on a connection or DTLS session. Requests are handled concurrently and
+// their responses written as they are ready, so that a slow request does not hold up the others. The connection is
+// closed when the client closes it, sends a malformed packet over TCP or stays idle for IdleTimeout.
+func (srv *Server) serveStream(conn net.Conn) {
+	defer srv.serving()()
+	defer conn.Close()
+
+	var client *NASClient
+	secret := RadSecSecret
+	read := readPacket
+	var err error
+	switch conn := conn.(type) {
+	case *tls.Conn:
+		client, err = srv.tlsClient(conn)
+	case *dtls.Conn:
+		client, err = srv.dtlsClient(conn)
+		read = readDatagram
+	default:
+		var ok bool
+		if client, secret, ok = srv.clientFor(conn.RemoteAddr()); !ok {
+			err = errUnknownClient
+		}
+	}
+	// Failed handshakes are not counted: their peer may be any client.
+	if errors.Is(err, ErrUnknownCertificate) || err == errUnknownClient {
+		srv.dropped(conn.RemoteAddr(), nil, DropUnknownClient)
+	}
+	if err != nil {
+		log.Printf("radius: closing connection from %v: %v", conn.RemoteAddr(), err)
+		return
+	}
+
+	var writeMu sync.Mutex
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(srv.idleTimeout()))
+
+		buffer := packetBuffers.Get().(*[maxPacketLength]byte)
+		release := func() { packetBuffers.Put(buffer) }
+
+		packet, err := read(conn, buffer[:])
+		if err != nil {
+			release()
+			var netErr net.Error
+			idle := errors.As(err, &netErr) && netErr.Timeout()
+			if err == ErrMalformedPacket {
+				srv.dropped(conn.RemoteAddr(), client, DropMalformed)
+			}
+			if err != io.EOF && !idle && !errors.Is(err, net.ErrClosed) {
+				log.Printf("radius: closing connection from %v: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		// The packet is framed by its Length, so the stream goes on past one whose attributes are malformed.
+		if !packet.wellFormed() {
+			release()
+			srv.dropped(conn.RemoteAddr(), client, DropMalformed)
+			continue
+		}
+
+		wg.Add(1)
+		srv.dispatcher().submit(conn.RemoteAddr(), client, func() {
+			defer wg.Done()
+			defer release()
+
+			req := &Request{Packet: packet, RemoteAddr: conn.RemoteAddr(), LocalAddr: conn.LocalAddr(), Secret: secret, Client: client}
+			response := srv.respond(req)
+			if response == nil {
+				return
+			}
+
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			if _, err := conn.Write(response); err != nil {
+				log.Println(err)
+			}
+		}, func() {
+			release()
+			wg.Done()
+		})
+	}
+}
+
+func (srv *Server) idleTimeout() time.Duration {
+	if srv.IdleTimeout <= 0 {
+		return 30 * time.Second
+	}
+	return srv.IdleTimeout
+}
@@ -0,0 +1,144 @@
+package radius
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// listenTestTCPServer starts srv over TCP on a random local port and returns its address.
+func listenTestTCPServer(t *testing.T, srv *Server) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	srv.Listener = listener
+	go srv.serveTCP()
+
+	return listener.Addr().String()
+}
+
+func TestReadPacket(t *testing.T) {
+	request := &buildAccessRequest("alice", "wonderland", "10.0.0.1").Packet
+	request.Identifier = 7
+	message := request.packetToBytes()
+
+	buffer := make([]byte, maxPacketLength)
+	stream := bytes.NewReader(append(append([]byte(nil), message...), message...))
+	for i := 0; i < 2; i++ {
+		packet, err := readPacket(stream, buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if packet.Identifier != request.Identifier || !bytes.Equal(packet.Attributes, request.Attributes) {
+			t.Errorf("readPacket() == %+v, want %+v", packet, request)
+		}
+	}
+	if _, err := readPacket(stream, buffer); err != io.EOF {
+		t.Errorf("readPacket() at end of stream returned %v, want %v", err, io.EOF)
+	}
+
+	if _, err := readPacket(bytes.NewReader(message[:30]), buffer); err != io.ErrUnexpectedEOF {
+		t.Errorf("readPacket() of truncated packet returned %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if _, err := readPacket(bytes.NewReader([]byte{1, 0, 0, 19}), buffer); err != ErrMalformedPacket {
+		t.Errorf("readPacket() of packet with Length 19 returned %v, want %v", err, ErrMalformedPacket)
+	}
+}
+
+func TestTCPServer(t *testing.T) {
+	// Requests for slow are answered after the others sent on the same connection.
+	slow := make(chan struct{})
+	srv := &Server{Secret: secret, Users: Users{"alice": "{CLEARTEXT}wonderland", "slow": "{CLEARTEXT}slow"}}
+	srv.Handler = HandlerFunc(func(req *Request) *Packet {
+		if req.UserName() == "slow" {
+			<-slow
+		}
+		return srv.authenticate(req)
+	})
+	addr := listenTestTCPServer(t, srv)
+
+	client := &Client{Net: "tcp"}
+	defer client.Close()
+
+	slowDone := make(chan error, 1)
+	go func() {
+		request, err := NewAccessRequest("slow", "slow", secret)
+		if err != nil {
+			slowDone <- err
+			return
+		}
+		_, err = client.Exchange(context.Background(), addr, secret, request)
+		slowDone <- err
+	}()
+
+	var wg sync.WaitGroup
+	for password, want := range map[string]Code{"wonderland": AccessAccept, "looking-glass": AccessReject} {
+		password, want := password, want
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			request, err := NewAccessRequest("alice", password, secret)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			response, err := client.Exchange(context.Background(), addr, secret, request)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if response.Code != want {
+				t.Errorf("Access-Request with password %q answered with %v, want %v", password, response.Code, want)
+			}
+		}()
+	}
+	wg.Wait()
+
+	close(slow)
+	if err := <-slowDone; err != nil {
+		t.Error(err)
+	}
+
+	status := NewStatusServer()
+	response, err := client.Exchange(context.Background(), addr, secret, status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Code != AccessAccept {
+		t.Errorf("Status-Server answered with %v, want %v", response.Code, AccessAccept)
+	}
+}
+
+func TestTCPServerClosesConnection(t *testing.T) {
+	addr := listenTestTCPServer(t, &Server{Secret: secret, IdleTimeout: 50 * time.Millisecond})
+
+	cases := map[string][]byte{
+		"idle connection":       nil,
+		"malformed packet":      {1, 0, 0, 19},
+		"oversized packet":      {1, 0, 0x10, 0x01},
+		"idle in middle of one": {1, 0, 0, 30},
+	}
+
+	for name, sent := range cases {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.Write(sent); err != nil {
+			t.Fatal(err)
+		}
+
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+			t.Errorf("%s: read returned %v, want connection closed by server", name, err)
+		}
+		conn.Close()
+	}
+}